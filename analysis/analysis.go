@@ -2,11 +2,7 @@ package analysis
 
 import (
 	"fmt"
-	"hb-crawler/rating-gain/database"
 	"math"
-
-	"github.com/sirupsen/logrus"
-	"gonum.org/v1/gonum/optimize"
 )
 
 const (
@@ -23,18 +19,51 @@ type PointGainEstimator struct {
 
 type PointGainEstimatorGrad = PointGainEstimator // gradient of the params of the estimator
 
+const (
+	ExponentFactorParam = "A"
+	ExponentParam       = "B"
+	BaseParam           = "base"
+
+	// A, B and the Elo base follow the polynomial coefficients
+	nonPolynomialParams = 3
+)
+
+/*
+ParamNames names the entries of the estimator's parameter vector, which is laid out as
+
+	[k_n, ..., k_1, k_0, A, B, base]
+
+for a polynomial of the given degree.
+*/
+func ParamNames(degree int) []string {
+	names := []string{}
+	for exp := degree; exp >= 0; exp-- {
+		names = append(names, fmt.Sprintf("k%d", exp))
+	}
+	return append(names, ExponentFactorParam, ExponentParam, BaseParam)
+}
+
+// CreatePointGainEstimator creates an estimator from a parameter vector laid out as described by ParamNames.
 func CreatePointGainEstimator(params []float64) (*PointGainEstimator, error) {
-	if len(params) < 2 {
+	if len(params) < nonPolynomialParams+1 {
 		return nil, fmt.Errorf("not enough params")
 	}
+	polynomialCount := len(params) - nonPolynomialParams
 	return &PointGainEstimator{
-		params: params[:len(params)-1],
-		base:   params[len(params)-1],
+		params:         append([]float64{}, params[:polynomialCount]...),
+		exponentFactor: params[polynomialCount],
+		exponent:       params[polynomialCount+1],
+		base:           params[polynomialCount+2],
 	}, nil
 }
 
 func (e *PointGainEstimator) Params() []float64 {
-	return append(e.params, e.base)
+	params := append([]float64{}, e.params...)
+	return append(params, e.exponentFactor, e.exponent, e.base)
+}
+
+func (e *PointGainEstimator) ParamNames() []string {
+	return ParamNames(len(e.params) - 1)
 }
 
 func (e *PointGainEstimator) Base() float64 {
@@ -76,56 +105,10 @@ func (e *PointGainEstimator) EstimatePointGain(originalPoint int32, routeRating
 	d := math.Abs(float64(originalPoint) - float64(routeRating))
 
 	k := polynomial(d, e.params)
-	k += e.exponentFactor * math.Pow(d, e.exponent)
+	if e.exponentFactor != 0 && d > 0 {
+		k += e.exponentFactor * math.Pow(d, e.exponent)
+	}
 
 	r := float64(originalPoint) + k*e.rateFactor(originalPoint, routeRating)
 	return r
 }
-
-func createOptimizerProblem(pointGains []database.ReducedPointGainRecord) *optimize.Problem {
-	lossFunc := func(x []float64) float64 {
-		estimator, _ := CreatePointGainEstimator(x)
-		loss := float64(0)
-		for _, record := range pointGains {
-			estimated := estimator.EstimatePointGain(int32(record.UserPointsBefore), int32(record.RoutePoints))
-			diff := float64(estimated) - float64(record.UserPointsAfter)
-			loss += math.Abs(diff)
-		}
-		loss = loss / float64(len(pointGains))
-		return loss
-	}
-
-	return &optimize.Problem{
-		Func: lossFunc,
-	}
-}
-
-type OptimizeResult struct {
-	InitialParams []float64 `json:"initial_params"`
-	InitialLoss   float64   `json:"initial_loss"`
-	Params        []float64 `json:"params"`
-	Loss          float64   `json:"loss"`
-}
-
-func OptimizeEstimator(
-	pointGains []database.ReducedPointGainRecord,
-	initialEstimator *PointGainEstimator,
-) (*OptimizeResult, error) {
-	problem := createOptimizerProblem(pointGains)
-	initialParams := initialEstimator.Params()
-	initialLoss := problem.Func(initialParams)
-	result, err := optimize.Minimize(
-		*problem, initialParams,
-		&optimize.Settings{Concurrent: 4}, nil,
-	)
-	if err != nil {
-		logrus.Errorf("failed to optimize estimator: %+v\n", err)
-		return nil, err
-	}
-	return &OptimizeResult{
-		InitialParams: initialParams,
-		Params:        result.X,
-		InitialLoss:   initialLoss,
-		Loss:          result.F,
-	}, nil
-}
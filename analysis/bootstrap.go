@@ -0,0 +1,185 @@
+package analysis
+
+import (
+	"context"
+	"fmt"
+	"hb-crawler/rating-gain/database"
+	"math"
+	"math/rand"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// MaxBootstrap caps the resamples of a bootstrap, each of them is a full fit.
+const MaxBootstrap = 1000
+
+type ParamUncertainty struct {
+	Name     string  `json:"name"`
+	Estimate float64 `json:"estimate"`
+	Mean     float64 `json:"mean"`
+	StdDev   float64 `json:"std_dev"`
+	// percentile interval of the bootstrap estimates
+	Lower float64 `json:"lower"`
+	Upper float64 `json:"upper"`
+}
+
+type BootstrapSummary struct {
+	Resamples  int                `json:"resamples"`
+	Failed     int                `json:"failed"`
+	Confidence float64            `json:"confidence"`
+	Params     []ParamUncertainty `json:"params"`
+}
+
+// percentile interpolates linearly between the closest ranks of the sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return math.NaN()
+	}
+	rank := p * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	weight := rank - float64(lower)
+	return sorted[lower]*(1-weight) + sorted[upper]*weight
+}
+
+func resample(pointGains []database.ReducedPointGainRecord, seed int64) []database.ReducedPointGainRecord {
+	random := rand.New(rand.NewSource(seed))
+	resampled := make([]database.ReducedPointGainRecord, len(pointGains))
+	for i := range resampled {
+		resampled[i] = pointGains[random.Intn(len(pointGains))]
+	}
+	return resampled
+}
+
+func summarizeBootstrap(
+	estimate *OptimizeResult,
+	estimates [][]float64,
+	resamples int,
+	confidence float64,
+) *BootstrapSummary {
+	summary := BootstrapSummary{
+		Resamples:  resamples,
+		Failed:     resamples - len(estimates),
+		Confidence: confidence,
+		Params:     []ParamUncertainty{},
+	}
+	if len(estimates) == 0 {
+		return &summary
+	}
+
+	alpha := (1 - confidence) / 2
+	for index, name := range estimate.ParamNames {
+		values := make([]float64, len(estimates))
+		mean := float64(0)
+		for i, params := range estimates {
+			values[i] = params[index]
+			mean += params[index]
+		}
+		mean /= float64(len(values))
+		variance := float64(0)
+		for _, value := range values {
+			variance += (value - mean) * (value - mean)
+		}
+		if len(values) > 1 {
+			variance /= float64(len(values) - 1)
+		}
+		sort.Float64s(values)
+
+		summary.Params = append(summary.Params, ParamUncertainty{
+			Name:     name,
+			Estimate: estimate.Params[index],
+			Mean:     mean,
+			StdDev:   math.Sqrt(variance),
+			Lower:    percentile(values, alpha),
+			Upper:    percentile(values, 1-alpha),
+		})
+	}
+	return &summary
+}
+
+/*
+Bootstrap refits the model on resamples of the samples drawn with replacement,
+starting every refit from the estimate, and summarizes the spread of the refitted
+params. Resamples are fitted in parallel and seeded from options.BootstrapSeed,
+so that summaries are reproducible. Progress, if not nil, is reported after
+every finished refit.
+*/
+func Bootstrap(
+	ctx context.Context,
+	pointGains []database.ReducedPointGainRecord,
+	model Model,
+	estimate *OptimizeResult,
+	options *OptimizeOptions,
+	progress func(Progress),
+) (*BootstrapSummary, error) {
+	if options.Bootstrap < 2 {
+		return nil, fmt.Errorf("at least 2 resamples are required")
+	}
+	if options.Bootstrap > MaxBootstrap {
+		return nil, fmt.Errorf("at most %d resamples are allowed", MaxBootstrap)
+	}
+	confidence := options.Confidence
+	if confidence <= 0 || confidence >= 1 {
+		confidence = DefaultConfidence
+	}
+	refitOptions := options.withoutBootstrap()
+	start := &FittedModel{Model: model, Params: estimate.Params}
+	// refits run on their own goroutines, where panics cannot be recovered by the caller
+	refit := func(i int) (result *OptimizeResult, err error) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				logrus.Errorf("Refit of bootstrap resample %d panicked: %+v\n%s", i, recovered, debug.Stack())
+				err = fmt.Errorf("panic: %v", recovered)
+			}
+		}()
+		return OptimizeEstimatorContext(ctx, resample(pointGains, options.BootstrapSeed+int64(i)), start, refitOptions, nil)
+	}
+
+	jobs := make(chan int)
+	results := make([][]float64, options.Bootstrap)
+	wg := sync.WaitGroup{}
+	mutex := sync.Mutex{}
+	finished := 0
+	for worker := 0; worker < runtime.NumCPU(); worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				result, err := refit(i)
+				if err != nil && ctx.Err() == nil {
+					logrus.Warnf("Failed to refit bootstrap resample %d: %+v\n", i, err)
+				}
+				if err == nil {
+					results[i] = result.Params
+				}
+
+				mutex.Lock()
+				finished++
+				if progress != nil {
+					progress(Progress{Stage: BootstrapStage, Resamples: finished})
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+	for i := 0; i < options.Bootstrap && ctx.Err() == nil; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	estimates := [][]float64{}
+	for _, params := range results {
+		if params != nil {
+			estimates = append(estimates, params)
+		}
+	}
+	return summarizeBootstrap(estimate, estimates, options.Bootstrap, confidence), nil
+}
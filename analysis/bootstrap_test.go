@@ -0,0 +1,53 @@
+package analysis
+
+import (
+	"context"
+	"hb-crawler/rating-gain/database"
+	"math/rand"
+	"testing"
+)
+
+func TestBootstrapIntervalCoversSlope(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	records := []database.ReducedPointGainRecord{}
+	for i := 0; i < 200; i++ {
+		route := 50 + random.Intn(300)
+		before := random.Intn(500)
+		gain := 5 + route/10 + random.Intn(7) - 3
+		records = append(records, database.ReducedPointGainRecord{
+			RoutePoints:      route,
+			UserPointsBefore: before,
+			UserPointsAfter:  before + gain,
+		})
+	}
+
+	options := DefaultOptimizeOptions()
+	options.Loss = MSELoss
+	options.Frozen = []string{"points_before"}
+	options.Bootstrap = 20
+	options.BootstrapSeed = 1
+	result, err := OptimizeEstimator(records, CreateDefaultFittedModel(&LinearModel{}), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Uncertainty == nil || result.Uncertainty.Failed > 0 {
+		t.Fatalf("unexpected bootstrap summary %+v", result.Uncertainty)
+	}
+	slope := result.Uncertainty.Params[1]
+	if slope.Lower > 0.1 || slope.Upper < 0.1 || slope.StdDev <= 0 {
+		t.Errorf("interval [%f, %f] of the route points slope misses 0.1", slope.Lower, slope.Upper)
+	}
+	if frozen := result.Uncertainty.Params[2]; frozen.StdDev != 0 {
+		t.Errorf("frozen param varies with std dev %f", frozen.StdDev)
+	}
+}
+
+func TestBootstrapRejectsTooManyResamples(t *testing.T) {
+	options := DefaultOptimizeOptions()
+	options.Bootstrap = MaxBootstrap + 1
+	model := CreateDefaultFittedModel(&LinearModel{})
+	estimate := &OptimizeResult{Params: model.Params}
+	if _, err := Bootstrap(context.Background(), nil, model.Model, estimate, options, nil); err == nil {
+		t.Errorf("bootstrap of %d resamples succeeded", options.Bootstrap)
+	}
+}
@@ -0,0 +1,266 @@
+package analysis
+
+import (
+	"hb-crawler/rating-gain/database"
+	"sort"
+	"time"
+)
+
+// points changing by more than this between two samples of a user are suspicious
+const DefaultJumpThreshold = 200
+
+type DatasetSample struct {
+	EventId      int                 `json:"event_id"`
+	UserId       int                 `json:"user_id"`
+	RoutePoints  int                 `json:"route_points"`
+	PointsBefore *int                `json:"points_before"`
+	PointsAfter  *int                `json:"points_after"`
+	EventDate    int64               `json:"event_date"`
+	Kind         database.SampleKind `json:"kind"`
+	Activity     string              `json:"activity"`
+}
+
+// DuplicateGain groups live samples of a user recording the same points before and after for different events.
+type DuplicateGain struct {
+	UserId       int   `json:"user_id"`
+	PointsBefore int   `json:"points_before"`
+	PointsAfter  int   `json:"points_after"`
+	EventIds     []int `json:"event_ids"`
+}
+
+// PointsJump is a change of a user's points between two of their samples that no tracked event explains.
+type PointsJump struct {
+	UserId      int `json:"user_id"`
+	FromEventId int `json:"from_event_id"`
+	ToEventId   int `json:"to_event_id"`
+	// points after the earlier sample and before the later one
+	PointsAfter  int `json:"points_after"`
+	PointsBefore int `json:"points_before"`
+	Change       int `json:"change"`
+}
+
+type UnpointedEvent struct {
+	EventId int    `json:"event_id"`
+	Title   string `json:"title"`
+	RouteId int    `json:"route_id"`
+	Date    int64  `json:"date"`
+}
+
+type Coverage struct {
+	Bucket   string `json:"bucket"`
+	Total    int    `json:"total"`
+	Complete int    `json:"complete"`
+	Dangling int    `json:"dangling"`
+	// samples the estimator is fitted on
+	Valid int `json:"valid"`
+	// lower bound of numeric buckets
+	start int
+}
+
+type DanglingAge struct {
+	DatasetSample
+	AgeDays float64 `json:"age_days"`
+}
+
+type DatasetReport struct {
+	GeneratedAt int64 `json:"generated_at"`
+	Total       int   `json:"total"`
+	Complete    int   `json:"complete"`
+	Dangling    int   `json:"dangling"`
+	Historical  int   `json:"historical"`
+	Valid       int   `json:"valid"`
+	// valid samples whose route is unknown, fitted without route features
+	ValidWithoutRoute int `json:"valid_without_route"`
+	// complete live samples whose points did not increase, left out of fitting
+	NonIncreasing            []DatasetSample  `json:"non_increasing"`
+	Duplicates               []DuplicateGain  `json:"duplicates"`
+	EventsWithoutRoutePoints []UnpointedEvent `json:"events_without_route_points"`
+	JumpThreshold            int              `json:"jump_threshold"`
+	SuspiciousUsers          int              `json:"suspicious_users"`
+	SuspiciousJumps          []PointsJump     `json:"suspicious_jumps"`
+	ByMonth                  []Coverage       `json:"by_month"`
+	ByRoutePoints            []Coverage       `json:"by_route_points"`
+	// oldest sample still waiting for its points after, nil if there is none
+	OldestDangling *DanglingAge `json:"oldest_dangling"`
+}
+
+func datasetSampleOf(record *database.PointGainRecord) DatasetSample {
+	return DatasetSample{
+		EventId:      record.EventId,
+		UserId:       record.UserId,
+		RoutePoints:  record.RoutePoints,
+		PointsBefore: record.UserPointsBefore,
+		PointsAfter:  record.UserPointsAfter,
+		EventDate:    record.EventDate,
+		Kind:         record.Kind,
+		Activity:     record.Activity,
+	}
+}
+
+// validSample mirrors the filter of database.PointGainsRepository.GetValidPointsGainEntry.
+func validSample(record *database.PointGainRecord) bool {
+	return record.UserPointsAfter != nil && record.UserPointsBefore != nil &&
+		*record.UserPointsBefore < *record.UserPointsAfter &&
+		record.Kind == database.LiveSample
+}
+
+func countCoverage(coverage map[bucketKey]*Coverage, key bucketKey, record *database.PointGainRecord) {
+	bucket, found := coverage[key]
+	if !found {
+		bucket = &Coverage{Bucket: key.bucket, start: key.start}
+		coverage[key] = bucket
+	}
+	bucket.Total++
+	if record.UserPointsAfter == nil {
+		bucket.Dangling++
+	} else {
+		bucket.Complete++
+	}
+	if validSample(record) {
+		bucket.Valid++
+	}
+}
+
+func sortedCoverage(coverage map[bucketKey]*Coverage) []Coverage {
+	buckets := []Coverage{}
+	for _, bucket := range coverage {
+		buckets = append(buckets, *bucket)
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		if buckets[i].start != buckets[j].start {
+			return buckets[i].start < buckets[j].start
+		}
+		return buckets[i].Bucket < buckets[j].Bucket
+	})
+	return buckets
+}
+
+// userJumps finds the jumps in the live samples of a user ordered by event date.
+func userJumps(timeline []database.PointGainRecord, threshold int) []PointsJump {
+	jumps := []PointsJump{}
+	var previous *database.PointGainRecord
+	for i := range timeline {
+		record := &timeline[i]
+		if record.Kind != database.LiveSample || record.UserPointsBefore == nil {
+			continue
+		}
+		if previous != nil {
+			change := *record.UserPointsBefore - *previous.UserPointsAfter
+			if change < 0 || change > threshold {
+				jumps = append(jumps, PointsJump{
+					UserId:       record.UserId,
+					FromEventId:  previous.EventId,
+					ToEventId:    record.EventId,
+					PointsAfter:  *previous.UserPointsAfter,
+					PointsBefore: *record.UserPointsBefore,
+					Change:       change,
+				})
+			}
+		}
+		if record.UserPointsAfter != nil {
+			previous = record
+		}
+	}
+	return jumps
+}
+
+/*
+AnalyzeDataset reports the health of the collected samples: how many are
+complete, which are left out of fitting, duplicated gains, unexplained jumps
+in the points of users and the coverage by event month and route points. The
+samples must be ordered by user and event date, as returned by
+database.PointGainsRepository.GetUserTimelines.
+*/
+func AnalyzeDataset(
+	records []database.PointGainRecord,
+	eventsWithoutRoutePoints []database.EventRecord,
+	jumpThreshold int,
+	now time.Time,
+) *DatasetReport {
+	if jumpThreshold <= 0 {
+		jumpThreshold = DefaultJumpThreshold
+	}
+	report := DatasetReport{
+		GeneratedAt:              now.Unix(),
+		Total:                    len(records),
+		NonIncreasing:            []DatasetSample{},
+		Duplicates:               []DuplicateGain{},
+		EventsWithoutRoutePoints: []UnpointedEvent{},
+		JumpThreshold:            jumpThreshold,
+		SuspiciousJumps:          []PointsJump{},
+	}
+
+	for _, event := range eventsWithoutRoutePoints {
+		report.EventsWithoutRoutePoints = append(report.EventsWithoutRoutePoints, UnpointedEvent{
+			EventId: event.Id, Title: event.Title, RouteId: event.RouteId, Date: event.Date.Unix(),
+		})
+	}
+
+	type gainKey struct{ userId, before, after int }
+	gains := map[gainKey][]int{}
+	gainOrder := []gainKey{}
+	months := map[bucketKey]*Coverage{}
+	routePoints := map[bucketKey]*Coverage{}
+	var oldestDangling *database.PointGainRecord
+
+	for i := range records {
+		record := &records[i]
+		if record.Kind == database.HistoricalSample {
+			report.Historical++
+		}
+		if record.UserPointsAfter == nil {
+			report.Dangling++
+			if oldestDangling == nil || record.EventDate < oldestDangling.EventDate {
+				oldestDangling = record
+			}
+		} else {
+			report.Complete++
+			if validSample(record) {
+				report.Valid++
+			} else if record.Kind == database.LiveSample {
+				report.NonIncreasing = append(report.NonIncreasing, datasetSampleOf(record))
+			}
+		}
+		if validSample(record) {
+			key := gainKey{record.UserId, *record.UserPointsBefore, *record.UserPointsAfter}
+			if _, found := gains[key]; !found {
+				gainOrder = append(gainOrder, key)
+			}
+			gains[key] = append(gains[key], record.EventId)
+		}
+
+		month := time.Unix(record.EventDate, 0).UTC().Format("2006-01")
+		countCoverage(months, bucketKey{bucket: month}, record)
+		countCoverage(routePoints, numericBucket(RoutePointsGroup, record.RoutePoints, RoutePointsBucketWidth), record)
+	}
+
+	for _, key := range gainOrder {
+		if len(gains[key]) > 1 {
+			report.Duplicates = append(report.Duplicates, DuplicateGain{
+				UserId: key.userId, PointsBefore: key.before, PointsAfter: key.after, EventIds: gains[key],
+			})
+		}
+	}
+
+	for start := 0; start < len(records); {
+		end := start
+		for end < len(records) && records[end].UserId == records[start].UserId {
+			end++
+		}
+		if jumps := userJumps(records[start:end], jumpThreshold); len(jumps) > 0 {
+			report.SuspiciousUsers++
+			report.SuspiciousJumps = append(report.SuspiciousJumps, jumps...)
+		}
+		start = end
+	}
+
+	report.ByMonth = sortedCoverage(months)
+	report.ByRoutePoints = sortedCoverage(routePoints)
+	if oldestDangling != nil {
+		report.OldestDangling = &DanglingAge{
+			DatasetSample: datasetSampleOf(oldestDangling),
+			AgeDays:       now.Sub(time.Unix(oldestDangling.EventDate, 0)).Hours() / 24,
+		}
+	}
+	return &report
+}
@@ -0,0 +1,57 @@
+package analysis
+
+import (
+	"hb-crawler/rating-gain/database"
+	"testing"
+	"time"
+)
+
+func createSample(eventId int, userId int, before int, after *int, date int64) database.PointGainRecord {
+	return database.PointGainRecord{
+		EventId:          eventId,
+		UserId:           userId,
+		RoutePoints:      120,
+		UserPointsBefore: &before,
+		UserPointsAfter:  after,
+		EventDate:        date,
+		Kind:             database.LiveSample,
+		Activity:         database.DefaultActivity,
+	}
+}
+
+func TestAnalyzeDataset(t *testing.T) {
+	points := func(value int) *int { return &value }
+	day := int64(24 * 60 * 60)
+	records := []database.PointGainRecord{
+		createSample(1, 1, 100, points(110), 1*day),
+		// same gain as event 1
+		createSample(2, 1, 100, points(110), 2*day),
+		// points dropped since event 2
+		createSample(3, 1, 90, points(90), 3*day),
+		createSample(4, 2, 500, points(520), 1*day),
+		// gained far more than the threshold outside tracked events
+		createSample(5, 2, 900, nil, 4*day),
+	}
+	now := time.Unix(6*day, 0)
+	report := AnalyzeDataset(records, []database.EventRecord{}, 200, now)
+
+	if report.Total != 5 || report.Complete != 4 || report.Dangling != 1 || report.Valid != 3 {
+		t.Errorf("got counts %+v", report)
+	}
+	if len(report.NonIncreasing) != 1 || report.NonIncreasing[0].EventId != 3 {
+		t.Errorf("got non increasing samples %+v, wanted event 3", report.NonIncreasing)
+	}
+	if len(report.Duplicates) != 1 || len(report.Duplicates[0].EventIds) != 2 {
+		t.Errorf("got duplicates %+v, wanted events 1 and 2", report.Duplicates)
+	}
+	// the duplicated gain drops the points of user 1 as well
+	if report.SuspiciousUsers != 2 || len(report.SuspiciousJumps) != 3 {
+		t.Errorf("got jumps %+v of %d users, wanted 3 jumps of 2 users", report.SuspiciousJumps, report.SuspiciousUsers)
+	}
+	if report.OldestDangling == nil || report.OldestDangling.EventId != 5 || report.OldestDangling.AgeDays != 2 {
+		t.Errorf("got oldest dangling sample %+v, wanted event 5 of 2 days", report.OldestDangling)
+	}
+	if len(report.ByMonth) != 1 || report.ByMonth[0].Total != 5 {
+		t.Errorf("got month coverage %+v", report.ByMonth)
+	}
+}
@@ -0,0 +1,435 @@
+package analysis
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"hb-crawler/rating-gain/database"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+)
+
+/*
+The hypothesis search enumerates expressions for the points gained at an event,
+i.e. points after minus points before, bottom up by size. Expressions are built
+from the sample variables and a few constants with + - * / and round, floor,
+ceil and abs. Expressions that evaluate to the same values on every search
+sample are kept only once, and the outermost rounding is tried for every
+expression as the site awards integer points.
+*/
+
+type Rounding string
+
+const (
+	RoundRounding Rounding = "round"
+	FloorRounding Rounding = "floor"
+	CeilRounding  Rounding = "ceil"
+)
+
+var roundings = []Rounding{RoundRounding, FloorRounding, CeilRounding}
+
+func (r Rounding) apply(x float64) float64 {
+	switch r {
+	case FloorRounding:
+		return math.Floor(x)
+	case CeilRounding:
+		return math.Ceil(x)
+	default:
+		return math.Round(x)
+	}
+}
+
+var hypothesisConstants = []float64{0.5, 1, 2, 3, 5, 10, 100, 400}
+
+type unaryOperator struct {
+	name  string
+	apply func(float64) float64
+}
+
+type binaryOperator struct {
+	name  string
+	apply func(float64, float64) float64
+}
+
+// slices rather than maps, as the first of several equivalent expressions is kept
+var unaryOperators = []unaryOperator{
+	{"round", math.Round},
+	{"floor", math.Floor},
+	{"ceil", math.Ceil},
+	{"abs", math.Abs},
+}
+
+var binaryOperators = []binaryOperator{
+	{"+", func(a, b float64) float64 { return a + b }},
+	{"-", func(a, b float64) float64 { return a - b }},
+	{"*", func(a, b float64) float64 { return a * b }},
+	{"/", func(a, b float64) float64 { return a / b }},
+}
+
+func findUnaryOperator(name string) func(float64) float64 {
+	for _, op := range unaryOperators {
+		if op.name == name {
+			return op.apply
+		}
+	}
+	return nil
+}
+
+func findBinaryOperator(name string) func(float64, float64) float64 {
+	for _, op := range binaryOperators {
+		if op.name == name {
+			return op.apply
+		}
+	}
+	return nil
+}
+
+func isCommutative(op string) bool {
+	return op == "+" || op == "*"
+}
+
+type expression struct {
+	op       string
+	variable *routeFeature
+	constant float64
+	operands []*expression
+	size     int
+}
+
+// eval returns NaN where a variable of the sample is unknown.
+func (e *expression) eval(record *database.ReducedPointGainRecord) float64 {
+	switch {
+	case e.variable != nil:
+		value, ok := e.variable.value(record)
+		if !ok {
+			return math.NaN()
+		}
+		return value
+	case len(e.operands) == 0:
+		return e.constant
+	case len(e.operands) == 1:
+		return findUnaryOperator(e.op)(e.operands[0].eval(record))
+	default:
+		return findBinaryOperator(e.op)(e.operands[0].eval(record), e.operands[1].eval(record))
+	}
+}
+
+func (e *expression) String() string {
+	switch {
+	case e.variable != nil:
+		return e.variable.name
+	case len(e.operands) == 0:
+		return strconv.FormatFloat(e.constant, 'f', -1, 64)
+	case len(e.operands) == 1:
+		return fmt.Sprintf("%s(%s)", e.op, e.operands[0])
+	default:
+		return fmt.Sprintf("(%s %s %s)", e.operands[0], e.op, e.operands[1])
+	}
+}
+
+// an expression together with its values on the search samples
+type candidate struct {
+	expression *expression
+	values     []float64
+	matches    int
+	rounding   Rounding
+}
+
+type HypothesisSearchParams struct {
+	// largest expression size in number of nodes
+	MaxSize int
+	// number of expressions of each size kept to build larger expressions from
+	BeamWidth int
+	// number of samples the search is run on, all samples are used for the report
+	SearchSamples int
+	Seed          int64
+	Top           int
+	// number of mismatching samples reported per hypothesis
+	Counterexamples int
+}
+
+func DefaultHypothesisSearchParams() *HypothesisSearchParams {
+	return &HypothesisSearchParams{
+		MaxSize:         5,
+		BeamWidth:       1000,
+		SearchSamples:   1000,
+		Top:             10,
+		Counterexamples: 5,
+	}
+}
+
+type Counterexample struct {
+	Sample    database.ReducedPointGainRecord `json:"sample"`
+	Gain      int                             `json:"gain"`
+	Predicted float64                         `json:"predicted"`
+}
+
+type Hypothesis struct {
+	// the expression of the gain, wrapped into its rounding
+	Formula         string           `json:"formula"`
+	Size            int              `json:"size"`
+	Matches         int              `json:"matches"`
+	Total           int              `json:"total"`
+	Accuracy        float64          `json:"accuracy"`
+	Counterexamples []Counterexample `json:"counterexamples"`
+}
+
+func gainOf(record *database.ReducedPointGainRecord) float64 {
+	return float64(record.UserPointsAfter - record.UserPointsBefore)
+}
+
+// hypothesisVariables returns the variables known for at least one sample.
+func hypothesisVariables(pointGains []database.ReducedPointGainRecord) []routeFeature {
+	variables := []routeFeature{}
+	for _, feature := range append([]routeFeature{routePointsFeature}, routeMetricFeatures...) {
+		for i := range pointGains {
+			if _, ok := feature.value(&pointGains[i]); ok {
+				variables = append(variables, feature)
+				break
+			}
+		}
+	}
+	return variables
+}
+
+// score sets the rounding that reproduces the most gains and the number of reproduced gains.
+func (c *candidate) score(gains []float64) {
+	c.matches = -1
+	for _, rounding := range roundings {
+		matches := 0
+		for i, value := range c.values {
+			if rounding.apply(value) == gains[i] {
+				matches++
+			}
+		}
+		if matches > c.matches {
+			c.matches, c.rounding = matches, rounding
+		}
+	}
+}
+
+// valuesKey hashes the values rounded to 9 decimals, so that float noise does not keep equivalent expressions apart.
+func valuesKey(values []float64) uint64 {
+	hash := fnv.New64a()
+	buffer := make([]byte, 8)
+	for _, value := range values {
+		binary.LittleEndian.PutUint64(buffer, math.Float64bits(math.Round(value*1e9)/1e9))
+		hash.Write(buffer)
+	}
+	return hash.Sum64()
+}
+
+type hypothesisSearch struct {
+	samples []database.ReducedPointGainRecord
+	gains   []float64
+	seen    map[uint64]bool
+	// candidates by expression size
+	bySize [][]*candidate
+	params *HypothesisSearchParams
+}
+
+// add keeps the expression unless an equivalent one has been seen.
+func (s *hypothesisSearch) add(level *[]*candidate, e *expression, values []float64) {
+	key := valuesKey(values)
+	if s.seen[key] {
+		return
+	}
+	s.seen[key] = true
+	c := &candidate{expression: e, values: values}
+	c.score(s.gains)
+	*level = append(*level, c)
+	// bounds the memory held by the values of discarded candidates
+	if len(*level) >= 2*s.params.BeamWidth {
+		*level = s.prune(*level)
+	}
+}
+
+// prune keeps the most promising expressions to build on.
+func (s *hypothesisSearch) prune(level []*candidate) []*candidate {
+	sort.SliceStable(level, func(i, j int) bool {
+		return level[i].matches > level[j].matches
+	})
+	if len(level) > s.params.BeamWidth {
+		level = level[:s.params.BeamWidth]
+	}
+	return level
+}
+
+func (s *hypothesisSearch) expand(size int) []*candidate {
+	level := []*candidate{}
+	for _, op := range unaryOperators {
+		for _, operand := range s.bySize[size-1] {
+			values := make([]float64, len(operand.values))
+			for i, value := range operand.values {
+				values[i] = op.apply(value)
+			}
+			s.add(&level, &expression{op: op.name, operands: []*expression{operand.expression}, size: size}, values)
+		}
+	}
+	for _, op := range binaryOperators {
+		commutative := isCommutative(op.name)
+		for leftSize := 1; leftSize < size-1; leftSize++ {
+			rightSize := size - 1 - leftSize
+			if commutative && leftSize > rightSize {
+				continue
+			}
+			for i, left := range s.bySize[leftSize] {
+				for j, right := range s.bySize[rightSize] {
+					if commutative && leftSize == rightSize && j < i {
+						continue
+					}
+					values := make([]float64, len(left.values))
+					for k := range values {
+						values[k] = op.apply(left.values[k], right.values[k])
+					}
+					s.add(&level, &expression{
+						op: op.name, operands: []*expression{left.expression, right.expression}, size: size,
+					}, values)
+				}
+			}
+		}
+	}
+	return s.prune(level)
+}
+
+func (s *hypothesisSearch) terminals(variables []routeFeature) []*candidate {
+	level := []*candidate{}
+	for i := range variables {
+		e := &expression{variable: &variables[i], size: 1}
+		values := make([]float64, len(s.samples))
+		for k := range s.samples {
+			values[k] = e.eval(&s.samples[k])
+		}
+		s.add(&level, e, values)
+	}
+	for _, constant := range hypothesisConstants {
+		values := make([]float64, len(s.samples))
+		for k := range values {
+			values[k] = constant
+		}
+		s.add(&level, &expression{constant: constant, size: 1}, values)
+	}
+	return level
+}
+
+func sampleRecords(pointGains []database.ReducedPointGainRecord, count int, seed int64) []database.ReducedPointGainRecord {
+	if count <= 0 || count >= len(pointGains) {
+		return pointGains
+	}
+	random := rand.New(rand.NewSource(seed))
+	samples := []database.ReducedPointGainRecord{}
+	for _, index := range random.Perm(len(pointGains))[:count] {
+		samples = append(samples, pointGains[index])
+	}
+	return samples
+}
+
+func createHypothesis(
+	c *candidate,
+	pointGains []database.ReducedPointGainRecord,
+	counterexamples int,
+) Hypothesis {
+	hypothesis := Hypothesis{
+		Formula:         fmt.Sprintf("%s(%s)", c.rounding, c.expression),
+		Size:            c.expression.size,
+		Total:           len(pointGains),
+		Counterexamples: []Counterexample{},
+	}
+	for i := range pointGains {
+		record := &pointGains[i]
+		predicted := c.rounding.apply(c.expression.eval(record))
+		if predicted == gainOf(record) {
+			hypothesis.Matches++
+			continue
+		}
+		if len(hypothesis.Counterexamples) < counterexamples {
+			// NaN cannot be encoded as JSON
+			if math.IsNaN(predicted) || math.IsInf(predicted, 0) {
+				predicted = 0
+			}
+			hypothesis.Counterexamples = append(hypothesis.Counterexamples, Counterexample{
+				Sample:    *record,
+				Gain:      int(gainOf(record)),
+				Predicted: predicted,
+			})
+		}
+	}
+	if hypothesis.Total > 0 {
+		hypothesis.Accuracy = float64(hypothesis.Matches) / float64(hypothesis.Total)
+	}
+	return hypothesis
+}
+
+/*
+SearchHypotheses enumerates gain formulas on a subset of the samples and
+returns the best ones ranked by the number of samples they reproduce exactly,
+with smaller formulas first among equally good ones.
+*/
+func SearchHypotheses(
+	pointGains []database.ReducedPointGainRecord,
+	params *HypothesisSearchParams,
+) ([]Hypothesis, error) {
+	if params == nil {
+		params = DefaultHypothesisSearchParams()
+	}
+	if len(pointGains) == 0 {
+		return nil, fmt.Errorf("no samples to search hypotheses on")
+	}
+	if params.MaxSize < 1 {
+		return nil, fmt.Errorf("max size must be positive")
+	}
+
+	samples := sampleRecords(pointGains, params.SearchSamples, params.Seed)
+	search := hypothesisSearch{
+		samples: samples,
+		gains:   make([]float64, len(samples)),
+		seen:    map[uint64]bool{},
+		bySize:  make([][]*candidate, params.MaxSize+1),
+		params:  params,
+	}
+	for i := range samples {
+		search.gains[i] = gainOf(&samples[i])
+	}
+
+	search.bySize[1] = search.terminals(hypothesisVariables(pointGains))
+	for size := 2; size <= params.MaxSize; size++ {
+		search.bySize[size] = search.expand(size)
+	}
+
+	candidates := []*candidate{}
+	for _, level := range search.bySize {
+		candidates = append(candidates, level...)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].matches != candidates[j].matches {
+			return candidates[i].matches > candidates[j].matches
+		}
+		return candidates[i].expression.size < candidates[j].expression.size
+	})
+
+	// e.g. round(x) and round(round(x)) are different expressions of the same formula
+	hypotheses := []Hypothesis{}
+	reported := map[uint64]bool{}
+	for _, c := range candidates {
+		if len(hypotheses) >= params.Top {
+			break
+		}
+		rounded := make([]float64, len(c.values))
+		for i, value := range c.values {
+			rounded[i] = c.rounding.apply(value)
+		}
+		if key := valuesKey(rounded); !reported[key] {
+			reported[key] = true
+			hypotheses = append(hypotheses, createHypothesis(c, pointGains, params.Counterexamples))
+		}
+	}
+	sort.SliceStable(hypotheses, func(i, j int) bool {
+		if hypotheses[i].Matches != hypotheses[j].Matches {
+			return hypotheses[i].Matches > hypotheses[j].Matches
+		}
+		return hypotheses[i].Size < hypotheses[j].Size
+	})
+	return hypotheses, nil
+}
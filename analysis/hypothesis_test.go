@@ -0,0 +1,31 @@
+package analysis
+
+import (
+	"hb-crawler/rating-gain/database"
+	"testing"
+)
+
+func TestSearchHypothesesFindsExactFormula(t *testing.T) {
+	records := []database.ReducedPointGainRecord{}
+	for route := 50; route < 400; route += 7 {
+		for before := 0; before < 300; before += 45 {
+			records = append(records, database.ReducedPointGainRecord{
+				RoutePoints:      route,
+				UserPointsBefore: before,
+				UserPointsAfter:  before + (route+5)/10,
+			})
+		}
+	}
+
+	params := DefaultHypothesisSearchParams()
+	params.MaxSize = 3
+	params.Top = 3
+	hypotheses, err := SearchHypotheses(records, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	best := hypotheses[0]
+	if best.Matches != len(records) || len(best.Counterexamples) != 0 {
+		t.Errorf("best hypothesis %s reproduces %d of %d gains", best.Formula, best.Matches, len(records))
+	}
+}
@@ -0,0 +1,136 @@
+package analysis
+
+import (
+	"fmt"
+	"math"
+
+	"gonum.org/v1/gonum/optimize"
+)
+
+type LossFunction string
+
+const (
+	MAELoss   LossFunction = "mae"
+	MSELoss   LossFunction = "mse"
+	HuberLoss LossFunction = "huber"
+	// share of samples whose rounded estimation misses the awarded points, as the site awards integers
+	ExactMatchLoss LossFunction = "exact"
+)
+
+type OptimizeMethod string
+
+const (
+	NelderMeadMethod OptimizeMethod = "nelder-mead"
+	// BFGS using numeric gradients of the loss
+	BFGSMethod  OptimizeMethod = "bfgs"
+	CMAESMethod OptimizeMethod = "cmaes"
+
+	DefaultHuberDelta = 5.0
+	DefaultConfidence = 0.95
+)
+
+// IterationLimit caps the major iterations clients may ask the optimizer for.
+const IterationLimit = 100000
+
+type OptimizeOptions struct {
+	Loss LossFunction `json:"loss"`
+	// residual size where the huber loss switches from quadratic to linear
+	HuberDelta float64 `json:"huber_delta"`
+	// weight of the L2 penalty on all params but the Elo base
+	L2     float64        `json:"l2"`
+	Method OptimizeMethod `json:"method"`
+	// maximum number of major iterations, 0 means no limit, requests may ask for at most IterationLimit
+	MaxIterations int `json:"max_iterations"`
+	// names of params kept at their initial values, see ParamNames
+	Frozen []string `json:"frozen"`
+	// number of refits on resampled samples to estimate the param uncertainty, 0 disables the bootstrap
+	Bootstrap     int   `json:"bootstrap"`
+	BootstrapSeed int64 `json:"bootstrap_seed"`
+	// coverage of the bootstrap percentile intervals
+	Confidence float64 `json:"confidence"`
+}
+
+func DefaultOptimizeOptions() *OptimizeOptions {
+	return &OptimizeOptions{
+		Loss:       MAELoss,
+		HuberDelta: DefaultHuberDelta,
+		Method:     NelderMeadMethod,
+		Confidence: DefaultConfidence,
+	}
+}
+
+func ParseLossFunction(loss string) (LossFunction, error) {
+	switch LossFunction(loss) {
+	case MAELoss, MSELoss, HuberLoss, ExactMatchLoss:
+		return LossFunction(loss), nil
+	}
+	return "", fmt.Errorf("unknown loss function %s", loss)
+}
+
+func ParseOptimizeMethod(method string) (OptimizeMethod, error) {
+	switch OptimizeMethod(method) {
+	case NelderMeadMethod, BFGSMethod, CMAESMethod:
+		return OptimizeMethod(method), nil
+	}
+	return "", fmt.Errorf("unknown optimize method %s", method)
+}
+
+// withoutBootstrap returns the options for fits whose uncertainty is not reported.
+func (options *OptimizeOptions) withoutBootstrap() *OptimizeOptions {
+	if options == nil || options.Bootstrap == 0 {
+		return options
+	}
+	copied := *options
+	copied.Bootstrap = 0
+	return &copied
+}
+
+// residualLoss returns the loss of a single sample given estimated minus actual points.
+func (options *OptimizeOptions) residualLoss(diff float64) float64 {
+	switch options.Loss {
+	case MSELoss:
+		return diff * diff
+	case HuberLoss:
+		delta := options.HuberDelta
+		if delta <= 0 {
+			delta = DefaultHuberDelta
+		}
+		if math.Abs(diff) <= delta {
+			return diff * diff / 2
+		}
+		return delta * (math.Abs(diff) - delta/2)
+	case ExactMatchLoss:
+		if math.Round(diff) != 0 {
+			return 1
+		}
+		return 0
+	default:
+		return math.Abs(diff)
+	}
+}
+
+// penalty returns the L2 regularization term, leaving out the Elo base.
+func (options *OptimizeOptions) penalty(params []float64, names []string) float64 {
+	if options.L2 == 0 {
+		return 0
+	}
+	sum := float64(0)
+	for i, p := range params {
+		if names[i] == BaseParam {
+			continue
+		}
+		sum += p * p
+	}
+	return options.L2 * sum
+}
+
+func (options *OptimizeOptions) method() optimize.Method {
+	switch options.Method {
+	case BFGSMethod:
+		return &optimize.BFGS{}
+	case CMAESMethod:
+		return &optimize.CmaEsChol{}
+	default:
+		return &optimize.NelderMead{}
+	}
+}
@@ -0,0 +1,297 @@
+package analysis
+
+import (
+	"context"
+	"fmt"
+	"hb-crawler/rating-gain/database"
+	"math"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+	"gonum.org/v1/gonum/diff/fd"
+	"gonum.org/v1/gonum/optimize"
+)
+
+type Bound struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+var unbounded = Bound{Min: math.Inf(-1), Max: math.Inf(1)}
+
+func (b Bound) clamp(x float64) float64 {
+	return math.Max(b.Min, math.Min(b.Max, x))
+}
+
+// Model is a family of point gain models whose params can be fitted to samples.
+type Model interface {
+	Name() string
+	// ParamNames names the entries of the param vectors the model accepts
+	ParamNames() []string
+	DefaultParams() []float64
+	Bounds() []Bound
+	// Predict estimates the points of the participant after the event
+	Predict(params []float64, record *database.ReducedPointGainRecord) float64
+}
+
+const DefaultModelName = EloModelName
+
+var modelFactories = map[string]func() Model{
+	EloModelName:           func() Model { return &EloModel{Degree: 1} },
+	LinearModelName:        func() Model { return &LinearModel{} },
+	PiecewiseModelName:     func() Model { return &PiecewiseScaleModel{} },
+	LookupModelName:        func() Model { return &LookupTableModel{} },
+	RouteFeaturesModelName: func() Model { return &RouteFeatureModel{UseRoutePoints: true} },
+	RouteMetricsModelName:  func() Model { return &RouteFeatureModel{} },
+}
+
+func ModelNames() []string {
+	names := []string{}
+	for name := range modelFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func CreateModel(name string) (Model, error) {
+	factory, found := modelFactories[name]
+	if !found {
+		return nil, fmt.Errorf("unknown model %s", name)
+	}
+	return factory(), nil
+}
+
+// FittedModel is a model together with the params it predicts with.
+type FittedModel struct {
+	Model  Model
+	Params []float64
+}
+
+func CreateDefaultFittedModel(model Model) *FittedModel {
+	return &FittedModel{Model: model, Params: model.DefaultParams()}
+}
+
+func (m *FittedModel) Predict(record *database.ReducedPointGainRecord) float64 {
+	return m.Model.Predict(m.Params, record)
+}
+
+/*
+Splits the parameter vector into the indices the optimizer may change and
+returns a function expanding a vector of free params back to the full layout,
+with frozen params kept at their initial values and every param clamped into
+its bounds.
+*/
+func freeParams(
+	initialParams []float64,
+	names []string,
+	bounds []Bound,
+	frozen []string,
+) ([]int, func(x []float64) []float64, error) {
+	isFrozen := map[string]bool{}
+	for _, name := range frozen {
+		isFrozen[name] = true
+	}
+	free := []int{}
+	for i, name := range names {
+		if isFrozen[name] {
+			delete(isFrozen, name)
+			continue
+		}
+		free = append(free, i)
+	}
+	for name := range isFrozen {
+		return nil, nil, fmt.Errorf("unknown param %s", name)
+	}
+	if len(free) == 0 {
+		return nil, nil, fmt.Errorf("all params are frozen")
+	}
+
+	expand := func(x []float64) []float64 {
+		params := append([]float64{}, initialParams...)
+		for i, index := range free {
+			params[index] = bounds[index].clamp(x[i])
+		}
+		return params
+	}
+	return free, expand, nil
+}
+
+func createOptimizerProblem(
+	pointGains []database.ReducedPointGainRecord,
+	model Model,
+	options *OptimizeOptions,
+	expand func(x []float64) []float64,
+) *optimize.Problem {
+	names := model.ParamNames()
+	lossFunc := func(x []float64) float64 {
+		params := expand(x)
+		loss := float64(0)
+		for i := range pointGains {
+			estimated := model.Predict(params, &pointGains[i])
+			diff := estimated - float64(pointGains[i].UserPointsAfter)
+			loss += options.residualLoss(diff)
+		}
+		loss = loss / float64(len(pointGains))
+		return loss + options.penalty(params, names)
+	}
+
+	problem := optimize.Problem{
+		Func: lossFunc,
+	}
+	if options.Method == BFGSMethod {
+		problem.Grad = func(grad []float64, x []float64) {
+			fd.Gradient(grad, lossFunc, x, nil)
+		}
+	}
+	return &problem
+}
+
+type OptimizeResult struct {
+	Model         string          `json:"model"`
+	ParamNames    []string        `json:"param_names"`
+	InitialParams []float64       `json:"initial_params"`
+	InitialLoss   float64         `json:"initial_loss"`
+	Params        []float64       `json:"params"`
+	Loss          float64         `json:"loss"`
+	Options       OptimizeOptions `json:"options"`
+	Iterations    int             `json:"iterations"`
+	Status        string          `json:"status"`
+	// spread of the params over bootstrap refits, nil unless options.Bootstrap is set
+	Uncertainty *BootstrapSummary `json:"uncertainty,omitempty"`
+}
+
+func (result *OptimizeResult) FittedModel(model Model) *FittedModel {
+	return &FittedModel{Model: model, Params: result.Params}
+}
+
+const (
+	FitStage       = "fit"
+	BootstrapStage = "bootstrap"
+)
+
+// Progress of a running optimization.
+type Progress struct {
+	Stage       string  `json:"stage"`
+	Iteration   int     `json:"iteration"`
+	Loss        float64 `json:"loss"`
+	Evaluations int     `json:"evaluations"`
+	// refits of the bootstrap stage that have finished
+	Resamples int `json:"resamples"`
+	// fits of a validation or comparison that have finished
+	Fits int `json:"fits"`
+}
+
+// progressRecorder reports major iterations and stops the optimizer once the context is done.
+type progressRecorder struct {
+	ctx      context.Context
+	progress func(Progress)
+}
+
+func (r *progressRecorder) Init() error {
+	return nil
+}
+
+func (r *progressRecorder) Record(location *optimize.Location, op optimize.Operation, stats *optimize.Stats) error {
+	if err := r.ctx.Err(); err != nil {
+		return err
+	}
+	if op == optimize.MajorIteration && r.progress != nil {
+		r.progress(Progress{
+			Stage:       FitStage,
+			Iteration:   stats.MajorIterations,
+			Loss:        location.F,
+			Evaluations: stats.FuncEvaluations,
+		})
+	}
+	return nil
+}
+
+// OptimizeEstimator fits the params of the model to the samples starting from
+// the initial params, using the default options if none are given.
+func OptimizeEstimator(
+	pointGains []database.ReducedPointGainRecord,
+	initial *FittedModel,
+	options *OptimizeOptions,
+) (*OptimizeResult, error) {
+	return OptimizeEstimatorContext(context.Background(), pointGains, initial, options, nil)
+}
+
+/*
+OptimizeEstimatorContext is OptimizeEstimator reporting its progress after
+every major iteration, if progress is not nil, and giving up once ctx is done.
+*/
+func OptimizeEstimatorContext(
+	ctx context.Context,
+	pointGains []database.ReducedPointGainRecord,
+	initial *FittedModel,
+	options *OptimizeOptions,
+	progress func(Progress),
+) (*OptimizeResult, error) {
+	if options == nil {
+		options = DefaultOptimizeOptions()
+	}
+	if len(pointGains) == 0 {
+		return nil, fmt.Errorf("no samples to optimize on")
+	}
+	model := initial.Model
+	initialParams := initial.Params
+	if len(initialParams) != len(model.ParamNames()) {
+		return nil, fmt.Errorf(
+			"model %s expects %d params, got %d",
+			model.Name(), len(model.ParamNames()), len(initialParams),
+		)
+	}
+	free, expand, err := freeParams(initialParams, model.ParamNames(), model.Bounds(), options.Frozen)
+	if err != nil {
+		return nil, err
+	}
+	initialFreeParams := []float64{}
+	for _, index := range free {
+		initialFreeParams = append(initialFreeParams, initialParams[index])
+	}
+
+	problem := createOptimizerProblem(pointGains, model, options, expand)
+	initialLoss := problem.Func(initialFreeParams)
+	result, err := optimize.Minimize(
+		*problem, initialFreeParams,
+		&optimize.Settings{
+			Concurrent:      4,
+			MajorIterations: options.MaxIterations,
+			Recorder:        &progressRecorder{ctx: ctx, progress: progress},
+		},
+		options.method(),
+	)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil && (result == nil || math.IsNaN(result.F) || result.F > initialLoss) {
+		logrus.Errorf("failed to optimize estimator: %+v\n", err)
+		return nil, err
+	}
+	status := result.Status.String()
+	if err != nil {
+		// e.g. line searches failing to converge still leave an improved location behind
+		logrus.Warnf("optimizer stopped early: %+v\n", err)
+		status = err.Error()
+	}
+	optimizeResult := OptimizeResult{
+		Model:         model.Name(),
+		ParamNames:    model.ParamNames(),
+		InitialParams: initialParams,
+		Params:        expand(result.X),
+		InitialLoss:   initialLoss,
+		Loss:          result.F,
+		Options:       *options,
+		Iterations:    result.Stats.MajorIterations,
+		Status:        status,
+	}
+	if options.Bootstrap > 0 {
+		uncertainty, err := Bootstrap(ctx, pointGains, model, &optimizeResult, options, progress)
+		if err != nil {
+			return nil, err
+		}
+		optimizeResult.Uncertainty = uncertainty
+	}
+	return &optimizeResult, nil
+}
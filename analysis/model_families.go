@@ -0,0 +1,296 @@
+package analysis
+
+import (
+	"fmt"
+	"hb-crawler/rating-gain/database"
+	"math"
+	"strings"
+)
+
+const (
+	EloModelName       = "elo"
+	LinearModelName    = "linear"
+	PiecewiseModelName = "piecewise-sac"
+	LookupModelName    = "lookup"
+)
+
+/*
+EloModel is the polynomial + Elo-style rate factor model of PointGainEstimator
+with polynomial coefficients up to the given degree.
+*/
+type EloModel struct {
+	Degree int
+}
+
+func (m *EloModel) Name() string {
+	return EloModelName
+}
+
+func (m *EloModel) ParamNames() []string {
+	return ParamNames(m.Degree)
+}
+
+// DefaultParams starts from k1 = InitialM, k0 = InitialL and base = 400, without the A*d^B term.
+func (m *EloModel) DefaultParams() []float64 {
+	params := make([]float64, m.Degree+1+nonPolynomialParams)
+	params[m.Degree] = InitialL
+	if m.Degree >= 1 {
+		params[m.Degree-1] = InitialM
+	}
+	params[len(params)-1] = 400
+	return params
+}
+
+func (m *EloModel) Bounds() []Bound {
+	bounds := []Bound{}
+	for i := 0; i <= m.Degree; i++ {
+		bounds = append(bounds, unbounded)
+	}
+	return append(bounds,
+		unbounded,                       // A
+		Bound{Min: -3, Max: 3},          // B, keeps d^B finite
+		Bound{Min: 1, Max: math.Inf(1)}, // base
+	)
+}
+
+func (m *EloModel) Predict(params []float64, record *database.ReducedPointGainRecord) float64 {
+	n := len(params) - nonPolynomialParams
+	estimator := PointGainEstimator{
+		params:         params[:n],
+		exponentFactor: params[n],
+		exponent:       params[n+1],
+		base:           params[n+2],
+	}
+	return estimator.EstimatePointGain(int32(record.UserPointsBefore), int32(record.RoutePoints))
+}
+
+// LinearModel predicts the gain as a linear combination of the route points and the points before.
+type LinearModel struct{}
+
+func (m *LinearModel) Name() string {
+	return LinearModelName
+}
+
+func (m *LinearModel) ParamNames() []string {
+	return []string{"intercept", "route_points", "points_before"}
+}
+
+func (m *LinearModel) DefaultParams() []float64 {
+	return []float64{10, 0, 0}
+}
+
+func (m *LinearModel) Bounds() []Bound {
+	return []Bound{unbounded, unbounded, unbounded}
+}
+
+func (m *LinearModel) Predict(params []float64, record *database.ReducedPointGainRecord) float64 {
+	before := float64(record.UserPointsBefore)
+	return before + params[0] + params[1]*float64(record.RoutePoints) + params[2]*before
+}
+
+var sacScales = []string{"T1", "T2", "T3", "T4", "T5", "T6"}
+
+const unknownScale = "unknown"
+
+// scaleIndex maps the SAC scale of a record to its segment, with unknown scales in the last segment.
+func scaleIndex(scale *string) int {
+	if scale != nil {
+		normalized := strings.ToUpper(strings.TrimSpace(*scale))
+		for i, known := range sacScales {
+			if strings.HasPrefix(normalized, known) {
+				return i
+			}
+		}
+	}
+	return len(sacScales)
+}
+
+/*
+PiecewiseScaleModel fits a separate linear gain over the route points for every
+SAC scale, plus one segment for samples whose route scale is unknown.
+*/
+type PiecewiseScaleModel struct{}
+
+func (m *PiecewiseScaleModel) Name() string {
+	return PiecewiseModelName
+}
+
+func (m *PiecewiseScaleModel) ParamNames() []string {
+	names := []string{}
+	for _, scale := range append(append([]string{}, sacScales...), unknownScale) {
+		names = append(names, scale+"_intercept", scale+"_route_points")
+	}
+	return names
+}
+
+func (m *PiecewiseScaleModel) DefaultParams() []float64 {
+	params := []float64{}
+	for i := 0; i <= len(sacScales); i++ {
+		params = append(params, 10, 0)
+	}
+	return params
+}
+
+func (m *PiecewiseScaleModel) Bounds() []Bound {
+	bounds := []Bound{}
+	for range m.ParamNames() {
+		bounds = append(bounds, unbounded)
+	}
+	return bounds
+}
+
+func (m *PiecewiseScaleModel) Predict(params []float64, record *database.ReducedPointGainRecord) float64 {
+	segment := scaleIndex(record.Scale)
+	intercept, slope := params[2*segment], params[2*segment+1]
+	return float64(record.UserPointsBefore) + intercept + slope*float64(record.RoutePoints)
+}
+
+// edges of the route points minus points before buckets of the lookup table
+var lookupEdges = []int{-400, -300, -200, -100, 0, 100, 200, 300, 400}
+
+/*
+LookupTableModel predicts a constant gain per bucket of the difference between
+route points and points before.
+*/
+type LookupTableModel struct{}
+
+func (m *LookupTableModel) Name() string {
+	return LookupModelName
+}
+
+func (m *LookupTableModel) ParamNames() []string {
+	names := []string{fmt.Sprintf("d<%d", lookupEdges[0])}
+	for i := 1; i < len(lookupEdges); i++ {
+		names = append(names, fmt.Sprintf("%d<=d<%d", lookupEdges[i-1], lookupEdges[i]))
+	}
+	return append(names, fmt.Sprintf("d>=%d", lookupEdges[len(lookupEdges)-1]))
+}
+
+func (m *LookupTableModel) DefaultParams() []float64 {
+	params := []float64{}
+	for range m.ParamNames() {
+		params = append(params, 10)
+	}
+	return params
+}
+
+func (m *LookupTableModel) Bounds() []Bound {
+	bounds := []Bound{}
+	for range m.ParamNames() {
+		bounds = append(bounds, unbounded)
+	}
+	return bounds
+}
+
+func (m *LookupTableModel) Predict(params []float64, record *database.ReducedPointGainRecord) float64 {
+	d := record.RoutePoints - record.UserPointsBefore
+	bucket := 0
+	for bucket < len(lookupEdges) && d >= lookupEdges[bucket] {
+		bucket++
+	}
+	return float64(record.UserPointsBefore) + params[bucket]
+}
+
+const (
+	RouteFeaturesModelName = "route-features"
+	RouteMetricsModelName  = "route-metrics"
+)
+
+// a feature of a sample, ok is false if the sample lacks it
+type routeFeature struct {
+	name string
+	// divides the raw value so that the fitted weights are of similar magnitude
+	scale float64
+	value func(record *database.ReducedPointGainRecord) (value float64, ok bool)
+}
+
+func optionalFeature(value func(route *database.RouteFeatures) *float64) func(*database.ReducedPointGainRecord) (float64, bool) {
+	return func(record *database.ReducedPointGainRecord) (float64, bool) {
+		if v := value(&record.Route); v != nil {
+			return *v, true
+		}
+		return 0, false
+	}
+}
+
+var routePointsFeature = routeFeature{
+	name:  "route_points",
+	scale: 100,
+	value: func(record *database.ReducedPointGainRecord) (float64, bool) {
+		return float64(record.RoutePoints), true
+	},
+}
+
+var routeMetricFeatures = []routeFeature{
+	{"points_before", 100, func(record *database.ReducedPointGainRecord) (float64, bool) {
+		return float64(record.UserPointsBefore), true
+	}},
+	{"elevation", 100, optionalFeature(func(r *database.RouteFeatures) *float64 { return r.Elevation })},
+	{"distance", 1, optionalFeature(func(r *database.RouteFeatures) *float64 { return r.Distance })},
+	{"elevation_gain", 100, optionalFeature(func(r *database.RouteFeatures) *float64 { return r.ElevationGain })},
+	{"elevation_loss", 100, optionalFeature(func(r *database.RouteFeatures) *float64 { return r.ElevationLoss })},
+	{"t1_distance", 1, optionalFeature(func(r *database.RouteFeatures) *float64 { return r.T1Distance })},
+	{"t2_distance", 1, optionalFeature(func(r *database.RouteFeatures) *float64 { return r.T2Distance })},
+	{"t3_distance", 1, optionalFeature(func(r *database.RouteFeatures) *float64 { return r.T3Distance })},
+	{"t4_distance", 1, optionalFeature(func(r *database.RouteFeatures) *float64 { return r.T4Distance })},
+	{"t5_distance", 1, optionalFeature(func(r *database.RouteFeatures) *float64 { return r.T5Distance })},
+	{"t6_distance", 1, optionalFeature(func(r *database.RouteFeatures) *float64 { return r.T6Distance })},
+}
+
+/*
+RouteFeatureModel predicts the gain as a linear combination of the raw route
+metrics joined from the routes table, with or without the route points the
+site shows. Comparing both variants tells whether the route points alone
+explain the gains. Missing metrics contribute nothing to the gain.
+
+Points and elevations are weighted per 100, distances per unit.
+*/
+type RouteFeatureModel struct {
+	UseRoutePoints bool
+}
+
+func (m *RouteFeatureModel) features() []routeFeature {
+	if m.UseRoutePoints {
+		return append([]routeFeature{routePointsFeature}, routeMetricFeatures...)
+	}
+	return routeMetricFeatures
+}
+
+func (m *RouteFeatureModel) Name() string {
+	if m.UseRoutePoints {
+		return RouteFeaturesModelName
+	}
+	return RouteMetricsModelName
+}
+
+func (m *RouteFeatureModel) ParamNames() []string {
+	names := []string{"intercept"}
+	for _, feature := range m.features() {
+		names = append(names, feature.name)
+	}
+	return names
+}
+
+func (m *RouteFeatureModel) DefaultParams() []float64 {
+	params := make([]float64, len(m.features())+1)
+	params[0] = 10
+	return params
+}
+
+func (m *RouteFeatureModel) Bounds() []Bound {
+	bounds := []Bound{}
+	for range m.ParamNames() {
+		bounds = append(bounds, unbounded)
+	}
+	return bounds
+}
+
+func (m *RouteFeatureModel) Predict(params []float64, record *database.ReducedPointGainRecord) float64 {
+	gain := params[0]
+	for i, feature := range m.features() {
+		if value, ok := feature.value(record); ok {
+			gain += params[i+1] * value / feature.scale
+		}
+	}
+	return float64(record.UserPointsBefore) + gain
+}
@@ -0,0 +1,37 @@
+package analysis
+
+import (
+	"hb-crawler/rating-gain/database"
+	"testing"
+)
+
+func TestModelLayoutsAgree(t *testing.T) {
+	for _, name := range ModelNames() {
+		model, err := CreateModel(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names, params, bounds := model.ParamNames(), model.DefaultParams(), model.Bounds()
+		if len(names) != len(params) || len(names) != len(bounds) {
+			t.Errorf("%s has %d names, %d params and %d bounds", name, len(names), len(params), len(bounds))
+		}
+		record := database.ReducedPointGainRecord{RoutePoints: 120, UserPointsBefore: 100}
+		if estimated := model.Predict(params, &record); estimated < 100 {
+			t.Errorf("%s estimates %f points after starting from 100", name, estimated)
+		}
+	}
+}
+
+func TestCreateModelRecordStoresMetrics(t *testing.T) {
+	elo, _ := CreateModel(EloModelName)
+	fitted := CreateDefaultFittedModel(elo)
+	records := []database.ReducedPointGainRecord{
+		{RoutePoints: 120, UserPointsBefore: 100, UserPointsAfter: 150},
+		{RoutePoints: 300, UserPointsBefore: 400, UserPointsAfter: 420},
+	}
+	metrics := Evaluate(fitted, records)
+	record := CreateModelRecord(&OptimizeResult{Model: EloModelName, Params: fitted.Params}, Fingerprint(records), metrics)
+	if record.Metrics["count"] != 2 || record.Metrics["mae"] != metrics.MAE || record.Metrics["rmse"] != metrics.RMSE || record.Metrics["bias"] != metrics.Bias {
+		t.Errorf("stored metrics %v, expected %+v", record.Metrics, metrics)
+	}
+}
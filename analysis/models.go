@@ -0,0 +1,135 @@
+package analysis
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hb-crawler/rating-gain/database"
+	"sort"
+)
+
+/*
+Fingerprint identifies a training set independent of the order of its records,
+so that models fitted on the same samples share the same fingerprint.
+*/
+func Fingerprint(pointGains []database.ReducedPointGainRecord) string {
+	lines := make([]string, 0, len(pointGains))
+	for _, record := range pointGains {
+		lines = append(lines, fmt.Sprintf(
+			"%d,%d,%d", record.RoutePoints, record.UserPointsBefore, record.UserPointsAfter,
+		))
+	}
+	sort.Strings(lines)
+
+	hash := sha256.New()
+	for _, line := range lines {
+		hash.Write([]byte(line))
+		hash.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// CreateModelRecord stores the result with the metrics of the fitted model on its training samples.
+func CreateModelRecord(result *OptimizeResult, fingerprint string, metrics Metrics) *database.ModelRecord {
+	return &database.ModelRecord{
+		Type:        result.Model,
+		Params:      result.Params,
+		Fingerprint: fingerprint,
+		InitialLoss: result.InitialLoss,
+		Loss:        result.Loss,
+		Metrics: map[string]float64{
+			"count": float64(metrics.Count),
+			"mae":   metrics.MAE,
+			"rmse":  metrics.RMSE,
+			"bias":  metrics.Bias,
+		},
+	}
+}
+
+// LoadModel restores the fitted model of a stored model record.
+func LoadModel(record *database.ModelRecord) (*FittedModel, error) {
+	params := record.Params
+	var model Model
+	switch record.Type {
+	case EloModelName:
+		model = &EloModel{Degree: len(params) - nonPolynomialParams - 1}
+	default:
+		created, err := CreateModel(record.Type)
+		if err != nil {
+			return nil, err
+		}
+		model = created
+	}
+
+	if len(params) != len(model.ParamNames()) {
+		return nil, fmt.Errorf(
+			"model %d of type %s has %d params, expected %d",
+			record.Id, record.Type, len(params), len(model.ParamNames()),
+		)
+	}
+	return &FittedModel{Model: model, Params: params}, nil
+}
+
+// ModelParamNames names the params of a stored model, or returns nil if the model cannot be loaded.
+func ModelParamNames(record *database.ModelRecord) []string {
+	fitted, err := LoadModel(record)
+	if err != nil {
+		return nil
+	}
+	return fitted.Model.ParamNames()
+}
+
+type ParamDiff struct {
+	Index int      `json:"index"`
+	Name  string   `json:"name"`
+	From  *float64 `json:"from"`
+	To    *float64 `json:"to"`
+	Delta *float64 `json:"delta"`
+}
+
+type ModelDiff struct {
+	From            int         `json:"from"`
+	To              int         `json:"to"`
+	SameType        bool        `json:"same_type"`
+	SameTrainingSet bool        `json:"same_training_set"`
+	LossDelta       float64     `json:"loss_delta"`
+	Params          []ParamDiff `json:"params"`
+}
+
+func DiffModels(from *database.ModelRecord, to *database.ModelRecord) *ModelDiff {
+	diff := ModelDiff{
+		From:            from.Id,
+		To:              to.Id,
+		SameType:        from.Type == to.Type,
+		SameTrainingSet: from.Fingerprint == to.Fingerprint,
+		LossDelta:       to.Loss - from.Loss,
+		Params:          []ParamDiff{},
+	}
+
+	names := ModelParamNames(to)
+	if len(from.Params) > len(to.Params) {
+		names = ModelParamNames(from)
+	}
+	count := len(from.Params)
+	if len(to.Params) > count {
+		count = len(to.Params)
+	}
+	for i := 0; i < count; i++ {
+		paramDiff := ParamDiff{Index: i}
+		if i < len(names) {
+			paramDiff.Name = names[i]
+		}
+		if i < len(from.Params) {
+			paramDiff.From = &from.Params[i]
+		}
+		if i < len(to.Params) {
+			paramDiff.To = &to.Params[i]
+		}
+		if paramDiff.From != nil && paramDiff.To != nil {
+			delta := *paramDiff.To - *paramDiff.From
+			paramDiff.Delta = &delta
+		}
+		diff.Params = append(diff.Params, paramDiff)
+	}
+	return &diff
+}
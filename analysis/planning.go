@@ -0,0 +1,142 @@
+package analysis
+
+import (
+	"fmt"
+	"hb-crawler/rating-gain/database"
+	"math"
+)
+
+const (
+	// highest route points the planning functions consider by default
+	DefaultMaxRoutePoints = 1000
+	DefaultMaxHikes       = 50
+	// limits of the planning parameters, as every hike of a plan predicts every route up to the maximum
+	MaxPlanRoutePoints = 5000
+	MaxPlanHikes       = 100
+	MaxCurvePoints     = 1000
+)
+
+type CurvePoint struct {
+	RoutePoints int     `json:"route_points"`
+	PointsAfter float64 `json:"points_after"`
+	Gain        float64 `json:"gain"`
+}
+
+type PlannedHike struct {
+	RoutePoints  int `json:"route_points"`
+	PointsBefore int `json:"points_before"`
+	PointsAfter  int `json:"points_after"`
+}
+
+type HikePlan struct {
+	PointsBefore int `json:"points_before"`
+	Target       int `json:"target"`
+	// least route points reaching the target in one hike, nil if no route up to the maximum does
+	MinimumRoutePoints *int `json:"minimum_route_points"`
+	// hikes reaching the target, each on the route with the largest gain
+	Hikes   []PlannedHike `json:"hikes"`
+	Reached bool          `json:"reached"`
+}
+
+// roundedPrediction estimates the points after hiking a route with the given points, as the site awards integers.
+func roundedPrediction(model *FittedModel, template database.ReducedPointGainRecord, pointsBefore int, routePoints int) int {
+	template.UserPointsBefore = pointsBefore
+	template.RoutePoints = routePoints
+	return int(math.Round(model.Predict(&template)))
+}
+
+/*
+GainCurve estimates the points after hiking routes from the given route points
+up to the given maximum in steps. The template provides the remaining sample
+fields such as the SAC scale and route metrics.
+*/
+func GainCurve(
+	model *FittedModel,
+	template database.ReducedPointGainRecord,
+	from int,
+	to int,
+	step int,
+) ([]CurvePoint, error) {
+	if step <= 0 {
+		return nil, fmt.Errorf("step must be positive")
+	}
+	if to < from {
+		return nil, fmt.Errorf("curve must not end before it starts")
+	}
+	if (to-from)/step >= MaxCurvePoints {
+		return nil, fmt.Errorf("curve must have at most %d points, increase the step", MaxCurvePoints)
+	}
+	curve := []CurvePoint{}
+	for routePoints := from; routePoints <= to; routePoints += step {
+		template.RoutePoints = routePoints
+		pointsAfter := model.Predict(&template)
+		curve = append(curve, CurvePoint{
+			RoutePoints: routePoints,
+			PointsAfter: pointsAfter,
+			Gain:        pointsAfter - float64(template.UserPointsBefore),
+		})
+	}
+	return curve, nil
+}
+
+// MinimumRoutePoints returns the least route points up to maxRoutePoints that reach the target in one hike.
+func MinimumRoutePoints(
+	model *FittedModel,
+	template database.ReducedPointGainRecord,
+	pointsBefore int,
+	target int,
+	maxRoutePoints int,
+) *int {
+	// gains need not grow with the route points, so every route is tried
+	for routePoints := 0; routePoints <= maxRoutePoints; routePoints++ {
+		if roundedPrediction(model, template, pointsBefore, routePoints) >= target {
+			return &routePoints
+		}
+	}
+	return nil
+}
+
+/*
+PlanHikes plans the hikes from the points before to the target. Each hike takes
+the least route points finishing the plan if possible, and the route with the
+largest gain otherwise. Planning stops early once no route gains points or after
+maxHikes hikes.
+*/
+func PlanHikes(
+	model *FittedModel,
+	template database.ReducedPointGainRecord,
+	pointsBefore int,
+	target int,
+	maxRoutePoints int,
+	maxHikes int,
+) *HikePlan {
+	plan := HikePlan{
+		PointsBefore:       pointsBefore,
+		Target:             target,
+		MinimumRoutePoints: MinimumRoutePoints(model, template, pointsBefore, target, maxRoutePoints),
+		Hikes:              []PlannedHike{},
+		Reached:            pointsBefore >= target,
+	}
+
+	points := pointsBefore
+	for len(plan.Hikes) < maxHikes && points < target {
+		hike := PlannedHike{PointsBefore: points, PointsAfter: points}
+		if finishing := MinimumRoutePoints(model, template, points, target, maxRoutePoints); finishing != nil {
+			hike.RoutePoints = *finishing
+			hike.PointsAfter = roundedPrediction(model, template, points, *finishing)
+		} else {
+			for routePoints := 0; routePoints <= maxRoutePoints; routePoints++ {
+				if after := roundedPrediction(model, template, points, routePoints); after > hike.PointsAfter {
+					hike.RoutePoints, hike.PointsAfter = routePoints, after
+				}
+			}
+		}
+		if hike.PointsAfter <= points {
+			break
+		}
+		plan.Hikes = append(plan.Hikes, hike)
+		points = hike.PointsAfter
+	}
+	plan.Reached = points >= target
+	return &plan
+}
@@ -0,0 +1,100 @@
+package analysis
+
+import (
+	"hb-crawler/rating-gain/database"
+	"testing"
+)
+
+func createTestPlanningModel(t *testing.T) *FittedModel {
+	model, err := CreateModel(EloModelName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return CreateDefaultFittedModel(model)
+}
+
+func TestGainCurve(t *testing.T) {
+	model := createTestPlanningModel(t)
+	template := database.ReducedPointGainRecord{UserPointsBefore: 100}
+
+	curve, err := GainCurve(model, template, 0, 100, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(curve) != 4 || curve[0].RoutePoints != 0 || curve[3].RoutePoints != 90 {
+		t.Errorf("curve %+v, expected route points 0 to 90", curve)
+	}
+	for _, point := range curve {
+		if point.Gain != point.PointsAfter-100 {
+			t.Errorf("gain %f of %+v is not relative to the points before", point.Gain, point)
+		}
+	}
+
+	tests := []struct{ from, to, step int }{
+		{0, 100, 0},
+		{100, 0, 10},
+		{0, MaxCurvePoints, 1},
+	}
+	for _, test := range tests {
+		if _, err := GainCurve(model, template, test.from, test.to, test.step); err == nil {
+			t.Errorf("curve %+v succeeded", test)
+		}
+	}
+	if curve, err := GainCurve(model, template, 0, MaxCurvePoints-1, 1); err != nil || len(curve) != MaxCurvePoints {
+		t.Errorf("curve of %d points failed: %v", MaxCurvePoints, err)
+	}
+}
+
+func TestMinimumRoutePoints(t *testing.T) {
+	model := createTestPlanningModel(t)
+	template := database.ReducedPointGainRecord{}
+
+	if routePoints := MinimumRoutePoints(model, template, 100, 100, 1000); routePoints == nil || *routePoints != 0 {
+		t.Errorf("reached target needs %v route points, expected 0", routePoints)
+	}
+	routePoints := MinimumRoutePoints(model, template, 100, 110, 1000)
+	if routePoints == nil {
+		t.Fatal("no route reaches 110 points from 100")
+	}
+	if *routePoints > 0 && roundedPrediction(model, template, 100, *routePoints-1) >= 110 {
+		t.Errorf("%d route points are not the least reaching the target", *routePoints)
+	}
+	if roundedPrediction(model, template, 100, *routePoints) < 110 {
+		t.Errorf("%d route points do not reach the target", *routePoints)
+	}
+	if routePoints := MinimumRoutePoints(model, template, 100, 100000, 10); routePoints != nil {
+		t.Errorf("%d route points reach an unreachable target", *routePoints)
+	}
+}
+
+func TestPlanHikes(t *testing.T) {
+	model := createTestPlanningModel(t)
+	template := database.ReducedPointGainRecord{}
+
+	plan := PlanHikes(model, template, 100, 400, 200, DefaultMaxHikes)
+	if !plan.Reached || len(plan.Hikes) == 0 {
+		t.Fatalf("plan %+v did not reach the target", plan)
+	}
+	points := 100
+	for i, hike := range plan.Hikes {
+		if hike.PointsBefore != points || hike.PointsAfter <= hike.PointsBefore || hike.RoutePoints > 200 {
+			t.Errorf("hike %d %+v does not continue from %d points within 200 route points", i, hike, points)
+		}
+		points = hike.PointsAfter
+	}
+	if points < 400 {
+		t.Errorf("plan ends at %d points", points)
+	}
+	// the last hike takes the least route points finishing the plan
+	last := plan.Hikes[len(plan.Hikes)-1]
+	if finishing := MinimumRoutePoints(model, template, last.PointsBefore, 400, 200); finishing == nil || *finishing != last.RoutePoints {
+		t.Errorf("last hike %+v does not take the least route points %v", last, finishing)
+	}
+
+	if plan := PlanHikes(model, template, 100, 400, 200, 1); plan.Reached || len(plan.Hikes) != 1 {
+		t.Errorf("plan of a single hike %+v", plan)
+	}
+	if plan := PlanHikes(model, template, 500, 400, 200, DefaultMaxHikes); !plan.Reached || len(plan.Hikes) != 0 {
+		t.Errorf("plan above the target %+v", plan)
+	}
+}
@@ -0,0 +1,203 @@
+package analysis
+
+import (
+	"fmt"
+	"hb-crawler/rating-gain/database"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	// outliers deviate from the median residual by more than DefaultOutlierThreshold scaled MADs
+	DefaultOutlierThreshold = 3.5
+	// scales the median absolute deviation to the standard deviation of normally distributed residuals
+	madScale = 1.4826
+	// scales the mean absolute deviation the same way, used when most residuals tie and the MAD is 0
+	meanDeviationScale = 1.2533
+	// residuals closer than a point to the median are never outliers, as points are whole numbers
+	MinOutlierDistance = 1.0
+
+	PointsBeforeBucketWidth = 100
+	RoutePointsBucketWidth  = 50
+
+	PointsBeforeGroup = "points_before"
+	RoutePointsGroup  = "route_points"
+	ScaleGroup        = "scale"
+	EventMonthGroup   = "event_month"
+)
+
+type Residual struct {
+	Sample    database.ReducedPointGainRecord `json:"sample"`
+	Predicted float64                         `json:"predicted"`
+	// predicted minus actual points, positive when overestimating
+	Residual float64 `json:"residual"`
+	Outlier  bool    `json:"outlier"`
+}
+
+type BucketMetrics struct {
+	Group  string `json:"group"`
+	Bucket string `json:"bucket"`
+	Metrics
+	// lower bound of numeric buckets
+	start int
+}
+
+type ResidualReport struct {
+	Model   string  `json:"model"`
+	Metrics Metrics `json:"metrics"`
+	Median  float64 `json:"median"`
+	// median absolute deviation of the residuals from their median
+	MAD float64 `json:"mad"`
+	// residuals further than this from the median are outliers, at least MinOutlierDistance
+	OutlierDistance float64         `json:"outlier_distance"`
+	Residuals       []Residual      `json:"residuals"`
+	Aggregates      []BucketMetrics `json:"aggregates"`
+	Outliers        []Residual      `json:"outliers"`
+}
+
+func metricsOf(diffs []float64) Metrics {
+	metrics := Metrics{Count: len(diffs)}
+	if len(diffs) == 0 {
+		return metrics
+	}
+	for _, diff := range diffs {
+		metrics.MAE += math.Abs(diff)
+		metrics.RMSE += diff * diff
+		metrics.Bias += diff
+	}
+	count := float64(len(diffs))
+	metrics.MAE /= count
+	metrics.RMSE = math.Sqrt(metrics.RMSE / count)
+	metrics.Bias /= count
+	return metrics
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
+
+type bucketKey struct {
+	group, bucket string
+	start         int
+}
+
+func numericBucket(group string, value int, width int) bucketKey {
+	start := int(math.Floor(float64(value)/float64(width))) * width
+	return bucketKey{group: group, bucket: fmt.Sprintf("%d-%d", start, start+width), start: start}
+}
+
+// residualBuckets returns the bucket of the sample in every aggregate group.
+func residualBuckets(record *database.ReducedPointGainRecord) []bucketKey {
+	scale := unknownScale
+	if index := scaleIndex(record.Scale); index < len(sacScales) {
+		scale = sacScales[index]
+	}
+	return []bucketKey{
+		numericBucket(PointsBeforeGroup, record.UserPointsBefore, PointsBeforeBucketWidth),
+		numericBucket(RoutePointsGroup, record.RoutePoints, RoutePointsBucketWidth),
+		{group: ScaleGroup, bucket: scale},
+		{group: EventMonthGroup, bucket: time.Unix(record.EventDate, 0).UTC().Format("2006-01")},
+	}
+}
+
+func aggregateResiduals(residuals []Residual) []BucketMetrics {
+	diffs := map[bucketKey][]float64{}
+	for _, residual := range residuals {
+		for _, key := range residualBuckets(&residual.Sample) {
+			diffs[key] = append(diffs[key], residual.Residual)
+		}
+	}
+
+	aggregates := []BucketMetrics{}
+	for key, bucketDiffs := range diffs {
+		aggregates = append(aggregates, BucketMetrics{
+			Group: key.group, Bucket: key.bucket, Metrics: metricsOf(bucketDiffs), start: key.start,
+		})
+	}
+	sort.Slice(aggregates, func(i, j int) bool {
+		a, b := aggregates[i], aggregates[j]
+		if a.Group != b.Group {
+			return a.Group < b.Group
+		}
+		if a.start != b.start {
+			return a.start < b.start
+		}
+		return a.Bucket < b.Bucket
+	})
+	return aggregates
+}
+
+/*
+AnalyzeResiduals predicts every sample with the model and flags samples whose
+residual deviates from the median residual by more than threshold times the
+scaled median absolute deviation. If more than half of the residuals tie, the
+MAD is 0 and the scaled mean absolute deviation is used instead, so that not
+every residual besides the ties is flagged. Outliers are ordered by their
+deviation.
+*/
+func AnalyzeResiduals(
+	model *FittedModel,
+	pointGains []database.ReducedPointGainRecord,
+	threshold float64,
+) *ResidualReport {
+	if threshold <= 0 {
+		threshold = DefaultOutlierThreshold
+	}
+
+	residuals := []Residual{}
+	diffs := []float64{}
+	for i := range pointGains {
+		predicted := model.Predict(&pointGains[i])
+		diff := predicted - float64(pointGains[i].UserPointsAfter)
+		residuals = append(residuals, Residual{Sample: pointGains[i], Predicted: predicted, Residual: diff})
+		diffs = append(diffs, diff)
+	}
+
+	center := median(diffs)
+	deviations := []float64{}
+	for _, diff := range diffs {
+		deviations = append(deviations, math.Abs(diff-center))
+	}
+	mad := median(deviations)
+	distance := threshold * madScale * mad
+	if mad == 0 && len(deviations) > 0 {
+		mean := 0.0
+		for _, deviation := range deviations {
+			mean += deviation
+		}
+		distance = threshold * meanDeviationScale * mean / float64(len(deviations))
+	}
+	distance = math.Max(distance, MinOutlierDistance)
+
+	outliers := []Residual{}
+	for i := range residuals {
+		if deviations[i] > distance {
+			residuals[i].Outlier = true
+			outliers = append(outliers, residuals[i])
+		}
+	}
+	sort.SliceStable(outliers, func(i, j int) bool {
+		return math.Abs(outliers[i].Residual-center) > math.Abs(outliers[j].Residual-center)
+	})
+
+	return &ResidualReport{
+		Model:           model.Model.Name(),
+		Metrics:         metricsOf(diffs),
+		Median:          center,
+		MAD:             mad,
+		OutlierDistance: distance,
+		Residuals:       residuals,
+		Aggregates:      aggregateResiduals(residuals),
+		Outliers:        outliers,
+	}
+}
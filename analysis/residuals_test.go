@@ -0,0 +1,38 @@
+package analysis
+
+import (
+	"hb-crawler/rating-gain/database"
+	"testing"
+)
+
+func TestAnalyzeResidualsWithTiedResiduals(t *testing.T) {
+	model, err := CreateModel(EloModelName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fitted := CreateDefaultFittedModel(model)
+	template := database.ReducedPointGainRecord{RoutePoints: 120, UserPointsBefore: 100}
+	predicted := int(fitted.Predict(&template))
+
+	// most samples gain exactly the predicted points, so the MAD is 0
+	records := []database.ReducedPointGainRecord{}
+	for i := 0; i < 9; i++ {
+		records = append(records, template)
+		records[i].UserPointsAfter = predicted
+		records[i].EventId = i
+	}
+	near, far := template, template
+	near.EventId, near.UserPointsAfter = 100, predicted+1
+	records = append(records, near)
+
+	report := AnalyzeResiduals(fitted, records, 0)
+	if report.MAD != 0 || report.OutlierDistance < MinOutlierDistance || len(report.Outliers) != 0 {
+		t.Errorf("flagged %d outliers within %f with a MAD of %f", len(report.Outliers), report.OutlierDistance, report.MAD)
+	}
+
+	far.EventId, far.UserPointsAfter = 101, predicted+50
+	report = AnalyzeResiduals(fitted, append(records, far), 0)
+	if len(report.Outliers) != 1 || report.Outliers[0].Sample.EventId != 101 {
+		t.Errorf("flagged %+v beyond %f, expected only event 101", report.Outliers, report.OutlierDistance)
+	}
+}
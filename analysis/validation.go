@@ -0,0 +1,382 @@
+package analysis
+
+import (
+	"context"
+	"fmt"
+	"hb-crawler/rating-gain/database"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+type SplitStrategy string
+
+const (
+	// records are assigned individually
+	RandomSplit SplitStrategy = "random"
+	// older events train, newer events validate
+	DateSplit SplitStrategy = "date"
+	// whole events are assigned, so participants of one event never end up on both sides
+	EventSplit SplitStrategy = "event"
+
+	DefaultValidationRatio = 0.2
+	DefaultFolds           = 5
+	// every fold is a full fit
+	MaxFolds = 20
+)
+
+func ParseSplitStrategy(strategy string) (SplitStrategy, error) {
+	switch SplitStrategy(strategy) {
+	case RandomSplit, DateSplit, EventSplit:
+		return SplitStrategy(strategy), nil
+	}
+	return "", fmt.Errorf("unknown split strategy %s", strategy)
+}
+
+type Metrics struct {
+	Count int     `json:"count"`
+	MAE   float64 `json:"mae"`
+	RMSE  float64 `json:"rmse"`
+	// mean of estimated minus actual points, positive when overestimating
+	Bias float64 `json:"bias"`
+}
+
+func Evaluate(model *FittedModel, pointGains []database.ReducedPointGainRecord) Metrics {
+	diffs := make([]float64, len(pointGains))
+	for i := range pointGains {
+		diffs[i] = model.Predict(&pointGains[i]) - float64(pointGains[i].UserPointsAfter)
+	}
+	return metricsOf(diffs)
+}
+
+/*
+Groups record indices into the units a split strategy assigns together:
+single records for random splits, events otherwise. Groups are ordered by event
+date for date splits and shuffled with the seed for the other strategies.
+*/
+func groupRecords(
+	pointGains []database.ReducedPointGainRecord,
+	strategy SplitStrategy,
+	seed int64,
+) ([][]int, error) {
+	groups := [][]int{}
+	switch strategy {
+	case RandomSplit:
+		for i := range pointGains {
+			groups = append(groups, []int{i})
+		}
+	case DateSplit, EventSplit:
+		groupOfEvent := map[int]int{}
+		for i, record := range pointGains {
+			group, found := groupOfEvent[record.EventId]
+			if !found {
+				group = len(groups)
+				groupOfEvent[record.EventId] = group
+				groups = append(groups, []int{})
+			}
+			groups[group] = append(groups[group], i)
+		}
+	default:
+		return nil, fmt.Errorf("unknown split strategy %s", strategy)
+	}
+
+	if strategy == DateSplit {
+		sort.SliceStable(groups, func(i, j int) bool {
+			a, b := pointGains[groups[i][0]], pointGains[groups[j][0]]
+			if a.EventDate != b.EventDate {
+				return a.EventDate < b.EventDate
+			}
+			return a.EventId < b.EventId
+		})
+		return groups, nil
+	}
+
+	random := rand.New(rand.NewSource(seed))
+	random.Shuffle(len(groups), func(i, j int) {
+		groups[i], groups[j] = groups[j], groups[i]
+	})
+	return groups, nil
+}
+
+func pick(pointGains []database.ReducedPointGainRecord, groups [][]int) []database.ReducedPointGainRecord {
+	records := []database.ReducedPointGainRecord{}
+	for _, group := range groups {
+		for _, index := range group {
+			records = append(records, pointGains[index])
+		}
+	}
+	return records
+}
+
+type SplitParams struct {
+	Strategy SplitStrategy
+	// share of the records that goes to the validation set
+	ValidationRatio float64
+	Seed            int64
+}
+
+func Split(
+	pointGains []database.ReducedPointGainRecord,
+	params *SplitParams,
+) (train []database.ReducedPointGainRecord, validation []database.ReducedPointGainRecord, err error) {
+	if params.ValidationRatio <= 0 || params.ValidationRatio >= 1 {
+		return nil, nil, fmt.Errorf("validation ratio must be between 0 and 1")
+	}
+	groups, err := groupRecords(pointGains, params.Strategy, params.Seed)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// fill the validation set from the end, which holds the newest events for date splits
+	validationSize := int(math.Round(float64(len(pointGains)) * params.ValidationRatio))
+	cut := len(groups)
+	assigned := 0
+	for cut > 0 && assigned < validationSize {
+		cut--
+		assigned += len(groups[cut])
+	}
+
+	return pick(pointGains, groups[:cut]), pick(pointGains, groups[cut:]), nil
+}
+
+/*
+KFold partitions the records into k folds of roughly equal size and returns
+the record indices of each fold. Date folds are contiguous in time.
+*/
+func KFold(
+	pointGains []database.ReducedPointGainRecord,
+	k int,
+	strategy SplitStrategy,
+	seed int64,
+) ([][]int, error) {
+	if k < 2 {
+		return nil, fmt.Errorf("at least 2 folds are required")
+	}
+	if k > MaxFolds {
+		return nil, fmt.Errorf("at most %d folds are allowed", MaxFolds)
+	}
+	groups, err := groupRecords(pointGains, strategy, seed)
+	if err != nil {
+		return nil, err
+	}
+	if len(groups) < k {
+		return nil, fmt.Errorf("cannot split %d groups into %d folds", len(groups), k)
+	}
+
+	folds := make([][]int, k)
+	target := float64(len(pointGains)) / float64(k)
+	fold, assigned := 0, 0
+	for i, group := range groups {
+		remainingGroups := len(groups) - i
+		foldsAfter := k - 1 - fold
+		// move on once the fold is full, or when every later fold still needs a group
+		if foldsAfter > 0 && len(folds[fold]) > 0 && (float64(assigned) >= target || remainingGroups <= foldsAfter) {
+			fold++
+			assigned = 0
+		}
+		folds[fold] = append(folds[fold], group...)
+		assigned += len(group)
+	}
+	return folds, nil
+}
+
+type FoldResult struct {
+	Fold           int       `json:"fold"`
+	TrainSize      int       `json:"train_size"`
+	ValidationSize int       `json:"validation_size"`
+	Params         []float64 `json:"params"`
+	Train          Metrics   `json:"train"`
+	Validation     Metrics   `json:"validation"`
+}
+
+type ValidationResult struct {
+	Strategy SplitStrategy `json:"strategy"`
+	Folds    []FoldResult  `json:"folds"`
+	// averages of the fold metrics
+	Train      Metrics `json:"train"`
+	Validation Metrics `json:"validation"`
+}
+
+// fitProgress reports the progress of the fit in flight together with the number of finished fits.
+func fitProgress(progress func(Progress), finished int) func(Progress) {
+	if progress == nil {
+		return nil
+	}
+	return func(current Progress) {
+		current.Fits = finished
+		progress(current)
+	}
+}
+
+func fitAndEvaluate(
+	ctx context.Context,
+	fold int,
+	train []database.ReducedPointGainRecord,
+	validation []database.ReducedPointGainRecord,
+	initial *FittedModel,
+	options *OptimizeOptions,
+	progress func(Progress),
+) (*FoldResult, error) {
+	result, err := OptimizeEstimatorContext(ctx, train, initial, options.withoutBootstrap(), fitProgress(progress, fold))
+	if err != nil {
+		return nil, err
+	}
+	fitted := result.FittedModel(initial.Model)
+	return &FoldResult{
+		Fold:           fold,
+		TrainSize:      len(train),
+		ValidationSize: len(validation),
+		Params:         result.Params,
+		Train:          Evaluate(fitted, train),
+		Validation:     Evaluate(fitted, validation),
+	}, nil
+}
+
+func averageMetrics(metrics []Metrics) Metrics {
+	average := Metrics{}
+	if len(metrics) == 0 {
+		return average
+	}
+	for _, m := range metrics {
+		average.Count += m.Count
+		average.MAE += m.MAE
+		average.RMSE += m.RMSE
+		average.Bias += m.Bias
+	}
+	count := float64(len(metrics))
+	average.MAE /= count
+	average.RMSE /= count
+	average.Bias /= count
+	return average
+}
+
+func summarize(strategy SplitStrategy, folds []FoldResult) *ValidationResult {
+	train, validation := []Metrics{}, []Metrics{}
+	for _, fold := range folds {
+		train = append(train, fold.Train)
+		validation = append(validation, fold.Validation)
+	}
+	return &ValidationResult{
+		Strategy:   strategy,
+		Folds:      folds,
+		Train:      averageMetrics(train),
+		Validation: averageMetrics(validation),
+	}
+}
+
+/*
+Holdout fits the model on the train split and reports its loss on the held out
+records. Progress, if not nil, is reported like by OptimizeEstimatorContext.
+*/
+func Holdout(
+	ctx context.Context,
+	pointGains []database.ReducedPointGainRecord,
+	initial *FittedModel,
+	params *SplitParams,
+	options *OptimizeOptions,
+	progress func(Progress),
+) (*ValidationResult, error) {
+	train, validation, err := Split(pointGains, params)
+	if err != nil {
+		return nil, err
+	}
+	result, err := fitAndEvaluate(ctx, 0, train, validation, initial, options, progress)
+	if err != nil {
+		return nil, err
+	}
+	return summarize(params.Strategy, []FoldResult{*result}), nil
+}
+
+// CrossValidate fits the model k times, each time validating on a different fold, giving up once ctx is done.
+func CrossValidate(
+	ctx context.Context,
+	pointGains []database.ReducedPointGainRecord,
+	initial *FittedModel,
+	k int,
+	strategy SplitStrategy,
+	seed int64,
+	options *OptimizeOptions,
+	progress func(Progress),
+) (*ValidationResult, error) {
+	folds, err := KFold(pointGains, k, strategy, seed)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []FoldResult{}
+	for fold := range folds {
+		train := []database.ReducedPointGainRecord{}
+		for other, indices := range folds {
+			if other == fold {
+				continue
+			}
+			train = append(train, pick(pointGains, [][]int{indices})...)
+		}
+		validation := pick(pointGains, [][]int{folds[fold]})
+
+		result, err := fitAndEvaluate(ctx, fold, train, validation, initial, options, progress)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, *result)
+	}
+	return summarize(strategy, results), nil
+}
+
+type LeaderboardEntry struct {
+	Model      string    `json:"model"`
+	Params     []float64 `json:"params"`
+	Loss       float64   `json:"loss"`
+	Error      string    `json:"error,omitempty"`
+	Train      *Metrics  `json:"train,omitempty"`
+	Validation *Metrics  `json:"validation,omitempty"`
+}
+
+/*
+Compare fits every model on the same train split and ranks them by their mean
+absolute error on the validation split. Models that fail to fit are listed last
+together with their error. Gives up once ctx is done.
+*/
+func Compare(
+	ctx context.Context,
+	pointGains []database.ReducedPointGainRecord,
+	models []*FittedModel,
+	params *SplitParams,
+	options *OptimizeOptions,
+	progress func(Progress),
+) ([]LeaderboardEntry, error) {
+	train, validation, err := Split(pointGains, params)
+	if err != nil {
+		return nil, err
+	}
+
+	leaderboard := []LeaderboardEntry{}
+	for i, initial := range models {
+		entry := LeaderboardEntry{Model: initial.Model.Name()}
+		result, err := OptimizeEstimatorContext(ctx, train, initial, options.withoutBootstrap(), fitProgress(progress, i))
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			entry.Error = err.Error()
+			leaderboard = append(leaderboard, entry)
+			continue
+		}
+		fitted := result.FittedModel(initial.Model)
+		trainMetrics, validationMetrics := Evaluate(fitted, train), Evaluate(fitted, validation)
+		entry.Params = result.Params
+		entry.Loss = result.Loss
+		entry.Train = &trainMetrics
+		entry.Validation = &validationMetrics
+		leaderboard = append(leaderboard, entry)
+	}
+
+	sort.SliceStable(leaderboard, func(i, j int) bool {
+		a, b := leaderboard[i].Validation, leaderboard[j].Validation
+		if a == nil || b == nil {
+			return b == nil && a != nil
+		}
+		return a.MAE < b.MAE
+	})
+	return leaderboard, nil
+}
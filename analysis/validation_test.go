@@ -0,0 +1,91 @@
+package analysis
+
+import (
+	"hb-crawler/rating-gain/database"
+	"testing"
+)
+
+func createRecords(events int, participants int) []database.ReducedPointGainRecord {
+	records := []database.ReducedPointGainRecord{}
+	for event := 0; event < events; event++ {
+		for participant := 0; participant < participants; participant++ {
+			records = append(records, database.ReducedPointGainRecord{
+				RoutePoints:      100 + event,
+				UserPointsBefore: 50 * participant,
+				UserPointsAfter:  50*participant + 10,
+				EventId:          event,
+				EventDate:        int64(1000 - event),
+			})
+		}
+	}
+	return records
+}
+
+func TestEventSplitKeepsEventsTogether(t *testing.T) {
+	records := createRecords(20, 4)
+	train, validation, err := Split(records, &SplitParams{
+		Strategy:        EventSplit,
+		ValidationRatio: 0.25,
+		Seed:            1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(train)+len(validation) != len(records) {
+		t.Errorf("got %d records after split, wanted %d", len(train)+len(validation), len(records))
+	}
+	trainEvents := map[int]bool{}
+	for _, record := range train {
+		trainEvents[record.EventId] = true
+	}
+	for _, record := range validation {
+		if trainEvents[record.EventId] {
+			t.Errorf("event %d found in both train and validation set", record.EventId)
+		}
+	}
+}
+
+func TestDateSplitValidatesOnNewestEvents(t *testing.T) {
+	records := createRecords(10, 2)
+	train, validation, err := Split(records, &SplitParams{
+		Strategy:        DateSplit,
+		ValidationRatio: 0.2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range validation {
+		for _, tr := range train {
+			if tr.EventDate > v.EventDate {
+				t.Fatalf("train event on %d is newer than validation event on %d", tr.EventDate, v.EventDate)
+			}
+		}
+	}
+}
+
+func TestKFoldCoversEveryRecordOnce(t *testing.T) {
+	records := createRecords(7, 3)
+	for _, strategy := range []SplitStrategy{RandomSplit, DateSplit, EventSplit} {
+		folds, err := KFold(records, 5, strategy, 42)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		seen := map[int]int{}
+		for _, fold := range folds {
+			if len(fold) == 0 {
+				t.Errorf("%s: got empty fold", strategy)
+			}
+			for _, index := range fold {
+				seen[index]++
+			}
+		}
+		for i := range records {
+			if seen[i] != 1 {
+				t.Errorf("%s: record %d appears in %d folds, wanted 1", strategy, i, seen[i])
+			}
+		}
+	}
+}
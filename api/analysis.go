@@ -1,64 +1,841 @@
 package api
 
 import (
+	"context"
+	"encoding/csv"
+	"fmt"
 	"hb-crawler/rating-gain/analysis"
 	"hb-crawler/rating-gain/database"
+	"io"
 	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
 )
 
 const (
-	AnalysisEndpointRoot = "/analysis"
-	EstimateEndpoint     = "/estimate"
-	OptimizeEndpoint     = "/optimize"
+	AnalysisEndpointRoot  = "/analysis"
+	EstimateEndpoint      = "/estimate"
+	EstimateBatchEndpoint = "/estimate/batch"
+	PlanEndpoint          = "/plan"
+	CurveEndpoint         = "/curve"
+	OptimizeEndpoint      = "/optimize"
+	ModelsEndpoint        = "/models"
+	ModelActivateEndpoint = "/models/:id/activate"
+	ModelDiffEndpoint     = "/models/diff"
+	ModelRollbackEndpoint = "/models/rollback"
+	ValidateEndpoint      = "/validate"
+	CompareEndpoint       = "/compare"
+	ResidualsEndpoint     = "/residuals"
+	DatasetEndpoint       = "/dataset"
+	JobsEndpoint          = "/jobs"
+	JobEndpoint           = "/jobs/:id"
+	JobStreamEndpoint     = "/jobs/:id/stream"
+	JobCancelEndpoint     = "/jobs/:id/cancel"
+
+	// interval between two events of a job stream
+	JobStreamInterval = 500 * time.Millisecond
 )
 
 type AnalysisApiHandler struct {
-	repo      *database.DatabaseRepository
-	estimator *analysis.PointGainEstimator
+	repo *database.DatabaseRepository
+	jobs *OptimizeJobs
+	// guards active, which optimize jobs replace in the background
+	mutex  sync.RWMutex
+	active *analysis.FittedModel
+}
+
+func (handler *AnalysisApiHandler) getActive() *analysis.FittedModel {
+	handler.mutex.RLock()
+	defer handler.mutex.RUnlock()
+	return handler.active
+}
+
+// loadActiveModel returns the active model, or the default model if no model
+// has been activated yet.
+func loadActiveModel(repo *database.DatabaseRepository) *analysis.FittedModel {
+	defaultModel, _ := analysis.CreateModel(analysis.DefaultModelName)
+	fallback := analysis.CreateDefaultFittedModel(defaultModel)
+
+	model, err := repo.Model.GetActiveModel()
+	if err != nil {
+		logrus.Warnf("Failed to load active model, using default model: %+v\n", err)
+		return fallback
+	}
+	if model == nil {
+		return fallback
+	}
+
+	fitted, err := analysis.LoadModel(model)
+	if err != nil {
+		logrus.Warnf("Failed to load model %d, using default model: %+v\n", model.Id, err)
+		return fallback
+	}
+	logrus.Infof("Using active model %d", model.Id)
+	return fitted
+}
+
+type Estimate struct {
+	PointsAfter float64 `json:"pointsAfter"`
+}
+
+type BatchEstimate struct {
+	RoutePoints  int     `json:"route_points"`
+	PointsBefore int     `json:"points_before"`
+	PointsAfter  float64 `json:"points_after"`
 }
 
 func (handler *AnalysisApiHandler) estimateHandler(c *gin.Context) {
 
 	var queryPointGain database.ReducedPointGainRecord
-	if err := c.Bind(&queryPointGain); err != nil {
-		reportError(c, http.StatusBadRequest, "invalid request data")
+	if err := c.ShouldBind(&queryPointGain); err != nil {
+		reportInvalidBody(c, err)
+		return
+	}
+
+	estimatedPoints := handler.getActive().Predict(&queryPointGain)
+	sendJSONPayload(c, http.StatusOK, Estimate{PointsAfter: math.Round(estimatedPoints)})
+}
+
+/*
+Reads the samples to estimate from a JSON array, or from CSV sent as body or as
+multipart file "file". CSV columns are matched by the header names route_points,
+points_before and, optionally, scale.
+*/
+func readEstimateBatch(c *gin.Context) ([]database.ReducedPointGainRecord, error) {
+	records := []database.ReducedPointGainRecord{}
+	if c.ContentType() == gin.MIMEJSON {
+		if err := c.ShouldBindJSON(&records); err != nil {
+			return nil, err
+		}
+		return records, nil
+	}
+
+	var body io.Reader = c.Request.Body
+	if file, err := c.FormFile("file"); err == nil {
+		opened, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer opened.Close()
+		body = opened
+	}
+	rows, err := csv.NewReader(body).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return records, nil
+	}
+	columns := map[string]int{}
+	for i, name := range rows[0] {
+		columns[strings.TrimSpace(strings.ToLower(name))] = i
+	}
+	routePointsColumn, hasRoutePoints := columns["route_points"]
+	pointsBeforeColumn, hasPointsBefore := columns["points_before"]
+	if !hasRoutePoints || !hasPointsBefore {
+		return nil, fmt.Errorf("csv header must name route_points and points_before")
+	}
+	scaleColumn, hasScale := columns["scale"]
+
+	for line, row := range rows[1:] {
+		var record database.ReducedPointGainRecord
+		if record.RoutePoints, err = strconv.Atoi(row[routePointsColumn]); err != nil {
+			return nil, fmt.Errorf("invalid route_points in line %d", line+2)
+		}
+		if record.UserPointsBefore, err = strconv.Atoi(row[pointsBeforeColumn]); err != nil {
+			return nil, fmt.Errorf("invalid points_before in line %d", line+2)
+		}
+		if hasScale && len(row[scaleColumn]) > 0 {
+			scale := row[scaleColumn]
+			record.Scale = &scale
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+/*
+Estimates the points after of every sample, see readEstimateBatch. Responds
+with CSV for ?format=csv.
+*/
+func (handler *AnalysisApiHandler) estimateBatchHandler(c *gin.Context) {
+	records, err := readEstimateBatch(c)
+	if err != nil {
+		reportInvalidBody(c, err)
+		return
+	}
+
+	active := handler.getActive()
+	estimates := []BatchEstimate{}
+	rows := [][]string{}
+	for i := range records {
+		pointsAfter := math.Round(active.Predict(&records[i]))
+		estimates = append(estimates, BatchEstimate{
+			RoutePoints:  records[i].RoutePoints,
+			PointsBefore: records[i].UserPointsBefore,
+			PointsAfter:  pointsAfter,
+		})
+		rows = append(rows, []string{
+			strconv.Itoa(records[i].RoutePoints),
+			strconv.Itoa(records[i].UserPointsBefore),
+			strconv.FormatFloat(pointsAfter, 'f', -1, 64),
+		})
+	}
+
+	if strings.ToLower(c.Query("format")) == "csv" {
+		sendCSVPayload(c, "hb_estimates.csv", []string{"route_points", "points_before", "points_after"}, rows)
 		return
 	}
+	sendJSONPayload(c, http.StatusOK, estimates)
+}
+
+// getPlanningTemplate reads the sample the planning endpoints vary the route points of.
+func getPlanningTemplate(c *gin.Context) (*database.ReducedPointGainRecord, error) {
+	pointsBefore, err := strconv.Atoi(c.Query("points_before"))
+	if err != nil {
+		return nil, &ParameterError{Parameter: "points_before", Message: "must be integer"}
+	}
+	template := database.ReducedPointGainRecord{UserPointsBefore: pointsBefore}
+	if scale := c.Query("scale"); len(scale) > 0 {
+		template.Scale = &scale
+	}
+	return &template, nil
+}
+
+// parseBoundedIntQueryParam reads an optional integer parameter within min and max, defaultValue if it is missing.
+func parseBoundedIntQueryParam(c *gin.Context, name string, defaultValue int, min int, max int) (int, error) {
+	value, err := parseIntQueryParam(c, name)
+	if err != nil {
+		return 0, err
+	}
+	if value == nil {
+		return defaultValue, nil
+	}
+	if *value < min || *value > max {
+		return 0, &ParameterError{Parameter: name, Message: fmt.Sprintf("must be between %d and %d", min, max)}
+	}
+	return *value, nil
+}
+
+/*
+Plans the hikes a member needs to reach a target.
 
-	estimatedPoints := handler.estimator.EstimatePointGain(
-		int32(queryPointGain.UserPointsBefore),
-		int32(queryPointGain.RoutePoints),
+Query parameters:
+  - points_before: current points of the member
+  - target: points to reach
+  - max_route_points: hardest route to consider, defaults to 1000, at most 5000
+  - max_hikes: longest plan, defaults to 50, at most 100
+  - scale: SAC scale of the planned routes, for models using it
+*/
+func (handler *AnalysisApiHandler) planHandler(c *gin.Context) {
+	template, err := getPlanningTemplate(c)
+	if err != nil {
+		reportInvalidParameter(c, err)
+		return
+	}
+	target, err := strconv.Atoi(c.Query("target"))
+	if err != nil {
+		reportInvalidParameter(c, &ParameterError{Parameter: "target", Message: "must be integer"})
+		return
+	}
+	maxRoutePoints, err := parseBoundedIntQueryParam(
+		c, "max_route_points", analysis.DefaultMaxRoutePoints, 1, analysis.MaxPlanRoutePoints,
 	)
-	sendJSONPayload(c, http.StatusOK, gin.H{
-		"pointsAfter": math.Round(estimatedPoints),
-	})
+	if err != nil {
+		reportInvalidParameter(c, err)
+		return
+	}
+	maxHikes, err := parseBoundedIntQueryParam(c, "max_hikes", analysis.DefaultMaxHikes, 1, analysis.MaxPlanHikes)
+	if err != nil {
+		reportInvalidParameter(c, err)
+		return
+	}
+
+	plan := analysis.PlanHikes(
+		handler.getActive(), *template, template.UserPointsBefore, target, maxRoutePoints, maxHikes,
+	)
+	sendJSONPayload(c, http.StatusOK, plan)
+}
+
+/*
+Returns the estimated points after across route points for a member.
+
+Query parameters:
+  - points_before: current points of the member
+  - from, to, step: route points of the curve, default to 0, 1000 and 10, up to 5000 and 1000 points
+  - scale: SAC scale of the routes, for models using it
+*/
+func (handler *AnalysisApiHandler) curveHandler(c *gin.Context) {
+	template, err := getPlanningTemplate(c)
+	if err != nil {
+		reportInvalidParameter(c, err)
+		return
+	}
+	from, err := parseBoundedIntQueryParam(c, "from", 0, 0, analysis.MaxPlanRoutePoints)
+	if err != nil {
+		reportInvalidParameter(c, err)
+		return
+	}
+	to, err := parseBoundedIntQueryParam(c, "to", analysis.DefaultMaxRoutePoints, 0, analysis.MaxPlanRoutePoints)
+	if err != nil {
+		reportInvalidParameter(c, err)
+		return
+	}
+	step, err := parseBoundedIntQueryParam(c, "step", 10, 1, analysis.MaxPlanRoutePoints)
+	if err != nil {
+		reportInvalidParameter(c, err)
+		return
+	}
+
+	curve, err := analysis.GainCurve(handler.getActive(), *template, from, to, step)
+	if err != nil {
+		reportInvalidParameter(c, &ParameterError{Parameter: "step", Message: err.Error()})
+		return
+	}
+	sendJSONPayload(c, http.StatusOK, curve)
 }
 
+/*
+Reads the optimizer options from the query parameters:
+  - loss: mae (default), mse, huber or exact
+  - huber_delta: residual size where the huber loss turns linear
+  - l2: weight of the L2 regularization
+  - method: nelder-mead (default), bfgs or cmaes
+  - max_iterations: limit of major iterations
+  - freeze: comma separated param names kept at their current values, e.g. A,B
+  - bootstrap: number of refits on resampled samples to estimate param uncertainty, off by default
+  - confidence: coverage of the bootstrap intervals, defaults to 0.95
+  - bootstrap_seed: seed of the resampling
+*/
+func getOptimizeOptions(c *gin.Context) (*analysis.OptimizeOptions, error) {
+	options := analysis.DefaultOptimizeOptions()
+
+	if loss := c.Query("loss"); len(loss) > 0 {
+		lossFunction, err := analysis.ParseLossFunction(loss)
+		if err != nil {
+			return nil, &ParameterError{Parameter: "loss", Message: "must be mae, mse, huber or exact"}
+		}
+		options.Loss = lossFunction
+	}
+	if method := c.Query("method"); len(method) > 0 {
+		optimizeMethod, err := analysis.ParseOptimizeMethod(method)
+		if err != nil {
+			return nil, &ParameterError{Parameter: "method", Message: "must be nelder-mead, bfgs or cmaes"}
+		}
+		options.Method = optimizeMethod
+	}
+	if delta, err := strconv.ParseFloat(c.Query("huber_delta"), 64); err == nil {
+		options.HuberDelta = delta
+	}
+	if l2, err := strconv.ParseFloat(c.Query("l2"), 64); err == nil {
+		options.L2 = l2
+	}
+	maxIterations, err := parseBoundedIntQueryParam(c, "max_iterations", options.MaxIterations, 1, analysis.IterationLimit)
+	if err != nil {
+		return nil, err
+	}
+	options.MaxIterations = maxIterations
+	if freeze := c.Query("freeze"); len(freeze) > 0 {
+		options.Frozen = strings.Split(freeze, ",")
+	}
+	bootstrap, err := parseBoundedIntQueryParam(c, "bootstrap", 0, 0, analysis.MaxBootstrap)
+	if err != nil {
+		return nil, err
+	}
+	if bootstrap == 1 {
+		return nil, &ParameterError{Parameter: "bootstrap", Message: "needs at least 2 resamples"}
+	}
+	options.Bootstrap = bootstrap
+	if confidence, err := strconv.ParseFloat(c.Query("confidence"), 64); err == nil {
+		options.Confidence = confidence
+	}
+	if seed, err := strconv.ParseInt(c.Query("bootstrap_seed"), 10, 64); err == nil {
+		options.BootstrapSeed = seed
+	}
+	return options, nil
+}
+
+/*
+Returns the model to start fitting from, given by the model query parameter:
+the active model if it is of the requested family, the family's default params
+otherwise. Without the parameter the active model is used.
+*/
+func (handler *AnalysisApiHandler) getInitialModel(c *gin.Context) (*analysis.FittedModel, error) {
+	name := c.Query("model")
+	active := handler.getActive()
+	if len(name) == 0 || name == active.Model.Name() {
+		return active, nil
+	}
+	model, err := analysis.CreateModel(name)
+	if err != nil {
+		return nil, &ParameterError{Parameter: "model", Message: "must be one of " + strings.Join(analysis.ModelNames(), ", ")}
+	}
+	return analysis.CreateDefaultFittedModel(model), nil
+}
+
+// promote stores the optimized model and makes it the active one.
+func (handler *AnalysisApiHandler) promote(
+	ctx context.Context,
+	result *analysis.OptimizeResult,
+	model analysis.Model,
+	records []database.ReducedPointGainRecord,
+) (*int64, error) {
+	handler.mutex.Lock()
+	defer handler.mutex.Unlock()
+	// a job cancelled while fitting must not replace the active model
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	fitted := result.FittedModel(model)
+	modelId, err := handler.repo.Model.CreateModel(analysis.CreateModelRecord(
+		result, analysis.Fingerprint(records), analysis.Evaluate(fitted, records),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to save optimized model: %w", err)
+	}
+	if err := handler.repo.Model.ActivateModel(int(*modelId)); err != nil {
+		return nil, fmt.Errorf("failed to activate model %d: %w", *modelId, err)
+	}
+	handler.active = fitted
+	return modelId, nil
+}
+
+// Submits an optimize job that fits the model and activates it once done.
 func (handler *AnalysisApiHandler) optimizeHandler(c *gin.Context) {
+	options, err := getOptimizeOptions(c)
+	if err != nil {
+		reportInvalidParameter(c, err)
+		return
+	}
+	initial, err := handler.getInitialModel(c)
+	if err != nil {
+		reportInvalidParameter(c, err)
+		return
+	}
+
 	records, err := handler.repo.PointGains.GetValidPointsGainEntry(nil)
 	if err != nil {
-		reportError(c, http.StatusInternalServerError, "failed to get records to optimize parameters from")
+		reportError(c, http.StatusInternalServerError, InternalErrorCode, "failed to get records to optimize parameters from")
 		return
 	}
-	optimizedEstimator, err := analysis.OptimizeEstimator(*records, handler.estimator)
+
+	job, err := handler.jobs.Submit(OptimizeJobKind, initial.Model.Name(), options, func(
+		ctx context.Context,
+		progress func(analysis.Progress),
+	) (*JobOutput, error) {
+		result, err := analysis.OptimizeEstimatorContext(ctx, *records, initial, options, progress)
+		if err != nil {
+			return nil, err
+		}
+		modelId, err := handler.promote(ctx, result, initial.Model, *records)
+		if err != nil {
+			return nil, err
+		}
+		return &JobOutput{Result: result, ModelId: modelId}, nil
+	})
 	if err != nil {
-		reportError(c, http.StatusInternalServerError, "failed to optimize estimator")
+		reportError(c, http.StatusConflict, ConflictCode, err.Error())
 		return
 	}
-	newOptimizer, err := analysis.CreatePointGainEstimator(optimizedEstimator.Params)
+	sendJSONPayload(c, http.StatusAccepted, job)
+}
+
+func (handler *AnalysisApiHandler) jobsListHandler(c *gin.Context) {
+	sendJSONPayload(c, http.StatusOK, handler.jobs.List())
+}
+
+func (handler *AnalysisApiHandler) getJobByIdParam(c *gin.Context) *OptimizeJob {
+	jobId, err := strconv.Atoi(c.Params.ByName("id"))
 	if err != nil {
-		reportError(c, http.StatusInternalServerError, "failed to optimize estimator")
+		reportInvalidParameter(c, &ParameterError{Parameter: "id", Message: "must be integer"})
+		return nil
+	}
+	job := handler.jobs.Get(jobId)
+	if job == nil {
+		reportError(c, http.StatusNotFound, NotFoundCode, "job not found")
+		return nil
+	}
+	return job
+}
+
+func (handler *AnalysisApiHandler) jobHandler(c *gin.Context) {
+	job := handler.getJobByIdParam(c)
+	if job == nil {
+		return
+	}
+	sendJSONPayload(c, http.StatusOK, job)
+}
+
+// Streams the job as server-sent events until it finishes or the client disconnects.
+func (handler *AnalysisApiHandler) jobStreamHandler(c *gin.Context) {
+	job := handler.getJobByIdParam(c)
+	if job == nil {
+		return
+	}
+	c.Stream(func(w io.Writer) bool {
+		job = handler.jobs.Get(job.Id)
+		c.SSEvent(string(job.Status), job)
+		if job.Finished() {
+			return false
+		}
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-time.After(JobStreamInterval):
+			return true
+		}
+	})
+}
+
+func (handler *AnalysisApiHandler) jobCancelHandler(c *gin.Context) {
+	job := handler.getJobByIdParam(c)
+	if job == nil {
+		return
+	}
+	handler.jobs.Cancel(job.Id)
+	sendJSONPayload(c, http.StatusOK, handler.jobs.Get(job.Id))
+}
+
+/*
+Submits a job fitting the estimator on a train split and reporting train and
+validation metrics.
+
+Query parameters:
+  - model: model family to fit, defaults to the active model
+  - validation: holdout (default) or kfold
+  - strategy: random (default), date or event
+  - ratio: share of validation records for holdout, defaults to 0.2
+  - k: number of folds for kfold, defaults to 5
+  - seed: seed of random and event splits
+
+and the optimizer options of getOptimizeOptions. The validation scheme was
+selected by method before method selected the optimizer, those values are
+rejected rather than read as an unknown optimizer.
+*/
+func (handler *AnalysisApiHandler) validateHandler(c *gin.Context) {
+	if method := c.Query("method"); method == "holdout" || method == "kfold" {
+		reportInvalidParameter(c, &ParameterError{
+			Parameter: "method",
+			Message:   "selects the optimizer, pass validation=" + method + " to select the validation scheme",
+		})
+		return
+	}
+	strategy, err := analysis.ParseSplitStrategy(c.DefaultQuery("strategy", string(analysis.RandomSplit)))
+	if err != nil {
+		reportInvalidParameter(c, &ParameterError{Parameter: "strategy", Message: "must be random, date or event"})
+		return
+	}
+	ratio, err := strconv.ParseFloat(c.DefaultQuery("ratio", "0"), 64)
+	if err != nil || ratio == 0 {
+		ratio = analysis.DefaultValidationRatio
+	}
+	k, err := parseBoundedIntQueryParam(c, "k", analysis.DefaultFolds, 2, analysis.MaxFolds)
+	if err != nil {
+		reportInvalidParameter(c, err)
+		return
+	}
+	seed, _ := strconv.ParseInt(c.Query("seed"), 10, 64)
+	validation := c.DefaultQuery("validation", "holdout")
+	if validation != "holdout" && validation != "kfold" {
+		reportInvalidParameter(c, &ParameterError{Parameter: "validation", Message: "must be holdout or kfold"})
+		return
+	}
+
+	options, err := getOptimizeOptions(c)
+	if err != nil {
+		reportInvalidParameter(c, err)
+		return
+	}
+	initial, err := handler.getInitialModel(c)
+	if err != nil {
+		reportInvalidParameter(c, err)
+		return
+	}
+
+	records, err := handler.repo.PointGains.GetValidPointsGainEntry(nil)
+	if err != nil {
+		reportError(c, http.StatusInternalServerError, InternalErrorCode, "failed to get records to validate estimator on")
+		return
+	}
+
+	job, err := handler.jobs.Submit(ValidateJobKind, initial.Model.Name(), options, func(
+		ctx context.Context,
+		progress func(analysis.Progress),
+	) (*JobOutput, error) {
+		var result *analysis.ValidationResult
+		var err error
+		if validation == "kfold" {
+			result, err = analysis.CrossValidate(ctx, *records, initial, k, strategy, seed, options, progress)
+		} else {
+			result, err = analysis.Holdout(ctx, *records, initial, &analysis.SplitParams{
+				Strategy:        strategy,
+				ValidationRatio: ratio,
+				Seed:            seed,
+			}, options, progress)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &JobOutput{Validation: result}, nil
+	})
+	if err != nil {
+		reportError(c, http.StatusConflict, ConflictCode, err.Error())
+		return
+	}
+	sendJSONPayload(c, http.StatusAccepted, job)
+}
+
+/*
+Submits a job fitting every model family from its default params on the same
+train split and ranking them by validation MAE.
+
+Query parameters:
+  - strategy: random (default), date or event
+  - ratio: share of validation records, defaults to 0.2
+  - seed: seed of random and event splits
+
+and the optimizer options of getOptimizeOptions, except freeze.
+*/
+func (handler *AnalysisApiHandler) compareHandler(c *gin.Context) {
+	strategy, err := analysis.ParseSplitStrategy(c.DefaultQuery("strategy", string(analysis.RandomSplit)))
+	if err != nil {
+		reportInvalidParameter(c, &ParameterError{Parameter: "strategy", Message: "must be random, date or event"})
+		return
+	}
+	ratio, err := strconv.ParseFloat(c.DefaultQuery("ratio", "0"), 64)
+	if err != nil || ratio == 0 {
+		ratio = analysis.DefaultValidationRatio
+	}
+	seed, _ := strconv.ParseInt(c.Query("seed"), 10, 64)
+	options, err := getOptimizeOptions(c)
+	if err != nil {
+		reportInvalidParameter(c, err)
+		return
+	}
+	// param names differ between the families
+	options.Frozen = nil
+
+	records, err := handler.repo.PointGains.GetValidPointsGainEntry(nil)
+	if err != nil {
+		reportError(c, http.StatusInternalServerError, InternalErrorCode, "failed to get records to compare models on")
+		return
+	}
+
+	models := []*analysis.FittedModel{}
+	for _, name := range analysis.ModelNames() {
+		model, _ := analysis.CreateModel(name)
+		models = append(models, analysis.CreateDefaultFittedModel(model))
+	}
+	job, err := handler.jobs.Submit(CompareJobKind, strings.Join(analysis.ModelNames(), ","), options, func(
+		ctx context.Context,
+		progress func(analysis.Progress),
+	) (*JobOutput, error) {
+		leaderboard, err := analysis.Compare(ctx, *records, models, &analysis.SplitParams{
+			Strategy:        strategy,
+			ValidationRatio: ratio,
+			Seed:            seed,
+		}, options, progress)
+		if err != nil {
+			return nil, err
+		}
+		return &JobOutput{Leaderboard: leaderboard}, nil
+	})
+	if err != nil {
+		reportError(c, http.StatusConflict, ConflictCode, err.Error())
+		return
+	}
+	sendJSONPayload(c, http.StatusAccepted, job)
+}
+
+func formatOptionalString(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+func residualRows(residuals []analysis.Residual) [][]string {
+	rows := [][]string{}
+	for _, residual := range residuals {
+		sample := residual.Sample
+		routeId := ""
+		if sample.RouteId != nil {
+			routeId = strconv.Itoa(*sample.RouteId)
+		}
+		rows = append(rows, []string{
+			strconv.Itoa(sample.EventId), formatOptionalString(sample.EventTitle), strconv.FormatInt(sample.EventDate, 10),
+			strconv.Itoa(sample.UserId), routeId, formatOptionalString(sample.RouteName), formatOptionalString(sample.Scale),
+			strconv.Itoa(sample.RoutePoints), strconv.Itoa(sample.UserPointsBefore), strconv.Itoa(sample.UserPointsAfter),
+			strconv.FormatFloat(residual.Predicted, 'f', -1, 64), strconv.FormatFloat(residual.Residual, 'f', -1, 64),
+			strconv.FormatBool(residual.Outlier),
+		})
+	}
+	return rows
+}
+
+var residualHeader = []string{
+	"event_id", "event_title", "event_date", "user_id", "route_id", "route_name", "scale",
+	"route_points", "points_before", "points_after", "predicted", "residual", "outlier",
+}
+
+/*
+Reports the residuals of the active model on all complete samples, aggregated
+by points before, route points, SAC scale and event month, and flags outliers.
+
+Query parameters:
+  - threshold: number of scaled median absolute deviations from the median residual beyond which samples are outliers, defaults to 3.5
+  - activity: only use samples of the activity
+  - format: json (default) or csv
+  - view: residuals (default), outliers or aggregates, selects the table of CSV exports
+*/
+func (handler *AnalysisApiHandler) residualsHandler(c *gin.Context) {
+	threshold, err := strconv.ParseFloat(c.Query("threshold"), 64)
+	if err != nil {
+		threshold = analysis.DefaultOutlierThreshold
+	}
+	activity, err := getActivityQueryParam(c)
+	if err != nil {
+		reportInvalidParameter(c, err)
+		return
+	}
+	records, err := handler.repo.PointGains.GetValidPointsGainEntry(&database.ValidPointGainsQuery{
+		Limit:    -1,
+		Activity: activity,
+	})
+	if err != nil {
+		reportError(c, http.StatusInternalServerError, InternalErrorCode, "failed to get records to compute residuals of")
+		return
+	}
+	report := analysis.AnalyzeResiduals(handler.getActive(), *records, threshold)
+
+	if strings.ToLower(c.DefaultQuery("format", "json")) != "csv" {
+		sendJSONPayload(c, http.StatusOK, report)
+		return
+	}
+	switch c.DefaultQuery("view", "residuals") {
+	case "residuals":
+		sendCSVPayload(c, "hb_residuals.csv", residualHeader, residualRows(report.Residuals))
+	case "outliers":
+		sendCSVPayload(c, "hb_outliers.csv", residualHeader, residualRows(report.Outliers))
+	case "aggregates":
+		rows := [][]string{}
+		for _, aggregate := range report.Aggregates {
+			rows = append(rows, []string{
+				aggregate.Group, aggregate.Bucket, strconv.Itoa(aggregate.Count),
+				strconv.FormatFloat(aggregate.MAE, 'f', -1, 64),
+				strconv.FormatFloat(aggregate.RMSE, 'f', -1, 64),
+				strconv.FormatFloat(aggregate.Bias, 'f', -1, 64),
+			})
+		}
+		sendCSVPayload(c, "hb_residual_aggregates.csv", []string{"group", "bucket", "count", "mae", "rmse", "bias"}, rows)
+	default:
+		reportInvalidParameter(c, &ParameterError{Parameter: "view", Message: "must be residuals, outliers or aggregates"})
+	}
+}
+
+func (handler *AnalysisApiHandler) modelsListHandler(c *gin.Context) {
+	models, err := handler.repo.Model.GetModels()
+	if err != nil {
+		reportError(c, http.StatusInternalServerError, InternalErrorCode, "failed to retrieve models")
+		return
+	}
+	sendJSONPayload(c, http.StatusOK, models)
+}
+
+func (handler *AnalysisApiHandler) activate(c *gin.Context, model *database.ModelRecord, activate func(id int) error) {
+	fitted, err := analysis.LoadModel(model)
+	if err != nil {
+		reportError(c, http.StatusBadRequest, BadRequestCode, "model cannot be used as estimator")
+		return
+	}
+	handler.mutex.Lock()
+	defer handler.mutex.Unlock()
+	if err := activate(model.Id); err != nil {
+		logrus.Warnf("Failed to activate model %d: %+v\n", model.Id, err)
+		reportError(c, http.StatusInternalServerError, InternalErrorCode, "failed to activate model")
+		return
+	}
+	handler.active = fitted
+	model.Active = true
+	sendJSONPayload(c, http.StatusOK, model)
+}
+
+func (handler *AnalysisApiHandler) getModelByIdParam(c *gin.Context, id string) *database.ModelRecord {
+	modelId, err := strconv.Atoi(id)
+	if err != nil {
+		reportInvalidParameter(c, &ParameterError{Parameter: "id", Message: "must be integer"})
+		return nil
+	}
+	model, err := handler.repo.Model.GetModelById(modelId)
+	if err != nil {
+		reportError(c, http.StatusInternalServerError, InternalErrorCode, "failed to retrieve model")
+		return nil
+	}
+	if model == nil {
+		reportError(c, http.StatusNotFound, NotFoundCode, "model not found")
+		return nil
+	}
+	return model
+}
+
+func (handler *AnalysisApiHandler) modelActivateHandler(c *gin.Context) {
+	model := handler.getModelByIdParam(c, c.Params.ByName("id"))
+	if model == nil {
+		return
+	}
+	handler.activate(c, model, handler.repo.Model.ActivateModel)
+}
+
+func (handler *AnalysisApiHandler) modelRollbackHandler(c *gin.Context) {
+	model, err := handler.repo.Model.GetPreviouslyActiveModel()
+	if err != nil {
+		reportError(c, http.StatusInternalServerError, InternalErrorCode, "failed to retrieve previous model")
+		return
+	}
+	if model == nil {
+		reportError(c, http.StatusNotFound, NotFoundCode, "no previously active model to roll back to")
+		return
+	}
+	handler.activate(c, model, handler.repo.Model.RollbackModel)
+}
+
+func (handler *AnalysisApiHandler) modelDiffHandler(c *gin.Context) {
+	from := handler.getModelByIdParam(c, c.Query("from"))
+	if from == nil {
+		return
+	}
+	to := handler.getModelByIdParam(c, c.Query("to"))
+	if to == nil {
 		return
 	}
-	handler.estimator = newOptimizer
-	sendJSONPayload(c, http.StatusOK, *optimizedEstimator)
+	sendJSONPayload(c, http.StatusOK, analysis.DiffModels(from, to))
 }
 
-func (handler *AnalysisApiHandler) Register(api *gin.Engine) {
-	router := api.Group(AnalysisEndpointRoot)
+// Estimates only compute and are read-only despite being POST requests, validations and comparisons use every core and need admin keys.
+func (handler *AnalysisApiHandler) Register(groups *RouteGroups) {
+	router, admin := groups.Group(AnalysisEndpointRoot)
 	router.POST(EstimateEndpoint, handler.estimateHandler)
-	router.POST(OptimizeEndpoint, handler.optimizeHandler)
+	router.POST(EstimateBatchEndpoint, handler.estimateBatchHandler)
+	router.GET(PlanEndpoint, handler.planHandler)
+	router.GET(CurveEndpoint, handler.curveHandler)
+	admin.POST(OptimizeEndpoint, handler.optimizeHandler)
+	admin.POST(ValidateEndpoint, handler.validateHandler)
+	admin.POST(CompareEndpoint, handler.compareHandler)
+	router.GET(ResidualsEndpoint, handler.residualsHandler)
+	router.GET(DatasetEndpoint, handler.datasetHandler)
+	router.GET(JobsEndpoint, handler.jobsListHandler)
+	router.GET(JobEndpoint, handler.jobHandler)
+	router.GET(JobStreamEndpoint, handler.jobStreamHandler)
+	admin.POST(JobCancelEndpoint, handler.jobCancelHandler)
+	router.GET(ModelsEndpoint, handler.modelsListHandler)
+	router.GET(ModelDiffEndpoint, handler.modelDiffHandler)
+	admin.POST(ModelActivateEndpoint, handler.modelActivateHandler)
+	admin.POST(ModelRollbackEndpoint, handler.modelRollbackHandler)
 }
@@ -1,8 +1,8 @@
 package api
 
 import (
-	"hb-crawler/rating-gain/analysis"
 	"hb-crawler/rating-gain/database"
+	hb "hb-crawler/rating-gain/hiking-buddies"
 	"hb-crawler/rating-gain/worker"
 	"net/http"
 	"sync"
@@ -18,48 +18,82 @@ type StartServerParams struct {
 	WaitGroup   *sync.WaitGroup
 }
 
-func createApi(params *StartServerParams) *gin.Engine {
-	api := gin.Default()
+func createApi(params *StartServerParams, jobs *OptimizeJobs) *gin.Engine {
+	api := gin.New()
+	api.Use(requestLogger(), requestIdMiddleware(), recoveryMiddleware())
+	api.HandleMethodNotAllowed = true
+	api.NoRoute(routeNotFoundHandler)
+	api.NoMethod(methodNotAllowedHandler)
 
+	// the health check and the documentation are the only routes open without an API key
 	api.GET("/healthcheck", func(c *gin.Context) {
-		c.JSON(http.StatusOK, "OK")
+		sendJSONPayload(c, http.StatusOK, "OK")
 	})
+	CreateOpenApiHandler(Operations()).Register(api)
+	groups := createRouteGroups(api, params.Repo.ApiKey)
+	if count, err := params.Repo.ApiKey.CountActiveApiKeys(); err == nil && count == 0 {
+		log.Warnf("No active API key, all requests will be rejected until a key is created")
+	}
 
 	pointGainsApi := PointGainsApiHandler{
 		repo: params.Repo,
 	}
-	pointGainsApi.Register(api)
+	pointGainsApi.Register(groups)
 
 	workerApi := WorkerApiHandler{
 		workerGroup: params.WorkerGroup,
 	}
-	workerApi.Register(api)
+	workerApi.Register(groups)
 
 	credentialsApi := CredentialsApiHandler{
 		repo: params.Repo,
 	}
-	credentialsApi.Register(api)
+	credentialsApi.Register(groups)
 
-	estimator, _ := analysis.CreatePointGainEstimator([]float64{analysis.InitialM, analysis.InitialL, 400})
 	analysisApi := AnalysisApiHandler{
-		repo:      params.Repo,
-		estimator: estimator,
+		repo:   params.Repo,
+		jobs:   jobs,
+		active: loadActiveModel(params.Repo),
+	}
+	analysisApi.Register(groups)
+
+	recommendationsApi := RecommendationsApiHandler{
+		repo:        params.Repo,
+		events:      hb.CreateUpcomingEventCache(hb.DefaultUpcomingEventsTTL),
+		active:      analysisApi.getActive,
+		rateLimiter: params.WorkerGroup.RateLimiter(),
+		session:     params.WorkerGroup.Session,
+	}
+	recommendationsApi.Register(groups)
+
+	exportApi := ExportApiHandler{
+		repo: params.Repo,
+	}
+	exportApi.Register(groups)
+
+	importApi := ImportApiHandler{
+		repo: params.Repo,
 	}
-	analysisApi.Register(api)
+	importApi.Register(groups)
 
 	return api
 }
 
 func StartServer(params *StartServerParams) *http.Server {
-	api := createApi(params)
+	jobs := CreateOptimizeJobs(params.WaitGroup)
+	api := createApi(params, jobs)
 	server := &http.Server{
 		Addr:    params.Addr,
 		Handler: api,
 	}
+	// running optimizations would otherwise hold up the shutdown until the drain timeout
+	server.RegisterOnShutdown(jobs.CancelAll)
 	params.WaitGroup.Add(1)
 	go func() {
 		log.Debugf("Starting API server...\n")
-		server.ListenAndServe()
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Errorf("API server stopped unexpectedly: %+v\n", err)
+		}
 		params.WaitGroup.Done()
 	}()
 
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"hb-crawler/rating-gain/database"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	ApiKeyHeader = "X-API-Key"
+
+	// context key of the *database.ApiKey a request was authenticated with
+	apiKeyContextKey = "apiKey"
+)
+
+/*
+RouteGroups are the root route groups of the API, one per role. Handlers
+register read-only routes, which do not change any state, on the read-only
+group and all other routes on the admin group.
+*/
+type RouteGroups struct {
+	readOnly *gin.RouterGroup
+	admin    *gin.RouterGroup
+}
+
+func createRouteGroups(api *gin.Engine, keys *database.ApiKeyRepository) *RouteGroups {
+	return &RouteGroups{
+		readOnly: api.Group("", requireRole(keys, database.ReadOnlyRole)),
+		admin:    api.Group("", requireRole(keys, database.AdminRole)),
+	}
+}
+
+// Group returns the read-only and the admin group of the given path.
+func (groups *RouteGroups) Group(path string) (*gin.RouterGroup, *gin.RouterGroup) {
+	return groups.readOnly.Group(path), groups.admin.Group(path)
+}
+
+// requestApiKey returns the key sent as bearer token or in the X-API-Key header.
+func requestApiKey(c *gin.Context) string {
+	if key := c.GetHeader(ApiKeyHeader); len(key) > 0 {
+		return key
+	}
+	scheme, token, found := strings.Cut(c.GetHeader("Authorization"), " ")
+	if found && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+// requireRole rejects requests without an active API key allowed to access routes of the role.
+func requireRole(keys *database.ApiKeyRepository, role database.ApiKeyRole) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := requestApiKey(c)
+		if len(key) == 0 {
+			c.Header("WWW-Authenticate", "Bearer")
+			reportError(c, http.StatusUnauthorized, UnauthorizedCode, "API key required")
+			return
+		}
+		apiKey, err := keys.GetActiveApiKey(key)
+		if err != nil {
+			logrus.Errorf("Failed to look up API key: %+v\n", err)
+			reportError(c, http.StatusInternalServerError, InternalErrorCode, "failed to check API key")
+			return
+		}
+		if apiKey == nil {
+			c.Header("WWW-Authenticate", "Bearer")
+			reportError(c, http.StatusUnauthorized, UnauthorizedCode, "invalid or revoked API key")
+			return
+		}
+		if !apiKey.Role.Allows(role) {
+			logrus.Warnf("API key %s (%s) denied access to %s %s", apiKey.Name, apiKey.Role, c.Request.Method, c.FullPath())
+			reportError(c, http.StatusForbidden, ForbiddenCode, "the API key lacks the "+string(role)+" role")
+			return
+		}
+		c.Set(apiKeyContextKey, apiKey)
+		c.Next()
+	}
+}
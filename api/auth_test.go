@@ -0,0 +1,63 @@
+package api
+
+import (
+	"hb-crawler/rating-gain/database"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireRole(t *testing.T) {
+	api, repo := createTestApi(t)
+	create := func(name string, role database.ApiKeyRole) (string, *database.ApiKey) {
+		key, apiKey, err := repo.ApiKey.CreateApiKey(name, role)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key, apiKey
+	}
+	admin, _ := create("admin", database.AdminRole)
+	readOnly, _ := create("dashboard", database.ReadOnlyRole)
+	revoked, revokedKey := create("old", database.AdminRole)
+	if err := repo.ApiKey.RevokeApiKey(revokedKey.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	const (
+		readRoute  = WorkerEndpoint + WorkerStatusEndpoint
+		adminRoute = WorkerEndpoint + WorkerStopEndpoint
+	)
+	tests := []struct {
+		name, method, path string
+		header, value      string
+		status             int
+		code               ErrorCode
+	}{
+		{"no key", http.MethodGet, readRoute, "", "", http.StatusUnauthorized, UnauthorizedCode},
+		{"wrong key", http.MethodGet, readRoute, ApiKeyHeader, readOnly + "x", http.StatusUnauthorized, UnauthorizedCode},
+		{"wrong bearer token", http.MethodGet, readRoute, "Authorization", "Bearer " + admin + "x", http.StatusUnauthorized, UnauthorizedCode},
+		{"revoked key", http.MethodGet, readRoute, ApiKeyHeader, revoked, http.StatusUnauthorized, UnauthorizedCode},
+		{"revoked bearer token", http.MethodPost, adminRoute, "Authorization", "Bearer " + revoked, http.StatusUnauthorized, UnauthorizedCode},
+		{"other scheme", http.MethodGet, readRoute, "Authorization", "Basic " + readOnly, http.StatusUnauthorized, UnauthorizedCode},
+		{"read-only key header", http.MethodGet, readRoute, ApiKeyHeader, readOnly, http.StatusOK, ""},
+		{"read-only bearer token", http.MethodGet, readRoute, "Authorization", "Bearer " + readOnly, http.StatusOK, ""},
+		{"lower case bearer", http.MethodGet, readRoute, "Authorization", "bearer " + readOnly, http.StatusOK, ""},
+		{"read-only key on admin route", http.MethodPost, adminRoute, ApiKeyHeader, readOnly, http.StatusForbidden, ForbiddenCode},
+		{"read-only bearer on admin route", http.MethodPost, adminRoute, "Authorization", "Bearer " + readOnly, http.StatusForbidden, ForbiddenCode},
+		{"admin key on read route", http.MethodGet, readRoute, ApiKeyHeader, admin, http.StatusOK, ""},
+		{"admin bearer on admin route", http.MethodPost, adminRoute, "Authorization", "Bearer " + admin, http.StatusOK, ""},
+	}
+	for _, test := range tests {
+		request := httptest.NewRequest(test.method, test.path, nil)
+		if len(test.header) > 0 {
+			request.Header.Set(test.header, test.value)
+		}
+		recorder, payload := serveTestRequest(t, api, request)
+		if recorder.Code != test.status || payload.Error.Code != test.code {
+			t.Errorf("%s: responded %d %+v, expected %d %s", test.name, recorder.Code, payload.Error, test.status, test.code)
+		}
+		if authenticate := recorder.Header().Get("WWW-Authenticate"); (test.status == http.StatusUnauthorized) != (authenticate == "Bearer") {
+			t.Errorf("%s: responded WWW-Authenticate %q", test.name, authenticate)
+		}
+	}
+}
@@ -1,16 +1,39 @@
 package api
 
-import "github.com/gin-gonic/gin"
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"net/http"
 
-func reportError(c *gin.Context, statusCode int, message string) {
-	c.JSON(statusCode, gin.H{
-		"error": message,
-	})
-}
+	"github.com/gin-gonic/gin"
+)
 
 func sendJSONPayload(c *gin.Context, statusCode int, payload any) {
-	c.JSON(statusCode, gin.H{
-		"ok":   true,
-		"data": payload,
+	c.JSON(statusCode, Payload{
+		Ok:        true,
+		Data:      payload,
+		RequestId: getRequestId(c),
 	})
 }
+
+// sendCSVPayload sends the rows as CSV attachment with the given file name.
+func sendCSVPayload(c *gin.Context, filename string, header []string, rows [][]string) {
+	buffer := new(bytes.Buffer)
+	w := csv.NewWriter(buffer)
+	if err := w.Write(header); err != nil {
+		reportError(c, http.StatusInternalServerError, InternalErrorCode, "Failed to generate CSV")
+		return
+	}
+	if err := w.WriteAll(rows); err != nil {
+		reportError(c, http.StatusInternalServerError, InternalErrorCode, "Failed to generate CSV")
+		return
+	}
+
+	c.Writer.Header().Set("Content-Type", "text/csv")
+	c.Writer.Header().Set("Content-Disposition", fmt.Sprintf("attachment;filename=%s", filename))
+	c.Writer.WriteHeader(http.StatusOK)
+	if _, err := c.Writer.Write(buffer.Bytes()); err != nil {
+		reportError(c, http.StatusInternalServerError, InternalErrorCode, "Failed to generate CSV")
+	}
+}
@@ -22,7 +22,7 @@ func (handler *CredentialsApiHandler) credentialsListHandler(c *gin.Context) {
 	credentials, err := handler.repo.Login.GetAllAvailableAccounts()
 	if err != nil {
 		logrus.Warnf("Failed to retrieve data: %+v\n", err)
-		reportError(c, http.StatusInternalServerError, "Failed to retrieve data")
+		reportError(c, http.StatusInternalServerError, InternalErrorCode, "Failed to retrieve data")
 		return
 	}
 	sendJSONPayload(c, http.StatusOK, credentials)
@@ -30,21 +30,23 @@ func (handler *CredentialsApiHandler) credentialsListHandler(c *gin.Context) {
 
 func (handler *CredentialsApiHandler) createCredentialHandler(c *gin.Context) {
 	var account database.Account
-	if err := c.Bind(&account); err != nil {
-		reportError(c, http.StatusBadRequest, "Invalid payload")
+	if err := c.ShouldBind(&account); err != nil {
+		reportInvalidBody(c, err)
 		return
 	}
 
 	if err := handler.repo.Login.CreateAccount(&account); err != nil {
 		logrus.Warnf("Failed to create account: %+v\n", err)
-		reportError(c, http.StatusInternalServerError, "Failed to create account")
+		reportError(c, http.StatusInternalServerError, InternalErrorCode, "Failed to create account")
 		return
 	}
-	sendJSONPayload(c, http.StatusOK, gin.H{"ok": true})
+	// the password is not sent back
+	sendJSONPayload(c, http.StatusOK, database.Account{Username: account.Username})
 }
 
-func (handler *CredentialsApiHandler) Register(api *gin.Engine) {
-	router := api.Group(CredentialsEndpointRoot)
-	router.GET(CredentialsList, handler.credentialsListHandler)
-	router.POST(CredentialsCreateEndpoint, handler.createCredentialHandler)
+// Hiking Buddies accounts are admin only, including their list.
+func (handler *CredentialsApiHandler) Register(groups *RouteGroups) {
+	_, admin := groups.Group(CredentialsEndpointRoot)
+	admin.GET(CredentialsList, handler.credentialsListHandler)
+	admin.POST(CredentialsCreateEndpoint, handler.createCredentialHandler)
 }
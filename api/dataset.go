@@ -0,0 +1,124 @@
+package api
+
+import (
+	"hb-crawler/rating-gain/analysis"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+var datasetTemplate = template.Must(template.New("dataset").Funcs(template.FuncMap{
+	"date": func(unix int64) string {
+		return time.Unix(unix, 0).UTC().Format("2006-01-02 15:04")
+	},
+	"points": func(points *int) string {
+		if points == nil {
+			return "-"
+		}
+		return strconv.Itoa(*points)
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Dataset quality</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 0.2em 0.6em; text-align: right; }
+th { background: #eee; }
+</style>
+</head>
+<body>
+<h1>Dataset quality</h1>
+<p>Generated {{date .GeneratedAt}} UTC</p>
+
+<h2>Samples</h2>
+<table>
+<tr><th>Total</th><th>Complete</th><th>Dangling</th><th>Historical</th><th>Valid</th><th>Valid without route</th><th>Non-increasing</th><th>Duplicated gains</th></tr>
+<tr><td>{{.Total}}</td><td>{{.Complete}}</td><td>{{.Dangling}}</td><td>{{.Historical}}</td><td>{{.Valid}}</td><td>{{.ValidWithoutRoute}}</td><td>{{len .NonIncreasing}}</td><td>{{len .Duplicates}}</td></tr>
+</table>
+{{with .OldestDangling}}<p>Oldest dangling sample: event {{.EventId}}, user {{.UserId}}, {{date .EventDate}} ({{printf "%.1f" .AgeDays}} days old)</p>{{end}}
+
+<h2>Coverage by month</h2>
+<table>
+<tr><th>Month</th><th>Total</th><th>Complete</th><th>Dangling</th><th>Valid</th></tr>
+{{range .ByMonth}}<tr><td>{{.Bucket}}</td><td>{{.Total}}</td><td>{{.Complete}}</td><td>{{.Dangling}}</td><td>{{.Valid}}</td></tr>
+{{end}}</table>
+
+<h2>Coverage by route points</h2>
+<table>
+<tr><th>Route points</th><th>Total</th><th>Complete</th><th>Dangling</th><th>Valid</th></tr>
+{{range .ByRoutePoints}}<tr><td>{{.Bucket}}</td><td>{{.Total}}</td><td>{{.Complete}}</td><td>{{.Dangling}}</td><td>{{.Valid}}</td></tr>
+{{end}}</table>
+
+<h2>Non-increasing samples</h2>
+<table>
+<tr><th>Event</th><th>User</th><th>Date</th><th>Route points</th><th>Before</th><th>After</th></tr>
+{{range .NonIncreasing}}<tr><td>{{.EventId}}</td><td>{{.UserId}}</td><td>{{date .EventDate}}</td><td>{{.RoutePoints}}</td><td>{{points .PointsBefore}}</td><td>{{points .PointsAfter}}</td></tr>
+{{end}}</table>
+
+<h2>Duplicated gains</h2>
+<table>
+<tr><th>User</th><th>Before</th><th>After</th><th>Events</th></tr>
+{{range .Duplicates}}<tr><td>{{.UserId}}</td><td>{{.PointsBefore}}</td><td>{{.PointsAfter}}</td><td>{{range $i, $id := .EventIds}}{{if $i}}, {{end}}{{$id}}{{end}}</td></tr>
+{{end}}</table>
+
+<h2>Suspicious jumps ({{.SuspiciousUsers}} users, threshold {{.JumpThreshold}})</h2>
+<table>
+<tr><th>User</th><th>From event</th><th>To event</th><th>After</th><th>Next before</th><th>Change</th></tr>
+{{range .SuspiciousJumps}}<tr><td>{{.UserId}}</td><td>{{.FromEventId}}</td><td>{{.ToEventId}}</td><td>{{.PointsAfter}}</td><td>{{.PointsBefore}}</td><td>{{.Change}}</td></tr>
+{{end}}</table>
+
+<h2>Events without route points</h2>
+<table>
+<tr><th>Event</th><th>Title</th><th>Route</th><th>Date</th></tr>
+{{range .EventsWithoutRoutePoints}}<tr><td>{{.EventId}}</td><td>{{.Title}}</td><td>{{.RouteId}}</td><td>{{date .Date}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+/*
+Reports the health of the collected samples.
+
+Query parameters:
+  - jump: points changing by more than this between two samples of a user are suspicious, defaults to 200
+  - format: json (default) or html
+*/
+func (handler *AnalysisApiHandler) datasetHandler(c *gin.Context) {
+	jump, err := strconv.Atoi(c.Query("jump"))
+	if err != nil {
+		jump = analysis.DefaultJumpThreshold
+	}
+	records, err := handler.repo.PointGains.GetUserTimelines()
+	if err != nil {
+		reportError(c, http.StatusInternalServerError, InternalErrorCode, "failed to get samples")
+		return
+	}
+	events, err := handler.repo.Event.GetEventsWithoutRoutePoints()
+	if err != nil {
+		reportError(c, http.StatusInternalServerError, InternalErrorCode, "failed to get events without route points")
+		return
+	}
+	report := analysis.AnalyzeDataset(*records, *events, jump, time.Now())
+	if report.ValidWithoutRoute, err = handler.repo.PointGains.CountValidPointsGainWithoutRoute(""); err != nil {
+		reportError(c, http.StatusInternalServerError, InternalErrorCode, "failed to count samples without route")
+		return
+	}
+
+	if strings.ToLower(c.DefaultQuery("format", "json")) != "html" {
+		sendJSONPayload(c, http.StatusOK, report)
+		return
+	}
+	c.Writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	c.Writer.WriteHeader(http.StatusOK)
+	if err := datasetTemplate.Execute(c.Writer, report); err != nil {
+		logrus.Errorf("Failed to render dataset report: %+v\n", err)
+	}
+}
@@ -0,0 +1,191 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrorCode identifies the kind of an error, clients may rely on the codes staying the same.
+type ErrorCode string
+
+const (
+	BadRequestCode          ErrorCode = "bad_request"
+	InvalidParameterCode    ErrorCode = "invalid_parameter"
+	InvalidBodyCode         ErrorCode = "invalid_body"
+	UnauthorizedCode        ErrorCode = "unauthorized"
+	ForbiddenCode           ErrorCode = "forbidden"
+	NotFoundCode            ErrorCode = "not_found"
+	MethodNotAllowedCode    ErrorCode = "method_not_allowed"
+	ConflictCode            ErrorCode = "conflict"
+	UpstreamUnavailableCode ErrorCode = "upstream_unavailable"
+	InternalErrorCode       ErrorCode = "internal_error"
+)
+
+// ErrorCodes returns every error code the API responds with.
+func ErrorCodes() []ErrorCode {
+	return []ErrorCode{
+		BadRequestCode,
+		InvalidParameterCode,
+		InvalidBodyCode,
+		UnauthorizedCode,
+		ForbiddenCode,
+		NotFoundCode,
+		MethodNotAllowedCode,
+		ConflictCode,
+		UpstreamUnavailableCode,
+		InternalErrorCode,
+	}
+}
+
+// ErrorDetail points at the query parameter or body field an error is about.
+type ErrorDetail struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type ApiError struct {
+	Code    ErrorCode     `json:"code"`
+	Message string        `json:"message"`
+	Details []ErrorDetail `json:"details,omitempty"`
+	// result of the work done before the error, e.g. the report of a failed worker run
+	Data any `json:"data,omitempty"`
+}
+
+// Payload is the body of successful JSON responses.
+type Payload struct {
+	Ok        bool   `json:"ok"`
+	Data      any    `json:"data"`
+	RequestId string `json:"request_id"`
+}
+
+// ErrorPayload is the body of every error response.
+type ErrorPayload struct {
+	Ok        bool     `json:"ok"`
+	Error     ApiError `json:"error"`
+	RequestId string   `json:"request_id"`
+}
+
+// ParameterError is returned by the parsers of query parameters.
+type ParameterError struct {
+	Parameter string
+	Message   string
+}
+
+func (err *ParameterError) Error() string {
+	return err.Parameter + " " + err.Message
+}
+
+const (
+	RequestIdHeader     = "X-Request-ID"
+	requestIdContextKey = "requestId"
+)
+
+// request ids sent by clients are kept if they are short and safe to log
+var requestIdPattern = regexp.MustCompile(`^[\w.-]{1,64}$`)
+
+func generateRequestId() string {
+	bytes := make([]byte, 8)
+	if _, err := rand.Read(bytes); err != nil {
+		log.Warnf("Failed to generate request id: %+v\n", err)
+	}
+	return hex.EncodeToString(bytes)
+}
+
+// requestIdMiddleware tags every request and its response with an id, the one sent by the client if valid.
+func requestIdMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIdHeader)
+		if !requestIdPattern.MatchString(id) {
+			id = generateRequestId()
+		}
+		c.Set(requestIdContextKey, id)
+		c.Header(RequestIdHeader, id)
+		c.Next()
+	}
+}
+
+func getRequestId(c *gin.Context) string {
+	return c.GetString(requestIdContextKey)
+}
+
+// requestLogger logs requests like gin.Logger, with their request id.
+func requestLogger() gin.HandlerFunc {
+	return gin.LoggerWithFormatter(func(params gin.LogFormatterParams) string {
+		return fmt.Sprintf("[GIN] %v | %3d | %13v | %15s | %-16s | %-7s %#v\n%s",
+			params.TimeStamp.Format("2006/01/02 - 15:04:05"),
+			params.StatusCode,
+			params.Latency,
+			params.ClientIP,
+			params.Keys[requestIdContextKey],
+			params.Method,
+			params.Path,
+			params.ErrorMessage,
+		)
+	})
+}
+
+// recoveryMiddleware turns panics of handlers into internal errors, gin logs their stack trace.
+func recoveryMiddleware() gin.HandlerFunc {
+	return gin.CustomRecovery(func(c *gin.Context, recovered any) {
+		log.Errorf("Request %s panicked: %+v\n", getRequestId(c), recovered)
+		reportError(c, http.StatusInternalServerError, InternalErrorCode, "internal error")
+	})
+}
+
+func reportErrorDetails(c *gin.Context, statusCode int, apiError ApiError) {
+	c.AbortWithStatusJSON(statusCode, ErrorPayload{
+		Ok:        false,
+		Error:     apiError,
+		RequestId: getRequestId(c),
+	})
+}
+
+// reportError responds with the error and stops the handlers after the current one.
+func reportError(c *gin.Context, statusCode int, code ErrorCode, message string) {
+	reportErrorDetails(c, statusCode, ApiError{Code: code, Message: message})
+}
+
+// reportInvalidParameter reports errors of query parameters, naming the parameter for ParameterError.
+func reportInvalidParameter(c *gin.Context, err error) {
+	apiError := ApiError{Code: InvalidParameterCode, Message: err.Error()}
+	var parameterError *ParameterError
+	if errors.As(err, &parameterError) {
+		apiError.Details = []ErrorDetail{{Field: parameterError.Parameter, Message: parameterError.Message}}
+	}
+	reportErrorDetails(c, http.StatusBadRequest, apiError)
+}
+
+// reportInvalidBody reports request bodies that cannot be decoded, naming the field of mistyped JSON values.
+func reportInvalidBody(c *gin.Context, err error) {
+	apiError := ApiError{Code: InvalidBodyCode, Message: "invalid request body: " + err.Error()}
+	var typeError *json.UnmarshalTypeError
+	var syntaxError *json.SyntaxError
+	switch {
+	case errors.As(err, &typeError):
+		apiError.Details = []ErrorDetail{{
+			Field:   typeError.Field,
+			Message: fmt.Sprintf("must be %s, not %s", typeError.Type, typeError.Value),
+		}}
+	case errors.As(err, &syntaxError):
+		apiError.Details = []ErrorDetail{{
+			Message: fmt.Sprintf("%s at offset %d", syntaxError.Error(), syntaxError.Offset),
+		}}
+	}
+	reportErrorDetails(c, http.StatusBadRequest, apiError)
+}
+
+func routeNotFoundHandler(c *gin.Context) {
+	reportError(c, http.StatusNotFound, NotFoundCode, "no route "+c.Request.URL.Path)
+}
+
+func methodNotAllowedHandler(c *gin.Context) {
+	reportError(c, http.StatusMethodNotAllowed, MethodNotAllowedCode, c.Request.Method+" is not allowed on "+c.Request.URL.Path)
+}
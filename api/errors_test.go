@@ -0,0 +1,96 @@
+package api
+
+import (
+	"encoding/json"
+	"hb-crawler/rating-gain/database"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func serveTestRequest(t *testing.T, api *gin.Engine, request *http.Request) (*httptest.ResponseRecorder, *ErrorPayload) {
+	recorder := httptest.NewRecorder()
+	api.ServeHTTP(recorder, request)
+	var payload ErrorPayload
+	if err := json.Unmarshal(recorder.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("%s %s responded %q: %v", request.Method, request.URL, recorder.Body.String(), err)
+	}
+	if header := recorder.Header().Get(RequestIdHeader); len(header) == 0 || header != payload.RequestId {
+		t.Errorf("%s %s responded request id %q in the header and %q in the body", request.Method, request.URL, header, payload.RequestId)
+	}
+	return recorder, &payload
+}
+
+func TestErrorPayloads(t *testing.T) {
+	api, repo := createTestApi(t)
+	key, _, err := repo.ApiKey.CreateApiKey("test", database.AdminRole)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.GET("/panic", func(c *gin.Context) { panic("test") })
+
+	tests := []struct {
+		method, path, body string
+		status             int
+		code               ErrorCode
+		field              string
+	}{
+		{http.MethodGet, "/point-gains/?limit=10&event_id=x", "", http.StatusBadRequest, InvalidParameterCode, "event_id"},
+		{http.MethodGet, "/point-gains/?cursor=eyJzIjogImV2ZW50X2RhdGUiLCAiZCI6IGZhbHNlLCAidiI6IHsiYSI6IDF9LCAiZSI6IDEsICJ1IjogMX0", "", http.StatusBadRequest, InvalidParameterCode, "cursor"},
+		{http.MethodGet, "/point-gains/?cursor=eyJzIjogImV2ZW50X2RhdGUiLCAiZCI6IGZhbHNlLCAidiI6IFsxLCAyXSwgImUiOiAxLCAidSI6IDF9", "", http.StatusBadRequest, InvalidParameterCode, "cursor"},
+		{http.MethodGet, "/point-gains/?activity=H1", "", http.StatusBadRequest, InvalidParameterCode, "activity"},
+		{http.MethodGet, "/analysis/plan?points_before=100&target=a", "", http.StatusBadRequest, InvalidParameterCode, "target"},
+		{http.MethodPost, "/analysis/validate?method=kfold", "", http.StatusBadRequest, InvalidParameterCode, "method"},
+		{http.MethodGet, "/analysis/plan?points_before=100&target=200&max_route_points=1000000", "", http.StatusBadRequest, InvalidParameterCode, "max_route_points"},
+		{http.MethodGet, "/analysis/curve?points_before=100&to=5000&step=1", "", http.StatusBadRequest, InvalidParameterCode, "step"},
+		{http.MethodPost, "/analysis/optimize?bootstrap=1000000", "", http.StatusBadRequest, InvalidParameterCode, "bootstrap"},
+		{http.MethodPost, "/analysis/optimize?max_iterations=1000000000", "", http.StatusBadRequest, InvalidParameterCode, "max_iterations"},
+		{http.MethodPost, "/analysis/validate?validation=kfold&k=1000", "", http.StatusBadRequest, InvalidParameterCode, "k"},
+		{http.MethodPost, "/analysis/estimate", `{"route_points": "many"}`, http.StatusBadRequest, InvalidBodyCode, "route_points"},
+		{http.MethodPost, "/credentials/", `{`, http.StatusBadRequest, InvalidBodyCode, ""},
+		{http.MethodGet, "/analysis/jobs/1", "", http.StatusNotFound, NotFoundCode, ""},
+		{http.MethodGet, "/recommendations/?user_id=7", "", http.StatusServiceUnavailable, UpstreamUnavailableCode, ""},
+		{http.MethodGet, "/unknown", "", http.StatusNotFound, NotFoundCode, ""},
+		{http.MethodDelete, "/healthcheck", "", http.StatusMethodNotAllowed, MethodNotAllowedCode, ""},
+		{http.MethodGet, "/panic", "", http.StatusInternalServerError, InternalErrorCode, ""},
+	}
+	for _, test := range tests {
+		request := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+		request.Header.Set("Content-Type", gin.MIMEJSON)
+		request.Header.Set(ApiKeyHeader, key)
+		recorder, payload := serveTestRequest(t, api, request)
+		if recorder.Code != test.status || payload.Ok || payload.Error.Code != test.code {
+			t.Errorf("%s %s responded %d %+v, expected %d %s", test.method, test.path, recorder.Code, payload, test.status, test.code)
+		}
+		if len(test.field) > 0 && (len(payload.Error.Details) != 1 || payload.Error.Details[0].Field != test.field) {
+			t.Errorf("%s %s responded details %+v, expected field %s", test.method, test.path, payload.Error.Details, test.field)
+		}
+	}
+
+	// unauthenticated requests carry codes too
+	_, payload := serveTestRequest(t, api, httptest.NewRequest(http.MethodGet, "/point-gains/", nil))
+	if payload.Error.Code != UnauthorizedCode {
+		t.Errorf("request without key responded %+v", payload)
+	}
+}
+
+func TestRequestId(t *testing.T) {
+	api, _ := createTestApi(t)
+
+	request := httptest.NewRequest(http.MethodGet, "/healthcheck", nil)
+	request.Header.Set(RequestIdHeader, "trace-42")
+	recorder, payload := serveTestRequest(t, api, request)
+	if recorder.Code != http.StatusOK || payload.RequestId != "trace-42" {
+		t.Errorf("healthcheck responded %d with request id %q", recorder.Code, payload.RequestId)
+	}
+
+	// ids unsafe to log are replaced
+	request = httptest.NewRequest(http.MethodGet, "/healthcheck", nil)
+	request.Header.Set(RequestIdHeader, "bad id\n")
+	if _, payload := serveTestRequest(t, api, request); payload.RequestId == "bad id\n" {
+		t.Errorf("kept request id %q", payload.RequestId)
+	}
+}
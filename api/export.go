@@ -0,0 +1,259 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"hb-crawler/rating-gain/database"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+const (
+	ExportEndpointRoot = "/export"
+	ExportDatasetList  = "/"
+	ExportDataset      = "/:dataset"
+
+	// rows between two flushes of streamed exports
+	exportFlushInterval = 1000
+	// row group size of Parquet exports, which are buffered one row group at a time
+	parquetRowGroupSize = 8 * 1024 * 1024
+	// trailer reporting errors that occur once rows have been sent
+	exportErrorTrailer = "X-Export-Error"
+)
+
+type ExportApiHandler struct {
+	repo *database.DatabaseRepository
+}
+
+// rowWriter encodes exported rows in one format.
+type rowWriter interface {
+	Write(values []any) error
+	Close() error
+}
+
+type csvRowWriter struct {
+	writer *csv.Writer
+}
+
+func createCSVRowWriter(w io.Writer, columns []database.ExportColumn) (rowWriter, error) {
+	header := []string{}
+	for _, column := range columns {
+		header = append(header, column.Name)
+	}
+	writer := csv.NewWriter(w)
+	return &csvRowWriter{writer: writer}, writer.Write(header)
+}
+
+func (w *csvRowWriter) Write(values []any) error {
+	record := make([]string, len(values))
+	for i, value := range values {
+		switch value := value.(type) {
+		case int64:
+			record[i] = strconv.FormatInt(value, 10)
+		case float64:
+			record[i] = strconv.FormatFloat(value, 'f', -1, 64)
+		case string:
+			record[i] = value
+		}
+	}
+	return w.writer.Write(record)
+}
+
+func (w *csvRowWriter) Close() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+type ndjsonRowWriter struct {
+	writer io.Writer
+	keys   [][]byte
+}
+
+func createNDJSONRowWriter(w io.Writer, columns []database.ExportColumn) (rowWriter, error) {
+	keys := [][]byte{}
+	for _, column := range columns {
+		key, err := json.Marshal(column.Name)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return &ndjsonRowWriter{writer: w, keys: keys}, nil
+}
+
+// Write writes the row as one JSON object with the keys in column order.
+func (w *ndjsonRowWriter) Write(values []any) error {
+	line := []byte{'{'}
+	for i, value := range values {
+		if i > 0 {
+			line = append(line, ',')
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		line = append(line, w.keys[i]...)
+		line = append(line, ':')
+		line = append(line, encoded...)
+	}
+	line = append(line, '}', '\n')
+	_, err := w.writer.Write(line)
+	return err
+}
+
+func (w *ndjsonRowWriter) Close() error {
+	return nil
+}
+
+type parquetRowWriter struct {
+	writer *writer.CSVWriter
+}
+
+func createParquetRowWriter(w io.Writer, columns []database.ExportColumn) (rowWriter, error) {
+	schema := []string{}
+	for _, column := range columns {
+		columnType := "type=BYTE_ARRAY, convertedtype=UTF8"
+		switch column.Type {
+		case database.IntegerColumn:
+			columnType = "type=INT64"
+		case database.RealColumn:
+			columnType = "type=DOUBLE"
+		}
+		repetition := "REQUIRED"
+		if column.Nullable {
+			repetition = "OPTIONAL"
+		}
+		schema = append(schema, fmt.Sprintf("name=%s, %s, repetitiontype=%s", column.Name, columnType, repetition))
+	}
+	parquetWriter, err := writer.NewCSVWriterFromWriter(schema, w, 1)
+	if err != nil {
+		return nil, err
+	}
+	parquetWriter.RowGroupSize = parquetRowGroupSize
+	return &parquetRowWriter{writer: parquetWriter}, nil
+}
+
+func (w *parquetRowWriter) Write(values []any) error {
+	return w.writer.Write(values)
+}
+
+func (w *parquetRowWriter) Close() error {
+	return w.writer.WriteStop()
+}
+
+type exportFormat struct {
+	contentType string
+	extension   string
+	create      func(w io.Writer, columns []database.ExportColumn) (rowWriter, error)
+}
+
+var exportFormats = map[string]exportFormat{
+	"csv":     {"text/csv", "csv", createCSVRowWriter},
+	"ndjson":  {"application/x-ndjson", "ndjson", createNDJSONRowWriter},
+	"parquet": {"application/vnd.apache.parquet", "parquet", createParquetRowWriter},
+}
+
+func (handler *ExportApiHandler) datasetListHandler(c *gin.Context) {
+	sendJSONPayload(c, http.StatusOK, database.ExportDatasets())
+}
+
+/*
+Streams a dataset row by row from the database.
+
+Query parameters:
+  - format: csv (default), ndjson or parquet
+  - columns: comma separated columns to export, all columns by default
+  - the filters of /point-gains where the dataset has the filtered column, as well as limit and skip
+*/
+func (handler *ExportApiHandler) exportHandler(c *gin.Context) {
+	dataset, err := database.GetExportDataset(c.Param("dataset"))
+	if err != nil {
+		reportError(c, http.StatusNotFound, NotFoundCode, err.Error())
+		return
+	}
+	format, found := exportFormats[strings.ToLower(c.DefaultQuery("format", "csv"))]
+	if !found {
+		reportInvalidParameter(c, &ParameterError{Parameter: "format", Message: "must be csv, ndjson or parquet"})
+		return
+	}
+	names := []string{}
+	if selected := c.Query("columns"); len(selected) > 0 {
+		for _, name := range strings.Split(selected, ",") {
+			names = append(names, strings.TrimSpace(name))
+		}
+	}
+	columns, err := dataset.SelectColumns(names)
+	if err != nil {
+		reportInvalidParameter(c, &ParameterError{Parameter: "columns", Message: err.Error()})
+		return
+	}
+	params, err := getPointsGainQueryParams(c)
+	if err != nil {
+		reportInvalidParameter(c, err)
+		return
+	}
+	if len(c.Query("limit")) == 0 {
+		params.Limit = -1
+	}
+
+	rows, err := dataset.Query(handler.repo.PointGains.Conn(), columns, params)
+	if err != nil {
+		logrus.Warnf("Failed to export %s: %+v\n", dataset.Name, err)
+		reportError(c, http.StatusBadRequest, BadRequestCode, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	c.Writer.Header().Set("Content-Type", format.contentType)
+	c.Writer.Header().Set("Content-Disposition", fmt.Sprintf("attachment;filename=hb_%s.%s", dataset.Name, format.extension))
+	c.Writer.Header().Set("Trailer", exportErrorTrailer)
+	w, err := format.create(c.Writer, columns)
+	if err != nil {
+		logrus.Errorf("Failed to export %s: %+v\n", dataset.Name, err)
+		for _, header := range []string{"Content-Type", "Content-Disposition", "Trailer"} {
+			c.Writer.Header().Del(header)
+		}
+		reportError(c, http.StatusInternalServerError, InternalErrorCode, "failed to start export")
+		return
+	}
+	// errors after this point can no longer change the status, so they are reported in the trailer
+	if err := streamRows(c, rows, columns, w); err != nil {
+		logrus.Errorf("Export of %s failed while streaming: %+v\n", dataset.Name, err)
+		c.Writer.Header().Set(exportErrorTrailer, err.Error())
+	}
+}
+
+func streamRows(c *gin.Context, rows *sql.Rows, columns []database.ExportColumn, w rowWriter) error {
+	count := 0
+	for rows.Next() {
+		values, err := database.ScanExportRow(rows, columns)
+		if err != nil {
+			return err
+		}
+		if err := w.Write(values); err != nil {
+			return err
+		}
+		count++
+		if count%exportFlushInterval == 0 {
+			c.Writer.Flush()
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+func (handler *ExportApiHandler) Register(groups *RouteGroups) {
+	router, _ := groups.Group(ExportEndpointRoot)
+	router.GET(ExportDatasetList, handler.datasetListHandler)
+	router.GET(ExportDataset, handler.exportHandler)
+}
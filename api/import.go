@@ -0,0 +1,138 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"hb-crawler/rating-gain/database"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	ImportEndpointRoot = "/import"
+	ImportData         = "/"
+
+	// largest upload accepted, databases of a crawler stay well below
+	MaxImportBytes int64 = 1 << 30
+)
+
+type ImportApiHandler struct {
+	repo *database.DatabaseRepository
+	// largest upload accepted, MaxImportBytes if 0
+	maxBytes int64
+}
+
+// importUpload returns the uploaded file, sent as multipart file "file" or as body, and its file name if known.
+func importUpload(c *gin.Context) (io.ReadCloser, string, error) {
+	file, err := c.FormFile("file")
+	if err == nil {
+		opened, err := file.Open()
+		return opened, file.Filename, err
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return nil, "", err
+	}
+	return c.Request.Body, "", nil
+}
+
+// reportImportError responds 413 to uploads over the limit, 400 to data that cannot be imported and 500 to failures of the database.
+func reportImportError(c *gin.Context, err error) {
+	var tooLarge *http.MaxBytesError
+	// uploads cut off at the limit may fail to parse before the limit error reaches the importer, the body reports it again
+	if !errors.As(err, &tooLarge) {
+		if _, readErr := c.Request.Body.Read(make([]byte, 1)); errors.As(readErr, &tooLarge) {
+			err = readErr
+		}
+	}
+	switch {
+	case errors.As(err, &tooLarge):
+		reportError(c, http.StatusRequestEntityTooLarge, BadRequestCode, fmt.Sprintf("uploads are limited to %d bytes", tooLarge.Limit))
+	case errors.Is(err, database.ErrInvalidImport):
+		reportError(c, http.StatusBadRequest, BadRequestCode, fmt.Sprintf("failed to import: %s", err.Error()))
+	default:
+		logrus.Errorf("Failed to import: %+v\n", err)
+		reportError(c, http.StatusInternalServerError, InternalErrorCode, "failed to import")
+	}
+}
+
+// importDatabaseUpload stores the uploaded SQLite database in a temporary file, as SQLite can only open files.
+func (handler *ImportApiHandler) importDatabaseUpload(upload io.Reader, dryRun bool) (*database.ImportReport, error) {
+	file, err := os.CreateTemp("", "hb-import-*.sqlite")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file.Name())
+	_, err = io.Copy(file, upload)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return database.ImportDatabase(handler.repo.PointGains.Conn(), file.Name(), dryRun)
+}
+
+/*
+Merges another instance's data into the database and reports the inserted,
+updated and conflicting rows.
+
+Query parameters:
+  - format: sqlite, csv or ndjson, inferred from the name of an uploaded file otherwise
+  - dataset: dataset of csv and ndjson exports, inferred from file names like hb_point-gains.csv otherwise
+  - dry_run: report the changes without keeping them
+*/
+func (handler *ImportApiHandler) importHandler(c *gin.Context) {
+	dryRun, _ := strconv.ParseBool(c.Query("dry_run"))
+	maxBytes := handler.maxBytes
+	if maxBytes == 0 {
+		maxBytes = MaxImportBytes
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+	upload, filename, err := importUpload(c)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			reportImportError(c, err)
+			return
+		}
+		reportInvalidBody(c, err)
+		return
+	}
+	defer upload.Close()
+
+	format := database.ImportFormat(c.Query("format"))
+	if len(format) == 0 {
+		if len(filename) == 0 {
+			reportInvalidParameter(c, &ParameterError{Parameter: "format", Message: "is required unless a file is uploaded"})
+			return
+		}
+		format = database.InferImportFormat(filename)
+	}
+
+	var report *database.ImportReport
+	if format == database.SQLiteImport {
+		report, err = handler.importDatabaseUpload(upload, dryRun)
+	} else {
+		dataset := c.Query("dataset")
+		if len(dataset) == 0 && len(filename) > 0 {
+			dataset = database.InferImportDataset(filename)
+		}
+		report, err = database.ImportExport(handler.repo.PointGains.Conn(), dataset, format, upload, dryRun)
+	}
+	if err != nil {
+		reportImportError(c, err)
+		return
+	}
+	sendJSONPayload(c, http.StatusOK, report)
+}
+
+func (handler *ImportApiHandler) Register(groups *RouteGroups) {
+	_, admin := groups.Group(ImportEndpointRoot)
+	admin.POST(ImportData, handler.importHandler)
+}
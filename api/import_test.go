@@ -0,0 +1,47 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestImportErrorStatus(t *testing.T) {
+	_, repo := createTestApi(t)
+	handler := ImportApiHandler{repo: repo, maxBytes: 64}
+	importCSV := func(body string) (int, ErrorCode) {
+		recorder := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(recorder)
+		c.Request = httptest.NewRequest(http.MethodPost, "/import/?format=csv&dataset=point-gains", strings.NewReader(body))
+		handler.importHandler(c)
+		payload := ErrorPayload{}
+		json.Unmarshal(recorder.Body.Bytes(), &payload)
+		return recorder.Code, payload.Error.Code
+	}
+
+	valid := "event_id,user_id,route_points\n1,7,50\n"
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		code   ErrorCode
+	}{
+		{"unknown column", "nope\n1\n", http.StatusBadRequest, BadRequestCode},
+		{"over the limit", valid + strings.Repeat("2,7,50\n", 20), http.StatusRequestEntityTooLarge, BadRequestCode},
+	}
+	for _, test := range tests {
+		if status, code := importCSV(test.body); status != test.status || code != test.code {
+			t.Errorf("%s: got %d %s, expected %d %s", test.name, status, code, test.status, test.code)
+		}
+	}
+
+	// the upload is fine, storing it fails
+	repo.PointGains.Conn().Close()
+	if status, code := importCSV(valid); status != http.StatusInternalServerError || code != InternalErrorCode {
+		t.Errorf("closed database: got %d %s, expected 500 %s", status, code, InternalErrorCode)
+	}
+}
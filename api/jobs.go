@@ -0,0 +1,217 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"hb-crawler/rating-gain/analysis"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type JobStatus string
+
+const (
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+	JobCancelled JobStatus = "cancelled"
+)
+
+type JobKind string
+
+const (
+	OptimizeJobKind JobKind = "optimize"
+	ValidateJobKind JobKind = "validate"
+	CompareJobKind  JobKind = "compare"
+)
+
+// OptimizeJob is an optimization, validation or comparison running in the background, see OptimizeJobs.
+type OptimizeJob struct {
+	Id       int                      `json:"id"`
+	Kind     JobKind                  `json:"kind"`
+	Model    string                   `json:"model"`
+	Options  analysis.OptimizeOptions `json:"options"`
+	Status   JobStatus                `json:"status"`
+	Progress *analysis.Progress       `json:"progress"`
+	// only the results of the kind of the job are set
+	Result      *analysis.OptimizeResult    `json:"result,omitempty"`
+	ModelId     *int64                      `json:"model_id,omitempty"`
+	Validation  *analysis.ValidationResult  `json:"validation,omitempty"`
+	Leaderboard []analysis.LeaderboardEntry `json:"leaderboard,omitempty"`
+	Error       string                      `json:"error,omitempty"`
+	CreatedAt   time.Time                   `json:"created_at"`
+	FinishedAt  *time.Time                  `json:"finished_at,omitempty"`
+	cancel      context.CancelFunc
+}
+
+func (job *OptimizeJob) Finished() bool {
+	return job.Status != JobRunning
+}
+
+// JobOutput is what a job produces, only the fields of its kind are set.
+type JobOutput struct {
+	Result      *analysis.OptimizeResult
+	ModelId     *int64
+	Validation  *analysis.ValidationResult
+	Leaderboard []analysis.LeaderboardEntry
+}
+
+// OptimizeRun fits models, optimize jobs also promote the fitted model and return the id of the stored model.
+type OptimizeRun func(
+	ctx context.Context,
+	progress func(analysis.Progress),
+) (*JobOutput, error)
+
+/*
+OptimizeJobs runs optimizations, validations and comparisons in the background,
+one at a time as they all use every core, and keeps their state in memory so
+that clients can poll them.
+*/
+type OptimizeJobs struct {
+	mutex     sync.Mutex
+	jobs      map[int]*OptimizeJob
+	nextId    int
+	waitGroup *sync.WaitGroup
+}
+
+func CreateOptimizeJobs(waitGroup *sync.WaitGroup) *OptimizeJobs {
+	return &OptimizeJobs{
+		jobs:      map[int]*OptimizeJob{},
+		nextId:    1,
+		waitGroup: waitGroup,
+	}
+}
+
+// Submit starts the run as a new job unless another job is still running.
+func (j *OptimizeJobs) Submit(
+	kind JobKind,
+	model string,
+	options *analysis.OptimizeOptions,
+	run OptimizeRun,
+) (*OptimizeJob, error) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	for _, job := range j.jobs {
+		if !job.Finished() {
+			return nil, fmt.Errorf("%s job %d is still running", job.Kind, job.Id)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &OptimizeJob{
+		Id:        j.nextId,
+		Kind:      kind,
+		Model:     model,
+		Options:   *options,
+		Status:    JobRunning,
+		CreatedAt: time.Now(),
+		cancel:    cancel,
+	}
+	j.jobs[job.Id] = job
+	j.nextId++
+
+	j.waitGroup.Add(1)
+	go func() {
+		defer j.waitGroup.Done()
+		defer cancel()
+		output, err := j.runRecovered(ctx, job, run)
+		j.finish(job, output, err, ctx.Err() != nil)
+	}()
+
+	snapshot := *job
+	return &snapshot, nil
+}
+
+// runRecovered runs the job, failing it on panics, e.g. of an optimizer, which would otherwise stop the server.
+func (j *OptimizeJobs) runRecovered(
+	ctx context.Context,
+	job *OptimizeJob,
+	run OptimizeRun,
+) (output *JobOutput, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			logrus.Errorf("%s job %d panicked: %+v\n%s", job.Kind, job.Id, recovered, debug.Stack())
+			output, err = nil, fmt.Errorf("panic: %v", recovered)
+		}
+	}()
+	return run(ctx, func(progress analysis.Progress) {
+		j.mutex.Lock()
+		job.Progress = &progress
+		j.mutex.Unlock()
+	})
+}
+
+func (j *OptimizeJobs) finish(
+	job *OptimizeJob,
+	output *JobOutput,
+	err error,
+	cancelled bool,
+) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	now := time.Now()
+	job.FinishedAt = &now
+	switch {
+	case err == nil:
+		job.Status = JobSucceeded
+		job.Result = output.Result
+		job.ModelId = output.ModelId
+		job.Validation = output.Validation
+		job.Leaderboard = output.Leaderboard
+	case cancelled:
+		job.Status = JobCancelled
+	default:
+		logrus.Warnf("%s job %d failed: %+v\n", job.Kind, job.Id, err)
+		job.Status = JobFailed
+		job.Error = err.Error()
+	}
+}
+
+// Get returns a copy of the job, or nil if there is no job with the id.
+func (j *OptimizeJobs) Get(id int) *OptimizeJob {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	job, found := j.jobs[id]
+	if !found {
+		return nil
+	}
+	snapshot := *job
+	return &snapshot
+}
+
+func (j *OptimizeJobs) List() []OptimizeJob {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	jobs := []OptimizeJob{}
+	for _, job := range j.jobs {
+		jobs = append(jobs, *job)
+	}
+	sort.Slice(jobs, func(a, b int) bool {
+		return jobs[a].Id > jobs[b].Id
+	})
+	return jobs
+}
+
+// Cancel stops the job if it is still running and returns false if there is no job with the id.
+func (j *OptimizeJobs) Cancel(id int) bool {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	job, found := j.jobs[id]
+	if !found {
+		return false
+	}
+	job.cancel()
+	return true
+}
+
+func (j *OptimizeJobs) CancelAll() {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	for _, job := range j.jobs {
+		job.cancel()
+	}
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hb-crawler/rating-gain/analysis"
+	"hb-crawler/rating-gain/database"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOptimizeJobFailsOnPanic(t *testing.T) {
+	waitGroup := sync.WaitGroup{}
+	jobs := CreateOptimizeJobs(&waitGroup)
+	job, err := jobs.Submit(OptimizeJobKind, "elo", analysis.DefaultOptimizeOptions(), func(
+		ctx context.Context,
+		progress func(analysis.Progress),
+	) (*JobOutput, error) {
+		panic("optimizer failed")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitGroup.Wait()
+
+	finished := jobs.Get(job.Id)
+	if finished.Status != JobFailed || !strings.Contains(finished.Error, "optimizer failed") || finished.FinishedAt == nil {
+		t.Errorf("panicking job finished as %+v", finished)
+	}
+	// the next job can run
+	if _, err := jobs.Submit(ValidateJobKind, "elo", analysis.DefaultOptimizeOptions(), func(
+		ctx context.Context,
+		progress func(analysis.Progress),
+	) (*JobOutput, error) {
+		return &JobOutput{Validation: &analysis.ValidationResult{}}, nil
+	}); err != nil {
+		t.Errorf("submitting after the panic failed: %v", err)
+	}
+	waitGroup.Wait()
+}
+
+func TestValidateAndCompareRunAsJobs(t *testing.T) {
+	api, repo := createTestApi(t)
+	key, _, err := repo.ApiKey.CreateApiKey("test", database.AdminRole)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serve := func(method string, path string) (int, OptimizeJob) {
+		request := httptest.NewRequest(method, path, nil)
+		request.Header.Set(ApiKeyHeader, key)
+		recorder := httptest.NewRecorder()
+		api.ServeHTTP(recorder, request)
+		var job OptimizeJob
+		if err := json.Unmarshal(recorder.Body.Bytes(), &Payload{Data: &job}); err != nil {
+			t.Fatalf("%s %s responded %q: %v", method, path, recorder.Body.String(), err)
+		}
+		return recorder.Code, job
+	}
+
+	for path, kind := range map[string]JobKind{"/analysis/validate": ValidateJobKind, "/analysis/compare": CompareJobKind} {
+		status, job := serve(http.MethodPost, path)
+		if status != http.StatusAccepted || job.Kind != kind {
+			t.Fatalf("%s responded %d with %+v", path, status, job)
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for !job.Finished() && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+			_, job = serve(http.MethodGet, fmt.Sprintf("/analysis/jobs/%d", job.Id))
+		}
+		// there are no samples to fit, comparisons list the error of every family
+		switch {
+		case kind == ValidateJobKind && (job.Status != JobFailed || len(job.Error) == 0):
+			t.Errorf("validate job finished as %+v", job)
+		case kind == CompareJobKind && (job.Status != JobSucceeded || len(job.Leaderboard) != len(analysis.ModelNames())):
+			t.Errorf("compare job finished as %+v", job)
+		}
+	}
+}
@@ -0,0 +1,356 @@
+package api
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	OpenApiEndpoint = "/openapi.json"
+	DocsEndpoint    = "/docs"
+
+	openApiVersion = "3.0.3"
+	ApiVersion     = "1.0.0"
+)
+
+// schemaBuilder derives JSON schemas from Go types the way encoding/json encodes them.
+type schemaBuilder struct {
+	// schemas of named struct types, referenced from the other schemas
+	schemas map[string]any
+	names   map[reflect.Type]string
+}
+
+func (builder *schemaBuilder) schemaName(t reflect.Type) string {
+	if name, found := builder.names[t]; found {
+		return name
+	}
+	name := t.Name()
+	for _, other := range builder.names {
+		if other == name {
+			// same name in another package, prefix the package name, e.g. analysisResidual
+			pkg, _, _ := strings.Cut(t.String(), ".")
+			name = pkg + t.Name()
+			break
+		}
+	}
+	builder.names[t] = name
+	return name
+}
+
+func (builder *schemaBuilder) schema(t reflect.Type) map[string]any {
+	switch {
+	case t == reflect.TypeOf(time.Time{}):
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t == reflect.TypeOf(json.RawMessage{}):
+		return map[string]any{}
+	case t == reflect.TypeOf(ErrorCode("")):
+		return map[string]any{"type": "string", "enum": ErrorCodes()}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema := builder.schema(t.Elem())
+		if ref, found := schema["$ref"]; found {
+			return map[string]any{"allOf": []any{map[string]any{"$ref": ref}}, "nullable": true}
+		}
+		schema["nullable"] = true
+		return schema
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		return map[string]any{"type": "integer"}
+	case reflect.Int64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": builder.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": builder.schema(t.Elem())}
+	case reflect.Struct:
+		if len(t.Name()) == 0 {
+			return builder.structSchema(t)
+		}
+		name := builder.schemaName(t)
+		if _, found := builder.schemas[name]; !found {
+			// reserve the name first for types referencing themselves
+			builder.schemas[name] = nil
+			builder.schemas[name] = builder.structSchema(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	}
+	// interfaces may hold any value
+	return map[string]any{}
+}
+
+func (builder *schemaBuilder) addFields(t reflect.Type, properties map[string]any, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if field.Anonymous && len(name) == 0 {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				builder.addFields(embedded, properties, required)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if len(name) == 0 {
+			name = field.Name
+		}
+		properties[name] = builder.schema(field.Type)
+		if !strings.Contains(options, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
+
+func (builder *schemaBuilder) structSchema(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	required := []string{}
+	builder.addFields(t, properties, &required)
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// payloadSchema is the schema of the responses of sendJSONPayload, a Payload with the data.
+func payloadSchema(data map[string]any) map[string]any {
+	return map[string]any{
+		"type":     "object",
+		"required": []string{"ok", "data", "request_id"},
+		"properties": map[string]any{
+			"ok":         map[string]any{"type": "boolean"},
+			"data":       data,
+			"request_id": map[string]any{"type": "string"},
+		},
+	}
+}
+
+var pathParameterPattern = regexp.MustCompile(`:(\w+)`)
+
+// OpenApiPath turns the parameters of a Gin path into OpenAPI parameters, e.g. /jobs/:id into /jobs/{id}.
+func OpenApiPath(path string) string {
+	return pathParameterPattern.ReplaceAllString(path, "{$1}")
+}
+
+func parameterObjects(parameters []Parameter, in string) []any {
+	objects := []any{}
+	for _, parameter := range parameters {
+		object := map[string]any{
+			"name":     parameter.Name,
+			"in":       in,
+			"required": parameter.Required,
+			"schema":   map[string]any{"type": parameter.Type},
+		}
+		if len(parameter.Description) > 0 {
+			object["description"] = parameter.Description
+		}
+		objects = append(objects, object)
+	}
+	return objects
+}
+
+func (builder *schemaBuilder) operationObject(operation *Operation) map[string]any {
+	object := map[string]any{
+		"operationId": operation.Id,
+		"summary":     operation.Summary,
+		"tags":        []string{strings.Split(strings.TrimPrefix(operation.Path, "/"), "/")[0]},
+	}
+
+	parameters := parameterObjects(operation.PathParams, "path")
+	parameters = append(parameters, parameterObjects(operation.Query, "query")...)
+	if len(parameters) > 0 {
+		object["parameters"] = parameters
+	}
+
+	content := map[string]any{}
+	if operation.Body != nil {
+		content[gin.MIMEJSON] = map[string]any{"schema": builder.schema(reflect.TypeOf(operation.Body))}
+	}
+	for _, contentType := range operation.Uploads {
+		schema := map[string]any{"type": "string", "format": "binary"}
+		if contentType == gin.MIMEMultipartPOSTForm {
+			schema = map[string]any{
+				"type":       "object",
+				"properties": map[string]any{"file": schema},
+			}
+		}
+		content[contentType] = map[string]any{"schema": schema}
+	}
+	if len(content) > 0 {
+		object["requestBody"] = map[string]any{"content": content}
+	}
+
+	success := map[string]any{}
+	if operation.Response != nil {
+		success[gin.MIMEJSON] = map[string]any{"schema": payloadSchema(builder.schema(reflect.TypeOf(operation.Response)))}
+	}
+	for _, contentType := range operation.Produces {
+		success[contentType] = map[string]any{}
+	}
+	errorResponse := map[string]any{
+		"description": "error",
+		"content": map[string]any{
+			gin.MIMEJSON: map[string]any{"schema": builder.schema(reflect.TypeOf(ErrorPayload{}))},
+		},
+	}
+	responses := map[string]any{
+		"default": errorResponse,
+		strconv.Itoa(operation.SuccessStatus()): map[string]any{
+			"description": http.StatusText(operation.SuccessStatus()),
+			"content":     success,
+		},
+	}
+
+	if len(operation.Role) > 0 {
+		object["security"] = []any{
+			map[string]any{"bearer": []string{}},
+			map[string]any{"apiKey": []string{}},
+		}
+		object["x-role"] = operation.Role
+		responses[strconv.Itoa(http.StatusUnauthorized)] = errorResponse
+		responses[strconv.Itoa(http.StatusForbidden)] = errorResponse
+	}
+	object["responses"] = responses
+	return object
+}
+
+// CreateOpenApiDocument builds the OpenAPI document of the operations.
+func CreateOpenApiDocument(operations []Operation) map[string]any {
+	builder := schemaBuilder{schemas: map[string]any{}, names: map[reflect.Type]string{}}
+
+	paths := map[string]map[string]any{}
+	for i := range operations {
+		path := OpenApiPath(operations[i].Path)
+		if _, found := paths[path]; !found {
+			paths[path] = map[string]any{}
+		}
+		paths[path][strings.ToLower(operations[i].Method)] = builder.operationObject(&operations[i])
+	}
+
+	return map[string]any{
+		"openapi": openApiVersion,
+		"info": map[string]any{
+			"title":   "Hiking Buddies Crawler",
+			"version": ApiVersion,
+			"description": "Point gains collected from Hiking Buddies and the estimators fitted on them. " +
+				"JSON responses wrap their data as {\"ok\": true, \"data\": ..., \"request_id\": ...} " +
+				"and errors as {\"ok\": false, \"error\": {\"code\": ..., \"message\": ..., \"details\": [...]}, \"request_id\": ...}. " +
+				"The request id is also sent in the " + RequestIdHeader + " header, which clients may set themselves.",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": builder.schemas,
+			"securitySchemes": map[string]any{
+				"bearer": map[string]any{"type": "http", "scheme": "bearer"},
+				"apiKey": map[string]any{"type": "apiKey", "in": "header", "name": ApiKeyHeader},
+			},
+		},
+	}
+}
+
+var docsTemplate = template.Must(template.New("docs").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Hiking Buddies Crawler API</title>
+<style>
+body { font-family: sans-serif; margin: 2em; max-width: 70em; }
+table { border-collapse: collapse; margin: 0.5em 0 1em; }
+td, th { border: 1px solid #ccc; padding: 0.2em 0.6em; text-align: left; vertical-align: top; }
+.operation { border-top: 1px solid #ccc; padding-top: 0.5em; }
+.method { font-weight: bold; display: inline-block; width: 4em; }
+.role { color: #666; }
+</style>
+</head>
+<body>
+<h1>Hiking Buddies Crawler API</h1>
+<p>
+The <a href="{{.OpenApi}}">OpenAPI document</a> describes the API in full.
+Send API keys as <code>Authorization: Bearer &lt;key&gt;</code> or in the <code>{{.ApiKeyHeader}}</code> header.
+JSON responses wrap their data as <code>{"ok": true, "data": ..., "request_id": ...}</code>.
+Errors respond with <code>{"ok": false, "error": {"code": ..., "message": ..., "details": [...]}, "request_id": ...}</code>,
+the details name the query parameters or body fields at fault.
+The request id is also sent in the <code>{{.RequestIdHeader}}</code> header, send your own to correlate logs.
+Error codes: {{range $i, $code := .ErrorCodes}}{{if $i}}, {{end}}<code>{{$code}}</code>{{end}}.
+</p>
+{{range .Operations}}
+<div class="operation" id="{{.Id}}">
+<h3><span class="method">{{.Method}}</span> <code>{{.Path}}</code></h3>
+<p>{{.Summary}}. {{if .Role}}<span class="role">Requires the {{.Role}} role.</span>{{else}}<span class="role">Open.</span>{{end}}</p>
+{{if or .PathParams .Query}}
+<table>
+<tr><th>Parameter</th><th>In</th><th>Type</th><th>Description</th></tr>
+{{range .PathParams}}<tr><td><code>{{.Name}}</code></td><td>path</td><td>{{.Type}}</td><td>{{.Description}}</td></tr>{{end}}
+{{range .Query}}<tr><td><code>{{.Name}}</code>{{if .Required}} (required){{end}}</td><td>query</td><td>{{.Type}}</td><td>{{.Description}}</td></tr>{{end}}
+</table>
+{{end}}
+</div>
+{{end}}
+</body>
+</html>
+`))
+
+type OpenApiHandler struct {
+	document   map[string]any
+	operations []Operation
+}
+
+func CreateOpenApiHandler(operations []Operation) *OpenApiHandler {
+	return &OpenApiHandler{
+		document:   CreateOpenApiDocument(operations),
+		operations: operations,
+	}
+}
+
+func (handler *OpenApiHandler) documentHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, handler.document)
+}
+
+func (handler *OpenApiHandler) docsHandler(c *gin.Context) {
+	c.Writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	c.Status(http.StatusOK)
+	if err := docsTemplate.Execute(c.Writer, gin.H{
+		"OpenApi":         OpenApiEndpoint,
+		"ApiKeyHeader":    ApiKeyHeader,
+		"RequestIdHeader": RequestIdHeader,
+		"ErrorCodes":      ErrorCodes(),
+		"Operations":      handler.operations,
+	}); err != nil {
+		logrus.Errorf("Failed to render docs: %+v\n", err)
+	}
+}
+
+// The document and its docs page are open, like the health check.
+func (handler *OpenApiHandler) Register(api *gin.Engine) {
+	api.GET(OpenApiEndpoint, handler.documentHandler)
+	api.GET(DocsEndpoint, handler.docsHandler)
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"encoding/json"
+	"hb-crawler/rating-gain/database"
+	"hb-crawler/rating-gain/worker"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func createTestApi(t *testing.T) (*gin.Engine, *database.DatabaseRepository) {
+	gin.SetMode(gin.TestMode)
+	db, err := database.InitializeDatabase(filepath.Join(t.TempDir(), "db.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	repo := database.GetRepository(db)
+	waitGroup := sync.WaitGroup{}
+	params := &StartServerParams{
+		Repo:        repo,
+		WaitGroup:   &waitGroup,
+		WorkerGroup: worker.CreateWorkerGroup(repo, &waitGroup, nil),
+	}
+	return createApi(params, CreateOptimizeJobs(&waitGroup)), repo
+}
+
+func TestOperationsMatchRoutes(t *testing.T) {
+	api, _ := createTestApi(t)
+
+	documented := map[string]bool{}
+	for _, operation := range Operations() {
+		documented[operation.Method+" "+operation.Path] = true
+	}
+	registered := map[string]bool{}
+	for _, route := range api.Routes() {
+		key := route.Method + " " + route.Path
+		registered[key] = true
+		if !documented[key] {
+			t.Errorf("route %s is not documented", key)
+		}
+	}
+	for key := range documented {
+		if !registered[key] {
+			t.Errorf("operation %s has no route", key)
+		}
+	}
+}
+
+func TestOperationRoles(t *testing.T) {
+	api, repo := createTestApi(t)
+	key, _, err := repo.ApiKey.CreateApiKey("test", database.ReadOnlyRole)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, operation := range Operations() {
+		// path parameters of unknown ids, so that handlers fail fast
+		path := pathParameterPattern.ReplaceAllString(operation.Path, "0")
+
+		recorder := httptest.NewRecorder()
+		api.ServeHTTP(recorder, httptest.NewRequest(operation.Method, path, nil))
+		if open := recorder.Code != http.StatusUnauthorized; open != (len(operation.Role) == 0) {
+			t.Errorf("%s %s without key responded %d, documented role %q", operation.Method, path, recorder.Code, operation.Role)
+		}
+		if len(operation.Role) == 0 {
+			continue
+		}
+
+		recorder = httptest.NewRecorder()
+		request := httptest.NewRequest(operation.Method, path, strings.NewReader(""))
+		request.Header.Set(ApiKeyHeader, key)
+		api.ServeHTTP(recorder, request)
+		if forbidden := recorder.Code == http.StatusForbidden; forbidden != (operation.Role == database.AdminRole) {
+			t.Errorf("%s %s with read-only key responded %d, documented role %q", operation.Method, path, recorder.Code, operation.Role)
+		}
+	}
+}
+
+func TestOpenApiDocument(t *testing.T) {
+	api, _ := createTestApi(t)
+	recorder := httptest.NewRecorder()
+	api.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, OpenApiEndpoint, nil))
+
+	var document struct {
+		Paths      map[string]map[string]any `json:"paths"`
+		Components struct {
+			Schemas map[string]any `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &document); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := document.Paths["/analysis/jobs/{id}/cancel"]["post"]; !found {
+		t.Errorf("missing path parameters in %v", document.Paths)
+	}
+	// every referenced schema is defined
+	for _, ref := range strings.Split(recorder.Body.String(), `"$ref":"#/components/schemas/`)[1:] {
+		name := ref[:strings.Index(ref, `"`)]
+		if schema, found := document.Components.Schemas[name]; !found || schema == nil {
+			t.Errorf("schema %s is referenced but not defined", name)
+		}
+	}
+}
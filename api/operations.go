@@ -0,0 +1,399 @@
+package api
+
+import (
+	"hb-crawler/rating-gain/analysis"
+	"hb-crawler/rating-gain/database"
+	"hb-crawler/rating-gain/worker"
+	"net/http"
+)
+
+const (
+	IntegerParameter = "integer"
+	NumberParameter  = "number"
+	StringParameter  = "string"
+	BooleanParameter = "boolean"
+)
+
+type Parameter struct {
+	Name        string
+	Type        string
+	Description string
+	Required    bool
+}
+
+/*
+Operation documents one route of the API. The operations are the source of the
+OpenAPI document and of the generated client, and a test checks them against
+the registered routes.
+*/
+type Operation struct {
+	// operationId of the OpenAPI document and method name of the client
+	Id      string
+	Method  string
+	Path    string
+	Summary string
+	// role required to call the route, empty for open routes
+	Role       database.ApiKeyRole
+	PathParams []Parameter
+	Query      []Parameter
+	// value of the type of the JSON request body, nil without a JSON body
+	Body any
+	// content types of request bodies sent as is, e.g. uploaded files
+	Uploads []string
+	// value of the type of the data of JSON responses, nil if the route does not respond with JSON data
+	Response any
+	// status of successful responses, http.StatusOK if 0
+	Status int
+	// content types of other responses, e.g. CSV for ?format=csv
+	Produces []string
+}
+
+func (operation *Operation) SuccessStatus() int {
+	if operation.Status == 0 {
+		return http.StatusOK
+	}
+	return operation.Status
+}
+
+var (
+	activityParameter = Parameter{Name: "activity", Type: StringParameter, Description: "activity code: HI (hiking), VF (via ferrata), CL (climbing), SK (skiing) or BI (biking)"}
+	dryRunParameter   = Parameter{Name: "dry_run", Type: BooleanParameter, Description: "only plan the writes"}
+	idPathParameter   = Parameter{Name: "id", Type: IntegerParameter, Required: true}
+
+	pointGainsFilterParameters = []Parameter{
+		{Name: "event_id", Type: IntegerParameter, Description: "only samples of the event"},
+		{Name: "user_id", Type: IntegerParameter, Description: "only samples of the user"},
+		{Name: "from", Type: StringParameter, Description: "first day of the events, e.g. 2024-06-01"},
+		{Name: "to", Type: StringParameter, Description: "last day of the events, e.g. 2024-06-30"},
+		{Name: "min_route_points", Type: IntegerParameter, Description: "least route points"},
+		{Name: "max_route_points", Type: IntegerParameter, Description: "most route points"},
+		{Name: "complete", Type: BooleanParameter, Description: "true for samples with points after, false for dangling samples"},
+		activityParameter,
+		{Name: "limit", Type: IntegerParameter, Description: "number of samples, all samples if negative"},
+		{Name: "skip", Type: IntegerParameter, Description: "number of samples to skip"},
+	}
+
+	optimizeParameters = []Parameter{
+		{Name: "loss", Type: StringParameter, Description: "mae (default), mse, huber or exact"},
+		{Name: "huber_delta", Type: NumberParameter, Description: "residual size where the huber loss turns linear"},
+		{Name: "l2", Type: NumberParameter, Description: "weight of the L2 regularization"},
+		{Name: "method", Type: StringParameter, Description: "nelder-mead (default), bfgs or cmaes"},
+		{Name: "max_iterations", Type: IntegerParameter, Description: "limit of major iterations, at most 100000"},
+		{Name: "freeze", Type: StringParameter, Description: "comma separated params kept at their current values, e.g. A,B"},
+		{Name: "bootstrap", Type: IntegerParameter, Description: "number of refits on resampled samples, 2 to 1000"},
+		{Name: "confidence", Type: NumberParameter, Description: "coverage of the bootstrap intervals, defaults to 0.95"},
+		{Name: "bootstrap_seed", Type: IntegerParameter, Description: "seed of the resampling"},
+	}
+
+	modelParameter = Parameter{Name: "model", Type: StringParameter, Description: "model family to fit, defaults to the family of the active model"}
+
+	splitParameters = []Parameter{
+		{Name: "strategy", Type: StringParameter, Description: "random (default), date or event"},
+		{Name: "ratio", Type: NumberParameter, Description: "share of validation samples, defaults to 0.2"},
+		{Name: "seed", Type: IntegerParameter, Description: "seed of random and event splits"},
+	}
+)
+
+func concatParameters(groups ...[]Parameter) []Parameter {
+	parameters := []Parameter{}
+	for _, group := range groups {
+		parameters = append(parameters, group...)
+	}
+	return parameters
+}
+
+var operations = []Operation{
+	{
+		Id: "Healthcheck", Method: http.MethodGet, Path: "/healthcheck",
+		Summary:  "Check server health",
+		Response: "",
+	},
+	{
+		Id: "GetOpenApiDocument", Method: http.MethodGet, Path: OpenApiEndpoint,
+		Summary:  "OpenAPI document of the API",
+		Produces: []string{"application/json"},
+	},
+	{
+		Id: "GetDocs", Method: http.MethodGet, Path: DocsEndpoint,
+		Summary:  "Documentation page of the API",
+		Produces: []string{"text/html"},
+	},
+	{
+		Id: "ListPointGains", Method: http.MethodGet, Path: PointGainsEndpointRoot + PointGainsList,
+		Summary: "List samples page by page",
+		Role:    database.ReadOnlyRole,
+		Query: concatParameters(pointGainsFilterParameters, []Parameter{
+			{Name: "sort", Type: StringParameter, Description: "column to sort on, prefixed with - to sort descending, defaults to event_date"},
+			{Name: "cursor", Type: StringParameter, Description: "next_cursor of the previous page"},
+		}),
+		Response: PointGainsPage{},
+	},
+	{
+		Id: "GetSample", Method: http.MethodGet, Path: PointGainsEndpointRoot + PointsGainsSampleData,
+		Summary: "Complete samples with the scale and metrics of their route",
+		Role:    database.ReadOnlyRole,
+		Query: []Parameter{
+			activityParameter,
+			{Name: "limit", Type: IntegerParameter, Description: "number of samples, all samples by default"},
+			{Name: "format", Type: StringParameter, Description: "json (default) or csv"},
+		},
+		Response: []database.ReducedPointGainRecord{},
+		Produces: []string{"text/csv"},
+	},
+	{
+		Id: "GetEventPointGains", Method: http.MethodGet, Path: PointGainsEndpointRoot + PointGainsOfEvent,
+		Summary:    "Samples of an event",
+		Role:       database.ReadOnlyRole,
+		PathParams: []Parameter{idPathParameter},
+		Response:   []database.PointGainRecord{},
+	},
+	{
+		Id: "GetWorkerStatus", Method: http.MethodGet, Path: WorkerEndpoint + WorkerStatusEndpoint,
+		Summary:  "Status of the background workers",
+		Role:     database.ReadOnlyRole,
+		Response: map[string]*worker.WorkerStatus{},
+	},
+	{
+		Id: "StartWorkers", Method: http.MethodPost, Path: WorkerEndpoint + WorkerStartEndpoint,
+		Summary:  "Start all workers",
+		Role:     database.AdminRole,
+		Query:    []Parameter{dryRunParameter},
+		Response: map[string]*worker.WorkerStatus{},
+	},
+	{
+		Id: "StopWorkers", Method: http.MethodPost, Path: WorkerEndpoint + WorkerStopEndpoint,
+		Summary:  "Stop all workers",
+		Role:     database.AdminRole,
+		Response: map[string]*worker.WorkerStatus{},
+	},
+	{
+		Id: "RunWorker", Method: http.MethodPost, Path: WorkerEndpoint + WorkerRunEndpoint,
+		Summary:    "Run a worker once and report its writes, conflicts while the worker runs",
+		Role:       database.AdminRole,
+		PathParams: []Parameter{{Name: "id", Type: StringParameter, Required: true, Description: "worker id, e.g. past-event"}},
+		Query:      []Parameter{dryRunParameter},
+		Response:   worker.RunReport{},
+	},
+	{
+		Id: "GetWorkerReport", Method: http.MethodGet, Path: WorkerEndpoint + WorkerReportEndpoint,
+		Summary:    "Report of the last run of a worker",
+		Role:       database.ReadOnlyRole,
+		PathParams: []Parameter{{Name: "id", Type: StringParameter, Required: true, Description: "worker id, e.g. past-event"}},
+		Response:   worker.RunReport{},
+	},
+	{
+		Id: "ListCredentials", Method: http.MethodGet, Path: CredentialsEndpointRoot + CredentialsList,
+		Summary:  "Hiking Buddies accounts of the crawler, without passwords",
+		Role:     database.AdminRole,
+		Response: []database.Account{},
+	},
+	{
+		Id: "CreateCredential", Method: http.MethodPost, Path: CredentialsEndpointRoot + CredentialsCreateEndpoint,
+		Summary:  "Add a Hiking Buddies account",
+		Role:     database.AdminRole,
+		Body:     database.Account{},
+		Response: database.Account{},
+	},
+	{
+		Id: "Estimate", Method: http.MethodPost, Path: AnalysisEndpointRoot + EstimateEndpoint,
+		Summary:  "Estimate the points after of a sample with the active model",
+		Role:     database.ReadOnlyRole,
+		Body:     database.ReducedPointGainRecord{},
+		Response: Estimate{},
+	},
+	{
+		Id: "EstimateBatch", Method: http.MethodPost, Path: AnalysisEndpointRoot + EstimateBatchEndpoint,
+		Summary:  "Estimate the points after of many samples, sent as JSON or as CSV with a route_points,points_before[,scale] header",
+		Role:     database.ReadOnlyRole,
+		Query:    []Parameter{{Name: "format", Type: StringParameter, Description: "json (default) or csv"}},
+		Body:     []database.ReducedPointGainRecord{},
+		Uploads:  []string{"text/csv", "multipart/form-data"},
+		Response: []BatchEstimate{},
+		Produces: []string{"text/csv"},
+	},
+	{
+		Id: "Plan", Method: http.MethodGet, Path: AnalysisEndpointRoot + PlanEndpoint,
+		Summary: "Hikes a member needs to reach a target",
+		Role:    database.ReadOnlyRole,
+		Query: []Parameter{
+			{Name: "points_before", Type: IntegerParameter, Required: true, Description: "current points of the member"},
+			{Name: "target", Type: IntegerParameter, Required: true, Description: "points to reach"},
+			{Name: "max_route_points", Type: IntegerParameter, Description: "hardest route to consider, defaults to 1000, at most 5000"},
+			{Name: "max_hikes", Type: IntegerParameter, Description: "longest plan, defaults to 50, at most 100"},
+			{Name: "scale", Type: StringParameter, Description: "SAC scale of the planned routes"},
+		},
+		Response: analysis.HikePlan{},
+	},
+	{
+		Id: "Curve", Method: http.MethodGet, Path: AnalysisEndpointRoot + CurveEndpoint,
+		Summary: "Estimated points after across route points",
+		Role:    database.ReadOnlyRole,
+		Query: []Parameter{
+			{Name: "points_before", Type: IntegerParameter, Required: true, Description: "current points of the member"},
+			{Name: "from", Type: IntegerParameter, Description: "least route points, defaults to 0"},
+			{Name: "to", Type: IntegerParameter, Description: "most route points, defaults to 1000, at most 5000"},
+			{Name: "step", Type: IntegerParameter, Description: "route points between two points of the curve, defaults to 10, curves have at most 1000 points"},
+			{Name: "scale", Type: StringParameter, Description: "SAC scale of the routes"},
+		},
+		Response: []analysis.CurvePoint{},
+	},
+	{
+		Id: "Optimize", Method: http.MethodPost, Path: AnalysisEndpointRoot + OptimizeEndpoint,
+		Summary:  "Submit a job fitting and activating a new model",
+		Role:     database.AdminRole,
+		Query:    concatParameters([]Parameter{modelParameter}, optimizeParameters),
+		Response: OptimizeJob{},
+		Status:   http.StatusAccepted,
+	},
+	{
+		Id: "Validate", Method: http.MethodPost, Path: AnalysisEndpointRoot + ValidateEndpoint,
+		Summary: "Submit a job fitting the estimator on a train split and reporting train and validation metrics",
+		Role:    database.AdminRole,
+		Query: concatParameters([]Parameter{
+			modelParameter,
+			{Name: "validation", Type: StringParameter, Description: "holdout (default) or kfold"},
+			{Name: "k", Type: IntegerParameter, Description: "number of folds, 2 to 20, defaults to 5"},
+		}, splitParameters, optimizeParameters),
+		Response: OptimizeJob{},
+		Status:   http.StatusAccepted,
+	},
+	{
+		Id: "Compare", Method: http.MethodPost, Path: AnalysisEndpointRoot + CompareEndpoint,
+		Summary:  "Submit a job fitting every model family on the same split and ranking them by validation MAE",
+		Role:     database.AdminRole,
+		Query:    concatParameters(splitParameters, optimizeParameters),
+		Response: OptimizeJob{},
+		Status:   http.StatusAccepted,
+	},
+	{
+		Id: "Residuals", Method: http.MethodGet, Path: AnalysisEndpointRoot + ResidualsEndpoint,
+		Summary: "Residuals of the active model with aggregates and outliers",
+		Role:    database.ReadOnlyRole,
+		Query: []Parameter{
+			{Name: "threshold", Type: NumberParameter, Description: "scaled median absolute deviations beyond which samples are outliers, defaults to 3.5"},
+			activityParameter,
+			{Name: "format", Type: StringParameter, Description: "json (default) or csv"},
+			{Name: "view", Type: StringParameter, Description: "table of CSV exports: residuals (default), outliers or aggregates"},
+		},
+		Response: analysis.ResidualReport{},
+		Produces: []string{"text/csv"},
+	},
+	{
+		Id: "Dataset", Method: http.MethodGet, Path: AnalysisEndpointRoot + DatasetEndpoint,
+		Summary: "Health of the collected samples",
+		Role:    database.ReadOnlyRole,
+		Query: []Parameter{
+			{Name: "jump", Type: IntegerParameter, Description: "points changes between two samples of a user beyond which they are suspicious, defaults to 200"},
+			{Name: "format", Type: StringParameter, Description: "json (default) or html"},
+		},
+		Response: analysis.DatasetReport{},
+		Produces: []string{"text/html"},
+	},
+	{
+		Id: "ListJobs", Method: http.MethodGet, Path: AnalysisEndpointRoot + JobsEndpoint,
+		Summary:  "Optimize, validate and compare jobs since startup",
+		Role:     database.ReadOnlyRole,
+		Response: []OptimizeJob{},
+	},
+	{
+		Id: "GetJob", Method: http.MethodGet, Path: AnalysisEndpointRoot + JobEndpoint,
+		Summary:    "Progress and result of a job",
+		Role:       database.ReadOnlyRole,
+		PathParams: []Parameter{idPathParameter},
+		Response:   OptimizeJob{},
+	},
+	{
+		Id: "StreamJob", Method: http.MethodGet, Path: AnalysisEndpointRoot + JobStreamEndpoint,
+		Summary:    "Follow a job as server-sent events until it finishes",
+		Role:       database.ReadOnlyRole,
+		PathParams: []Parameter{idPathParameter},
+		Produces:   []string{"text/event-stream"},
+	},
+	{
+		Id: "CancelJob", Method: http.MethodPost, Path: AnalysisEndpointRoot + JobCancelEndpoint,
+		Summary:    "Cancel a running job",
+		Role:       database.AdminRole,
+		PathParams: []Parameter{idPathParameter},
+		Response:   OptimizeJob{},
+	},
+	{
+		Id: "ListModels", Method: http.MethodGet, Path: AnalysisEndpointRoot + ModelsEndpoint,
+		Summary:  "Stored models",
+		Role:     database.ReadOnlyRole,
+		Response: []database.ModelRecord{},
+	},
+	{
+		Id: "DiffModels", Method: http.MethodGet, Path: AnalysisEndpointRoot + ModelDiffEndpoint,
+		Summary: "Compare the parameters and losses of two models",
+		Role:    database.ReadOnlyRole,
+		Query: []Parameter{
+			{Name: "from", Type: IntegerParameter, Required: true, Description: "id of the first model"},
+			{Name: "to", Type: IntegerParameter, Required: true, Description: "id of the second model"},
+		},
+		Response: analysis.ModelDiff{},
+	},
+	{
+		Id: "ActivateModel", Method: http.MethodPost, Path: AnalysisEndpointRoot + ModelActivateEndpoint,
+		Summary:    "Use a stored model as the active estimator",
+		Role:       database.AdminRole,
+		PathParams: []Parameter{idPathParameter},
+		Response:   database.ModelRecord{},
+	},
+	{
+		Id: "RollbackModel", Method: http.MethodPost, Path: AnalysisEndpointRoot + ModelRollbackEndpoint,
+		Summary:  "Re-activate the previously active model",
+		Role:     database.AdminRole,
+		Response: database.ModelRecord{},
+	},
+	{
+		Id: "Recommend", Method: http.MethodGet, Path: RecommendationsEndpointRoot + RecommendationsList,
+		Summary: "Upcoming events ranked by the gain the active model predicts for a member",
+		Role:    database.ReadOnlyRole,
+		Query: []Parameter{
+			{Name: "user_id", Type: IntegerParameter, Required: true, Description: "member to recommend events to"},
+			{Name: "points", Type: IntegerParameter, Description: "current points of the member, defaults to the latest known points"},
+			{Name: "from", Type: StringParameter, Description: "first day of the events, e.g. 2024-06-01"},
+			{Name: "to", Type: StringParameter, Description: "last day of the events, e.g. 2024-06-30"},
+			{Name: "scale", Type: StringParameter, Description: "comma separated SAC scales, e.g. T2,T3"},
+			activityParameter,
+			{Name: "min_distance", Type: NumberParameter, Description: "shortest route"},
+			{Name: "max_distance", Type: NumberParameter, Description: "longest route"},
+			{Name: "limit", Type: IntegerParameter, Description: "number of recommendations"},
+		},
+		Response: []Recommendation{},
+	},
+	{
+		Id: "ListExportDatasets", Method: http.MethodGet, Path: ExportEndpointRoot + ExportDatasetList,
+		Summary:  "Exportable datasets with their columns",
+		Role:     database.ReadOnlyRole,
+		Response: []database.ExportDataset{},
+	},
+	{
+		Id: "Export", Method: http.MethodGet, Path: ExportEndpointRoot + ExportDataset,
+		Summary:    "Stream a dataset from the database",
+		Role:       database.ReadOnlyRole,
+		PathParams: []Parameter{{Name: "dataset", Type: StringParameter, Required: true, Description: "point-gains, routes, events or users"}},
+		Query: concatParameters([]Parameter{
+			{Name: "format", Type: StringParameter, Description: "csv (default), ndjson or parquet"},
+			{Name: "columns", Type: StringParameter, Description: "comma separated columns to export, all columns by default"},
+		}, pointGainsFilterParameters),
+		Produces: []string{"text/csv", "application/x-ndjson", "application/vnd.apache.parquet"},
+	},
+	{
+		Id: "Import", Method: http.MethodPost, Path: ImportEndpointRoot + ImportData,
+		Summary: "Merge another instance's database or dataset export",
+		Role:    database.AdminRole,
+		Query: []Parameter{
+			{Name: "format", Type: StringParameter, Description: "sqlite, csv or ndjson, inferred from the name of an uploaded file otherwise"},
+			{Name: "dataset", Type: StringParameter, Description: "dataset of csv and ndjson exports"},
+			{Name: "dry_run", Type: BooleanParameter, Description: "report the changes without keeping them"},
+		},
+		Uploads:  []string{"application/octet-stream", "text/csv", "application/x-ndjson", "multipart/form-data"},
+		Response: database.ImportReport{},
+	},
+}
+
+// Operations returns the documented operations of the API.
+func Operations() []Operation {
+	return operations
+}
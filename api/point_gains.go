@@ -1,12 +1,12 @@
 package api
 
 import (
-	"bytes"
-	"encoding/csv"
 	"hb-crawler/rating-gain/database"
+	hb "hb-crawler/rating-gain/hiking-buddies"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
@@ -23,9 +23,33 @@ type PointGainsApiHandler struct {
 	repo *database.DatabaseRepository
 }
 
-func getPointsGainQueryParams(c *gin.Context) *database.PointGainsQuery {
+// records per page of /point-gains unless the limit is given
+const DefaultPointGainsPageSize = 100
+
+type PointGainsPage struct {
+	Records *[]database.PointGainRecord `json:"records"`
+	// samples matching the filters on all pages
+	Total      int     `json:"total"`
+	NextCursor *string `json:"next_cursor"`
+	// link to the next page, nil on the last page
+	Next *string `json:"next"`
+}
+
+func parseIntQueryParam(c *gin.Context, name string) (*int, error) {
+	value := c.Query(name)
+	if len(value) == 0 {
+		return nil, nil
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, &ParameterError{Parameter: name, Message: "must be integer"}
+	}
+	return &number, nil
+}
+
+func getPointsGainQueryParams(c *gin.Context) (*database.PointGainsQuery, error) {
 	params := database.PointGainsQuery{
-		Limit: -1,
+		Limit: DefaultPointGainsPageSize,
 		Skip:  0,
 	}
 
@@ -37,59 +61,169 @@ func getPointsGainQueryParams(c *gin.Context) *database.PointGainsQuery {
 		params.Skip = skip
 	}
 
-	return &params
+	var err error
+	if params.Activity, err = getActivityQueryParam(c); err != nil {
+		return nil, err
+	}
+	if params.EventId, err = parseIntQueryParam(c, "event_id"); err != nil {
+		return nil, err
+	}
+	if params.UserId, err = parseIntQueryParam(c, "user_id"); err != nil {
+		return nil, err
+	}
+	if params.MinRoutePoints, err = parseIntQueryParam(c, "min_route_points"); err != nil {
+		return nil, err
+	}
+	if params.MaxRoutePoints, err = parseIntQueryParam(c, "max_route_points"); err != nil {
+		return nil, err
+	}
+	from, err := parseDateQueryParam(c, "from")
+	if err != nil {
+		return nil, err
+	}
+	if from != nil {
+		unix := from.Unix()
+		params.From = &unix
+	}
+	to, err := parseDateQueryParam(c, "to")
+	if err != nil {
+		return nil, err
+	}
+	if to != nil {
+		// dates without time include the whole day
+		unix := to.Add(24 * time.Hour).Unix()
+		params.Before = &unix
+	}
+	if complete := c.Query("complete"); len(complete) > 0 {
+		value, err := strconv.ParseBool(complete)
+		if err != nil {
+			return nil, &ParameterError{Parameter: "complete", Message: "must be true or false"}
+		}
+		params.Complete = &value
+	}
+	// a leading minus sorts descending, e.g. -event_date
+	params.Sort = strings.TrimPrefix(c.Query("sort"), "-")
+	params.Descending = strings.HasPrefix(c.Query("sort"), "-")
+	if cursor := c.Query("cursor"); len(cursor) > 0 {
+		if params.Cursor, err = database.DecodePointGainsCursor(cursor); err != nil {
+			return nil, &ParameterError{Parameter: "cursor", Message: "is malformed"}
+		}
+	}
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &params, nil
 }
 
+// getActivityQueryParam returns the activity code to filter by, or an empty string for all activities.
+func getActivityQueryParam(c *gin.Context) (string, error) {
+	code := c.Query("activity")
+	if len(code) == 0 {
+		return "", nil
+	}
+	activity, err := hb.ParseActivity(code)
+	if err != nil {
+		return "", &ParameterError{Parameter: "activity", Message: "must be an activity code, e.g. HI"}
+	}
+	return string(activity), nil
+}
+
+/*
+Lists samples page by page.
+
+Query parameters:
+  - event_id, user_id: only samples of the event or user
+  - from, to: first and last day of the events, e.g. 2024-06-01
+  - min_route_points, max_route_points: inclusive range of the route points
+  - complete: true for samples with points after, false for dangling samples
+  - activity: activity code, e.g. HI
+  - sort: column to sort on, prefixed with a minus to sort descending, defaults to event_date
+  - limit: samples per page, defaults to 100, all samples if negative
+  - cursor: next_cursor of the previous page
+*/
 func (handler *PointGainsApiHandler) pointGainsListHandler(c *gin.Context) {
-	params := getPointsGainQueryParams(c)
+	params, err := getPointsGainQueryParams(c)
+	if err != nil {
+		reportInvalidParameter(c, err)
+		return
+	}
+
+	total, err := handler.repo.PointGains.CountPointGains(params)
+	if err != nil {
+		reportError(c, http.StatusInternalServerError, InternalErrorCode, "failed to retrieve data")
+		return
+	}
+	// fetch one more record to know whether there is a next page
+	pageSize := params.Limit
+	if pageSize > 0 {
+		params.Limit++
+	}
 	records, err := handler.repo.PointGains.GetAllPointGains(params)
 
 	if err != nil {
-		reportError(c, http.StatusInternalServerError, "failed to retrieve data")
+		reportError(c, http.StatusInternalServerError, InternalErrorCode, "failed to retrieve data")
 		return
 	}
 
-	sendJSONPayload(c, http.StatusOK, records)
+	page := PointGainsPage{Records: records, Total: total}
+	if pageSize > 0 && len(*records) > pageSize {
+		*records = (*records)[:pageSize]
+		cursor := params.NextCursor(&(*records)[pageSize-1]).Encode()
+		query := c.Request.URL.Query()
+		query.Set("cursor", cursor)
+		// the cursor replaces skipping
+		query.Del("skip")
+		next := c.Request.URL.Path + "?" + query.Encode()
+		page.NextCursor, page.Next = &cursor, &next
+	}
+	sendJSONPayload(c, http.StatusOK, page)
 }
 
 func (handler *PointGainsApiHandler) pointGainsOfEventHandler(c *gin.Context) {
 	paramIdString := c.Params.ByName("id")
 	id, err := strconv.Atoi(paramIdString)
 	if err != nil {
-		reportError(c, http.StatusBadRequest, "id must be integer")
+		reportInvalidParameter(c, &ParameterError{Parameter: "id", Message: "must be integer"})
 		return
 	}
 	records, err := handler.repo.PointGains.GetPointGainsByEventId(id)
 	if err != nil {
-		reportError(c, http.StatusInternalServerError, "failed to retrieve data")
+		reportError(c, http.StatusInternalServerError, InternalErrorCode, "failed to retrieve data")
 		return
 	}
 	sendJSONPayload(c, http.StatusOK, records)
 }
 
-func returnSampleAsCSV(c *gin.Context, pointGains *[]database.ReducedPointGainRecord) {
-	buffer := new(bytes.Buffer)
-	w := csv.NewWriter(buffer)
-	if err := w.Write([]string{"route_points", "points_before", "points_after"}); err != nil {
-		reportError(c, http.StatusInternalServerError, "Failed to generate CSV")
-		return
+// formatOptionalFloat leaves unknown values empty in CSV exports.
+func formatOptionalFloat(value *float64) string {
+	if value == nil {
+		return ""
 	}
-	w.Flush()
+	return strconv.FormatFloat(*value, 'f', -1, 64)
+}
 
+func returnSampleAsCSV(c *gin.Context, pointGains *[]database.ReducedPointGainRecord) {
+	rows := [][]string{}
 	for _, gain := range *pointGains {
-		if err := w.Write([]string{
-			strconv.Itoa(gain.RoutePoints), strconv.Itoa(gain.UserPointsBefore), strconv.Itoa(gain.UserPointsAfter),
-		}); err != nil {
-			reportError(c, http.StatusInternalServerError, "Failed to generate CSV")
+		scale := ""
+		if gain.Scale != nil {
+			scale = *gain.Scale
 		}
-		w.Flush()
-	}
-	c.Writer.Header().Set("Content-Type", "text/csv")
-	c.Writer.Header().Set("Content-Disposition", "attachment;filename=hb_point_gain_sample.csv")
-	_, err := c.Writer.Write(buffer.Bytes())
-	if err != nil {
-		reportError(c, http.StatusInternalServerError, "Failed to generate CSV")
+		route := gain.Route
+		rows = append(rows, []string{
+			strconv.Itoa(gain.RoutePoints), strconv.Itoa(gain.UserPointsBefore), strconv.Itoa(gain.UserPointsAfter), scale,
+			formatOptionalFloat(route.Elevation), formatOptionalFloat(route.Distance),
+			formatOptionalFloat(route.ElevationGain), formatOptionalFloat(route.ElevationLoss),
+			formatOptionalFloat(route.T1Distance), formatOptionalFloat(route.T2Distance), formatOptionalFloat(route.T3Distance),
+			formatOptionalFloat(route.T4Distance), formatOptionalFloat(route.T5Distance), formatOptionalFloat(route.T6Distance),
+		})
 	}
+	sendCSVPayload(c, "hb_point_gain_sample.csv", []string{
+		"route_points", "points_before", "points_after", "scale",
+		"elevation", "distance", "elevation_gain", "elevation_loss",
+		"t1_distance", "t2_distance", "t3_distance", "t4_distance", "t5_distance", "t6_distance",
+	}, rows)
 }
 
 func (handler *PointGainsApiHandler) pointGainsSampleDataHandler(c *gin.Context) {
@@ -101,9 +235,17 @@ func (handler *PointGainsApiHandler) pointGainsSampleDataHandler(c *gin.Context)
 	if len(format) == 0 {
 		format = "json"
 	}
-	records, err := handler.repo.PointGains.GetValidPointsGainEntry(&limit)
+	activity, err := getActivityQueryParam(c)
+	if err != nil {
+		reportInvalidParameter(c, err)
+		return
+	}
+	records, err := handler.repo.PointGains.GetValidPointsGainEntry(&database.ValidPointGainsQuery{
+		Limit:    limit,
+		Activity: activity,
+	})
 	if err != nil {
-		reportError(c, http.StatusInternalServerError, "Failed to retrieve data")
+		reportError(c, http.StatusInternalServerError, InternalErrorCode, "Failed to retrieve data")
 		return
 	}
 	logrus.Infof("Records: %d", len(*records))
@@ -116,13 +258,13 @@ func (handler *PointGainsApiHandler) pointGainsSampleDataHandler(c *gin.Context)
 		returnSampleAsCSV(c, records)
 		return
 	default:
-		reportError(c, http.StatusBadRequest, "Unknown format")
+		reportInvalidParameter(c, &ParameterError{Parameter: "format", Message: "must be json or csv"})
 		return
 	}
 }
 
-func (handler *PointGainsApiHandler) Register(api *gin.Engine) {
-	router := api.Group(PointGainsEndpointRoot)
+func (handler *PointGainsApiHandler) Register(groups *RouteGroups) {
+	router, _ := groups.Group(PointGainsEndpointRoot)
 	router.GET(PointGainsList, handler.pointGainsListHandler)
 	router.GET(PointsGainsSampleData, handler.pointGainsSampleDataHandler)
 	router.GET(PointGainsOfEvent, handler.pointGainsOfEventHandler)
@@ -0,0 +1,276 @@
+package api
+
+import (
+	"hb-crawler/rating-gain/analysis"
+	"hb-crawler/rating-gain/database"
+	hb "hb-crawler/rating-gain/hiking-buddies"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	RecommendationsEndpointRoot = "/recommendations"
+	RecommendationsList         = "/"
+)
+
+type RecommendationsApiHandler struct {
+	repo   *database.DatabaseRepository
+	events *hb.UpcomingEventCache
+	// returns the active model of the analysis API
+	active func() *analysis.FittedModel
+	// limiter of the workers, so that recommendations do not add to their requests unchecked
+	rateLimiter *hb.RateLimiter
+	// returns the last session of the workers, nil if they have not logged in recently
+	session func() *hb.CookieCredential
+	// fetches the current points of a member, hb.FetchUserPoints if nil
+	fetchUserPoints func(userId int, credential *hb.CookieCredential) (*int, error)
+}
+
+type Recommendation struct {
+	EventId      int         `json:"event_id"`
+	Title        string      `json:"title"`
+	Start        time.Time   `json:"start"`
+	Activity     hb.Activity `json:"activity"`
+	RouteId      int         `json:"route_id"`
+	RouteName    string      `json:"route_name"`
+	Scale        string      `json:"scale"`
+	Distance     float64     `json:"distance"`
+	RoutePoints  int         `json:"route_points"`
+	PointsBefore int         `json:"points_before"`
+	PointsAfter  float64     `json:"points_after"`
+	Gain         float64     `json:"gain"`
+}
+
+type recommendationFilter struct {
+	from, to    *time.Time
+	scales      map[string]bool
+	activity    hb.Activity
+	minDistance *float64
+	maxDistance *float64
+}
+
+func parseDateQueryParam(c *gin.Context, name string) (*time.Time, error) {
+	value := c.Query(name)
+	if len(value) == 0 {
+		return nil, nil
+	}
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		if date, err := time.Parse(layout, value); err == nil {
+			return &date, nil
+		}
+	}
+	return nil, &ParameterError{Parameter: name, Message: "must be a date like 2024-06-01"}
+}
+
+func parseFloatQueryParam(c *gin.Context, name string) (*float64, error) {
+	value := c.Query(name)
+	if len(value) == 0 {
+		return nil, nil
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, &ParameterError{Parameter: name, Message: "must be a number"}
+	}
+	return &number, nil
+}
+
+func getRecommendationFilter(c *gin.Context) (*recommendationFilter, error) {
+	filter := recommendationFilter{scales: map[string]bool{}}
+	var err error
+	if filter.from, err = parseDateQueryParam(c, "from"); err != nil {
+		return nil, err
+	}
+	if filter.to, err = parseDateQueryParam(c, "to"); err != nil {
+		return nil, err
+	}
+	if filter.minDistance, err = parseFloatQueryParam(c, "min_distance"); err != nil {
+		return nil, err
+	}
+	if filter.maxDistance, err = parseFloatQueryParam(c, "max_distance"); err != nil {
+		return nil, err
+	}
+	if code := c.Query("activity"); len(code) > 0 {
+		if filter.activity, err = hb.ParseActivity(code); err != nil {
+			return nil, err
+		}
+	}
+	if scales := c.Query("scale"); len(scales) > 0 {
+		for _, scale := range strings.Split(scales, ",") {
+			filter.scales[strings.ToUpper(strings.TrimSpace(scale))] = true
+		}
+	}
+	return &filter, nil
+}
+
+func (filter *recommendationFilter) matches(event *hb.Event) bool {
+	if filter.from != nil && event.Start.Before(*filter.from) {
+		return false
+	}
+	// dates without time include the whole day
+	if filter.to != nil && !event.Start.Before(filter.to.Add(24*time.Hour)) {
+		return false
+	}
+	if len(filter.activity) > 0 && event.Activity != filter.activity {
+		return false
+	}
+	if len(filter.scales) > 0 && !filter.scales[strings.ToUpper(event.Route.SacScale)] {
+		return false
+	}
+	if filter.minDistance != nil && event.Route.Distance < *filter.minDistance {
+		return false
+	}
+	if filter.maxDistance != nil && event.Route.Distance > *filter.maxDistance {
+		return false
+	}
+	return true
+}
+
+/*
+getUserPoints prefers the points query parameter, then fetches the current
+points of the user, and falls back to the latest sample of the user if fetching
+fails, as samples may be outdated.
+*/
+func (handler *RecommendationsApiHandler) getUserPoints(
+	c *gin.Context,
+	userId int,
+	credential *hb.CookieCredential,
+) (*int, error) {
+	if points, err := strconv.Atoi(c.Query("points")); err == nil {
+		return &points, nil
+	}
+	fetch := handler.fetchUserPoints
+	if fetch == nil {
+		fetch = hb.FetchUserPoints
+	}
+	handler.rateLimiter.Wait()
+	fetched, fetchErr := fetch(userId, credential)
+	if fetchErr == nil {
+		return fetched, nil
+	}
+	logrus.Warnf("Failed to fetch points of user %d, using their latest sample: %+v\n", userId, fetchErr)
+	points, err := handler.repo.PointGains.GetLatestUserPoints(userId)
+	if err != nil {
+		return nil, err
+	}
+	if points == nil {
+		return nil, fetchErr
+	}
+	return points, nil
+}
+
+/*
+Ranks upcoming events by the gain the active model predicts for the user.
+
+Query parameters:
+  - user_id: member to recommend events to
+  - points: current points of the member, defaults to the latest known points
+  - from, to: first and last day of the events, e.g. 2024-06-01
+  - scale: comma separated SAC scales, e.g. T2,T3
+  - activity: activity code, e.g. HI
+  - min_distance, max_distance: distance range of the routes
+  - limit: number of recommendations
+*/
+func (handler *RecommendationsApiHandler) recommendationsHandler(c *gin.Context) {
+	userId, err := strconv.Atoi(c.Query("user_id"))
+	if err != nil {
+		reportInvalidParameter(c, &ParameterError{Parameter: "user_id", Message: "must be integer"})
+		return
+	}
+	filter, err := getRecommendationFilter(c)
+	if err != nil {
+		reportInvalidParameter(c, err)
+		return
+	}
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 {
+		limit = -1
+	}
+
+	credential := handler.session()
+	if credential == nil {
+		reportError(c, http.StatusServiceUnavailable, UpstreamUnavailableCode, "no Hiking Buddies session, the workers have not logged in recently")
+		return
+	}
+	points, err := handler.getUserPoints(c, userId, credential)
+	if err != nil {
+		logrus.Warnf("Failed to get points of user %d: %+v\n", userId, err)
+		reportError(c, http.StatusBadGateway, UpstreamUnavailableCode, "failed to get the points of the user")
+		return
+	}
+	events, err := handler.events.Get(credential)
+	if err != nil {
+		logrus.Warnf("Failed to fetch upcoming events: %+v\n", err)
+		reportError(c, http.StatusBadGateway, UpstreamUnavailableCode, "failed to fetch upcoming events")
+		return
+	}
+
+	active := handler.active()
+	recommendations := []Recommendation{}
+	for i := range events {
+		event := &events[i]
+		if !filter.matches(event) {
+			continue
+		}
+		routeRecord := event.Route.ToRouteRecord()
+		if err := hb.GetRoutePoints(&hb.GetRoutePointsParams{
+			Repo:       handler.repo.Route,
+			Id:         event.Route.RouteID,
+			Record:     routeRecord,
+			Credential: credential,
+			Limiter:    handler.rateLimiter,
+		}); err != nil || routeRecord.Points == nil {
+			logrus.Warnf("Skipping event %d without route points: %+v\n", event.ID, err)
+			continue
+		}
+
+		// filled like the samples the model is fitted on
+		scale := routeRecord.Scale
+		sample := database.ReducedPointGainRecord{
+			RoutePoints:      *routeRecord.Points,
+			UserPointsBefore: *points,
+			EventId:          event.ID,
+			EventDate:        event.Start.Unix(),
+			UserId:           userId,
+			EventTitle:       &event.Title,
+			RouteId:          &routeRecord.Id,
+			RouteName:        &routeRecord.Name,
+			Scale:            &scale,
+			Route:            routeRecord.Features(),
+		}
+		pointsAfter := math.Round(active.Predict(&sample))
+		recommendations = append(recommendations, Recommendation{
+			EventId:      event.ID,
+			Title:        event.Title,
+			Start:        event.Start,
+			Activity:     event.Activity,
+			RouteId:      event.Route.RouteID,
+			RouteName:    event.Route.RouteTitle,
+			Scale:        event.Route.SacScale,
+			Distance:     event.Route.Distance,
+			RoutePoints:  *routeRecord.Points,
+			PointsBefore: *points,
+			PointsAfter:  pointsAfter,
+			Gain:         pointsAfter - float64(*points),
+		})
+	}
+
+	sort.SliceStable(recommendations, func(i, j int) bool {
+		return recommendations[i].Gain > recommendations[j].Gain
+	})
+	if limit > 0 && len(recommendations) > limit {
+		recommendations = recommendations[:limit]
+	}
+	sendJSONPayload(c, http.StatusOK, recommendations)
+}
+
+func (handler *RecommendationsApiHandler) Register(groups *RouteGroups) {
+	router, _ := groups.Group(RecommendationsEndpointRoot)
+	router.GET(RecommendationsList, handler.recommendationsHandler)
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"fmt"
+	"hb-crawler/rating-gain/database"
+	hb "hb-crawler/rating-gain/hiking-buddies"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRecommendationsGetUserPoints(t *testing.T) {
+	_, repo := createTestApi(t)
+	before := 100
+	if err := repo.PointGains.CreatePointsGainEntry(&database.PointGainRecord{
+		EventId: 1, UserId: 7, RoutePoints: 50, UserPointsBefore: &before, EventDate: 1000,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	fetched, given := 150, 80
+	var fetchErr error
+	handler := RecommendationsApiHandler{
+		repo: repo,
+		fetchUserPoints: func(userId int, credential *hb.CookieCredential) (*int, error) {
+			if fetchErr != nil {
+				return nil, fetchErr
+			}
+			return &fetched, nil
+		},
+	}
+	getUserPoints := func(userId int, query string) (*int, error) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/recommendations/?"+query, nil)
+		return handler.getUserPoints(c, userId, nil)
+	}
+
+	tests := []struct {
+		name     string
+		userId   int
+		query    string
+		fetchErr error
+		expected *int
+	}{
+		{"points parameter", 7, "points=80", nil, &given},
+		{"fetched points over samples", 7, "", nil, &fetched},
+		{"latest sample if fetching fails", 7, "", fmt.Errorf("offline"), &before},
+		{"no sample and fetching fails", 8, "", fmt.Errorf("offline"), nil},
+	}
+	for _, test := range tests {
+		fetchErr = test.fetchErr
+		points, err := getUserPoints(test.userId, test.query)
+		if test.expected == nil {
+			if err == nil {
+				t.Errorf("%s: got %v points, expected an error", test.name, *points)
+			}
+			continue
+		}
+		if err != nil || points == nil || *points != *test.expected {
+			t.Errorf("%s: got %v, %v, expected %d", test.name, points, err, *test.expected)
+		}
+	}
+}
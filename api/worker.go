@@ -1,10 +1,13 @@
 package api
 
 import (
+	"errors"
 	"hb-crawler/rating-gain/worker"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
 )
 
 const (
@@ -12,6 +15,8 @@ const (
 	WorkerStatusEndpoint = "/status"
 	WorkerStartEndpoint  = "/start"
 	WorkerStopEndpoint   = "/stop"
+	WorkerRunEndpoint    = "/:id/run"
+	WorkerReportEndpoint = "/:id/report"
 )
 
 type WorkerApiHandler struct {
@@ -19,11 +24,35 @@ type WorkerApiHandler struct {
 }
 
 func (handler *WorkerApiHandler) workerStatusHandler(c *gin.Context) {
-	status := handler.workerGroup.GetAllWorkerStatus()
-	c.JSON(http.StatusOK, status)
+	sendJSONPayload(c, http.StatusOK, handler.workerGroup.GetAllWorkerStatus())
+}
+
+// getDryRunQueryParam reads the optional dry_run parameter, nil if it is missing.
+func getDryRunQueryParam(c *gin.Context) (*bool, error) {
+	value := c.Query("dry_run")
+	if len(value) == 0 {
+		return nil, nil
+	}
+	dryRun, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, &ParameterError{Parameter: "dry_run", Message: "must be boolean"}
+	}
+	return &dryRun, nil
 }
 
+// workerStartHandler starts the workers, changing their dry-run mode only if dry_run is passed.
 func (handler *WorkerApiHandler) workerStartHandler(c *gin.Context) {
+	dryRun, err := getDryRunQueryParam(c)
+	if err != nil {
+		reportInvalidParameter(c, err)
+		return
+	}
+	if dryRun != nil {
+		if err := handler.workerGroup.SetDryRun(*dryRun); err != nil {
+			reportError(c, http.StatusConflict, ConflictCode, err.Error())
+			return
+		}
+	}
 	handler.workerGroup.Start()
 	sendJSONPayload(c, http.StatusOK, handler.workerGroup.GetAllWorkerStatus())
 }
@@ -33,9 +62,50 @@ func (handler *WorkerApiHandler) workerStopHandler(c *gin.Context) {
 	sendJSONPayload(c, http.StatusOK, handler.workerGroup.GetAllWorkerStatus())
 }
 
-func (handler *WorkerApiHandler) Register(api *gin.Engine) {
-	router := api.Group(WorkerEndpoint)
+func (handler *WorkerApiHandler) workerRunHandler(c *gin.Context) {
+	w, err := handler.workerGroup.GetWorker(c.Params.ByName("id"))
+	if err != nil {
+		reportError(c, http.StatusNotFound, NotFoundCode, "worker not found")
+		return
+	}
+
+	dryRun, err := getDryRunQueryParam(c)
+	if err != nil {
+		reportInvalidParameter(c, err)
+		return
+	}
+	report, err := w.RunOnce(dryRun != nil && *dryRun)
+	if errors.Is(err, worker.ErrRunInProgress) {
+		reportError(c, http.StatusConflict, ConflictCode, err.Error())
+		return
+	}
+	if err != nil {
+		logrus.Warnf("Failed to run worker: %+v\n", err)
+		// the report lists the writes made before the run failed
+		reportErrorDetails(c, http.StatusInternalServerError, ApiError{
+			Code:    InternalErrorCode,
+			Message: "worker run failed: " + err.Error(),
+			Data:    report,
+		})
+		return
+	}
+	sendJSONPayload(c, http.StatusOK, report)
+}
+
+func (handler *WorkerApiHandler) workerReportHandler(c *gin.Context) {
+	worker, err := handler.workerGroup.GetWorker(c.Params.ByName("id"))
+	if err != nil {
+		reportError(c, http.StatusNotFound, NotFoundCode, "worker not found")
+		return
+	}
+	sendJSONPayload(c, http.StatusOK, worker.LastReport())
+}
+
+func (handler *WorkerApiHandler) Register(groups *RouteGroups) {
+	router, admin := groups.Group(WorkerEndpoint)
 	router.GET(WorkerStatusEndpoint, handler.workerStatusHandler)
-	router.POST(WorkerStartEndpoint, handler.workerStartHandler)
-	router.POST(WorkerStopEndpoint, handler.workerStopHandler)
+	admin.POST(WorkerStartEndpoint, handler.workerStartHandler)
+	admin.POST(WorkerStopEndpoint, handler.workerStopHandler)
+	admin.POST(WorkerRunEndpoint, handler.workerRunHandler)
+	router.GET(WorkerReportEndpoint, handler.workerReportHandler)
 }
@@ -0,0 +1,40 @@
+package backup
+
+import (
+	"errors"
+	"os"
+)
+
+// ErrDatabaseInUse is returned while another process holds the lock of the database.
+var ErrDatabaseInUse = errors.New("database is in use by a running crawler, stop it first")
+
+/*
+DatabaseLock is an exclusive lock on a file next to the database, held by the
+running crawler for its whole lifetime and by restores while they replace the
+database. The operating system releases it when the process exits.
+*/
+type DatabaseLock struct {
+	file *os.File
+}
+
+func lockPath(databasePath string) string {
+	return databasePath + ".lock"
+}
+
+// LockDatabase takes the lock of the database without waiting, or returns ErrDatabaseInUse.
+func LockDatabase(databasePath string) (*DatabaseLock, error) {
+	file, err := os.OpenFile(lockPath(databasePath), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(file); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &DatabaseLock{file: file}, nil
+}
+
+// Unlock releases the lock, the lock file is kept for the next holder.
+func (lock *DatabaseLock) Unlock() error {
+	return lock.file.Close()
+}
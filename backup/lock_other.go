@@ -0,0 +1,10 @@
+//go:build !unix
+
+package backup
+
+import "os"
+
+// lockFile cannot lock without flock, so restores rely on the crawler being stopped as documented.
+func lockFile(file *os.File) error {
+	return nil
+}
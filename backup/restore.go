@@ -0,0 +1,134 @@
+package backup
+
+import (
+	"compress/gzip"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hb-crawler/rating-gain/database"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+func decompressFile(source string, destination string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	reader, err := gzip.NewReader(in)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	out, err := os.Create(destination)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, reader)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+/*
+ValidateDatabase checks that the SQLite file is intact and has a schema this
+version of the crawler can migrate, and returns its schema version. Databases
+with an older schema are migrated on the next start.
+*/
+func ValidateDatabase(path string) (int, error) {
+	if _, err := os.Stat(path); err != nil {
+		return 0, err
+	}
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?mode=ro", path))
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	integrity := ""
+	if err := db.QueryRow("PRAGMA integrity_check").Scan(&integrity); err != nil {
+		return 0, fmt.Errorf("not a readable SQLite database: %w", err)
+	}
+	if integrity != "ok" {
+		return 0, fmt.Errorf("integrity check failed: %s", integrity)
+	}
+	version, err := database.GetSchemaVersion(db)
+	if err != nil {
+		return 0, err
+	}
+	if version == 0 {
+		return 0, fmt.Errorf("database has no schema version, it was not written by the crawler")
+	}
+	if version > database.SchemaVersion {
+		return 0, fmt.Errorf("schema version %d is newer than the supported version %d", version, database.SchemaVersion)
+	}
+	return version, nil
+}
+
+/*
+removeSidecarFiles removes the rollback journal, write-ahead log and shared
+memory files SQLite keeps next to a database. Left next to a replaced database,
+SQLite would apply them to the new file.
+*/
+func removeSidecarFiles(path string) error {
+	for _, suffix := range []string{"-journal", "-wal", "-shm"} {
+		if err := os.Remove(path + suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+Restore replaces the database file with the snapshot once the snapshot is
+validated. The snapshot is decompressed next to the database, so that the
+final rename swaps the file atomically. The database must not be open while
+it is replaced: restoring fails with ErrDatabaseInUse while a crawler holds
+the lock of the database.
+
+Returns the schema version of the snapshot.
+*/
+func Restore(snapshotPath string, databasePath string) (int, error) {
+	lock, err := LockDatabase(databasePath)
+	if err != nil {
+		return 0, err
+	}
+	defer lock.Unlock()
+	return RestoreLocked(lock, snapshotPath, databasePath)
+}
+
+// RestoreLocked restores like Restore while the caller already holds the lock of the database.
+func RestoreLocked(lock *DatabaseLock, snapshotPath string, databasePath string) (int, error) {
+	restored, err := os.CreateTemp(filepath.Dir(databasePath), ".restore-*.sqlite")
+	if err != nil {
+		return 0, err
+	}
+	restored.Close()
+	defer os.Remove(restored.Name())
+	// validating opens the snapshot read-only, which leaves its WAL files behind
+	defer removeSidecarFiles(restored.Name())
+
+	if err := decompressFile(snapshotPath, restored.Name()); err != nil {
+		return 0, fmt.Errorf("failed to decompress snapshot: %w", err)
+	}
+	version, err := ValidateDatabase(restored.Name())
+	if err != nil {
+		return 0, fmt.Errorf("invalid snapshot %s: %w", snapshotPath, err)
+	}
+	// keep the permissions of the replaced file rather than those of the temporary one
+	if info, err := os.Stat(databasePath); err == nil {
+		if err := os.Chmod(restored.Name(), info.Mode().Perm()); err != nil {
+			return 0, err
+		}
+	}
+	if err := removeSidecarFiles(databasePath); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(restored.Name(), databasePath); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
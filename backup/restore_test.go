@@ -0,0 +1,188 @@
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"hb-crawler/rating-gain/database"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// createTestDatabase returns the path of a migrated database holding the given number of samples.
+func createTestDatabase(t *testing.T, directory string, samples int) string {
+	path := filepath.Join(directory, "db.sqlite")
+	db, err := database.InitializeDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	repo := database.GetRepository(db)
+	for i := 0; i < samples; i++ {
+		before := 100
+		if err := repo.PointGains.CreatePointsGainEntry(&database.PointGainRecord{
+			EventId: i, UserId: 7, RoutePoints: 50, UserPointsBefore: &before, EventDate: 1000,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+func countSamples(t *testing.T, path string) int {
+	db, err := database.InitializeDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	count, err := database.GetRepository(db).PointGains.CountPointGains(&database.PointGainsQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func snapshotTestDatabase(t *testing.T, path string, directory string) string {
+	db, err := database.InitializeDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	snapshot, err := CreateSnapshot(db, directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return snapshot.Path
+}
+
+func writeCompressed(t *testing.T, path string, data []byte) {
+	buffer := bytes.Buffer{}
+	writer := gzip.NewWriter(&buffer)
+	writer.Write(data)
+	writer.Close()
+	if err := os.WriteFile(path, buffer.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	directory := t.TempDir()
+	path := createTestDatabase(t, directory, 2)
+	snapshot := snapshotTestDatabase(t, path, filepath.Join(directory, DefaultDirectoryName))
+
+	snapshots, err := ListSnapshots(filepath.Join(directory, DefaultDirectoryName))
+	if err != nil || len(snapshots) != 1 || snapshots[0].Path != snapshot {
+		t.Fatalf("listed %+v, %v", snapshots, err)
+	}
+	// changes after the snapshot are undone by restoring it
+	os.Remove(path)
+	createTestDatabase(t, directory, 5)
+
+	version, err := Restore(snapshot, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != database.SchemaVersion {
+		t.Errorf("restored schema version %d, expected %d", version, database.SchemaVersion)
+	}
+	if count := countSamples(t, path); count != 2 {
+		t.Errorf("restored %d samples, expected 2", count)
+	}
+}
+
+func TestRestoreRejectsInvalidSnapshots(t *testing.T) {
+	directory := t.TempDir()
+	path := createTestDatabase(t, directory, 3)
+	valid := snapshotTestDatabase(t, path, directory)
+	original, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compressed, _ := os.ReadFile(valid)
+	truncated := filepath.Join(directory, "truncated.sqlite.gz")
+	os.WriteFile(truncated, compressed[:len(compressed)/2], 0o644)
+
+	garbage := filepath.Join(directory, "garbage.sqlite.gz")
+	writeCompressed(t, garbage, bytes.Repeat([]byte("not a database "), 500))
+
+	plain := filepath.Join(directory, "plain.sqlite.gz")
+	os.WriteFile(plain, original, 0o644)
+
+	// a snapshot of a newer build
+	newerPath := filepath.Join(t.TempDir(), "db.sqlite")
+	newer, err := database.InitializeDatabase(newerPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newer.Exec(fmt.Sprintf("PRAGMA user_version = %d", database.SchemaVersion+1)); err != nil {
+		t.Fatal(err)
+	}
+	newerSnapshot, err := CreateSnapshot(newer, t.TempDir())
+	newer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, snapshot := range []string{truncated, garbage, plain, newerSnapshot.Path, filepath.Join(directory, "missing.sqlite.gz")} {
+		if _, err := Restore(snapshot, path); err == nil {
+			t.Errorf("restored %s", filepath.Base(snapshot))
+		}
+		if current, _ := os.ReadFile(path); !bytes.Equal(current, original) {
+			t.Fatalf("restoring %s changed the database", filepath.Base(snapshot))
+		}
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(directory, ".restore-*")); len(leftovers) > 0 {
+		t.Errorf("left %v behind", leftovers)
+	}
+}
+
+func TestRestoreRefusesLockedDatabase(t *testing.T) {
+	directory := t.TempDir()
+	path := createTestDatabase(t, directory, 1)
+	snapshot := snapshotTestDatabase(t, path, directory)
+
+	lock, err := LockDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LockDatabase(path); !errors.Is(err, ErrDatabaseInUse) {
+		t.Errorf("locked a locked database: %v", err)
+	}
+	if _, err := Restore(snapshot, path); !errors.Is(err, ErrDatabaseInUse) {
+		t.Errorf("restore of a locked database returned %v, expected %v", err, ErrDatabaseInUse)
+	}
+
+	if err := lock.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Restore(snapshot, path); err != nil {
+		t.Errorf("restore after unlocking failed: %v", err)
+	}
+}
+
+func TestRestoreRemovesStaleJournal(t *testing.T) {
+	directory := t.TempDir()
+	path := createTestDatabase(t, directory, 2)
+	snapshot := snapshotTestDatabase(t, path, t.TempDir())
+	// left behind by a crawler that crashed in the middle of a transaction
+	for _, suffix := range []string{"-journal", "-wal"} {
+		if err := os.WriteFile(path+suffix, []byte("stale"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := Restore(snapshot, path); err != nil {
+		t.Fatal(err)
+	}
+	for _, suffix := range []string{"-journal", "-wal"} {
+		if _, err := os.Stat(path + suffix); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("kept the stale %s file: %v", suffix, err)
+		}
+	}
+	if count := countSamples(t, path); count != 2 {
+		t.Errorf("restored %d samples, expected 2", count)
+	}
+}
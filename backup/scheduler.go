@@ -0,0 +1,125 @@
+package backup
+
+import (
+	"database/sql"
+	"hb-crawler/rating-gain/logging"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultInterval  = 24 * time.Hour
+	DefaultRetention = 7
+	// directory next to the database snapshots are written to by default
+	DefaultDirectoryName = "backups"
+)
+
+type SchedulerConfig struct {
+	// directory the snapshots are written to
+	Directory string
+	// time between two snapshots, 0 disables scheduled snapshots
+	Interval time.Duration
+	// number of snapshots kept, older ones are deleted after each snapshot
+	Retention int
+}
+
+func DefaultSchedulerConfig(databasePath string) *SchedulerConfig {
+	return &SchedulerConfig{
+		Directory: filepath.Join(filepath.Dir(databasePath), DefaultDirectoryName),
+		Interval:  DefaultInterval,
+		Retention: DefaultRetention,
+	}
+}
+
+type Scheduler struct {
+	db        *sql.DB
+	config    *SchedulerConfig
+	logger    *log.Logger
+	waitGroup *sync.WaitGroup
+	stop      chan struct{}
+	stopOnce  sync.Once
+}
+
+func CreateScheduler(db *sql.DB, waitGroup *sync.WaitGroup, config *SchedulerConfig) *Scheduler {
+	return &Scheduler{
+		db:     db,
+		config: config,
+		logger: logging.GetLogger(&logging.LoggerConfig{
+			Prefix: "backup",
+		}),
+		waitGroup: waitGroup,
+		stop:      make(chan struct{}),
+	}
+}
+
+// Run takes a snapshot and deletes the snapshots beyond the retention.
+func (s *Scheduler) Run() (*Snapshot, error) {
+	snapshot, err := CreateSnapshot(s.db, s.config.Directory)
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Infof("Wrote snapshot %s (%d bytes)", snapshot.Path, snapshot.Size)
+	pruned, err := PruneSnapshots(s.config.Directory, s.config.Retention)
+	if err != nil {
+		return snapshot, err
+	}
+	for _, old := range pruned {
+		s.logger.Infof("Deleted snapshot %s", old.Path)
+	}
+	return snapshot, nil
+}
+
+// nextRun returns how long to wait for the next snapshot, continuing the schedule of the latest snapshot.
+func (s *Scheduler) nextRun() time.Duration {
+	snapshots, err := ListSnapshots(s.config.Directory)
+	if err != nil || len(snapshots) == 0 {
+		return 0
+	}
+	wait := time.Until(snapshots[0].CreatedAt.Add(s.config.Interval))
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+/*
+Start takes snapshots every interval until stopped. The first snapshot is due
+one interval after the latest snapshot in the directory, so restarts do not
+delay or multiply snapshots.
+*/
+func (s *Scheduler) Start() {
+	if s.config.Interval <= 0 {
+		s.logger.Info("Scheduled snapshots are disabled")
+		return
+	}
+	s.logger.Infof("Writing snapshots to %s every %s, keeping %d", s.config.Directory, s.config.Interval, s.config.Retention)
+	s.waitGroup.Add(1)
+
+	go func() {
+		defer s.waitGroup.Done()
+		timer := time.NewTimer(s.nextRun())
+		defer timer.Stop()
+		for {
+			select {
+			case <-s.stop:
+				s.logger.Info("Snapshots stopped.")
+				return
+			case <-timer.C:
+			}
+			if _, err := s.Run(); err != nil {
+				s.logger.Errorf("Failed to write snapshot: %+v\n", err)
+			}
+			timer.Reset(s.config.Interval)
+		}
+	}()
+}
+
+// Stop stops scheduled snapshots, letting a snapshot in progress finish.
+func (s *Scheduler) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+}
@@ -0,0 +1,197 @@
+package backup
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+const (
+	snapshotPrefix     = "db-"
+	snapshotExtension  = ".sqlite.gz"
+	snapshotTimeLayout = "20060102T150405.000Z"
+)
+
+type Snapshot struct {
+	Path      string    `json:"path"`
+	CreatedAt time.Time `json:"created_at"`
+	Size      int64     `json:"size"`
+}
+
+func snapshotName(createdAt time.Time) string {
+	return snapshotPrefix + createdAt.UTC().Format(snapshotTimeLayout) + snapshotExtension
+}
+
+// parseSnapshotName returns the creation time of a snapshot file, or false for other files.
+func parseSnapshotName(name string) (time.Time, bool) {
+	if !strings.HasPrefix(name, snapshotPrefix) || !strings.HasSuffix(name, snapshotExtension) {
+		return time.Time{}, false
+	}
+	timestamp := strings.TrimSuffix(strings.TrimPrefix(name, snapshotPrefix), snapshotExtension)
+	createdAt, err := time.Parse(snapshotTimeLayout, timestamp)
+	return createdAt, err == nil
+}
+
+// rawConn runs f with the SQLite connection underneath a connection of the pool.
+func rawConn(ctx context.Context, db *sql.DB, f func(conn *sqlite3.SQLiteConn) error) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Raw(func(driverConn any) error {
+		sqliteConn, ok := driverConn.(*sqlite3.SQLiteConn)
+		if !ok {
+			return fmt.Errorf("not a SQLite connection")
+		}
+		return f(sqliteConn)
+	})
+}
+
+/*
+copyDatabase writes a consistent copy of the database to a new SQLite file
+using the online backup API. The copy is taken in a single step, so writers
+wait for it instead of restarting it.
+*/
+func copyDatabase(db *sql.DB, path string) error {
+	destination, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	defer destination.Close()
+
+	ctx := context.Background()
+	return rawConn(ctx, destination, func(destinationConn *sqlite3.SQLiteConn) error {
+		return rawConn(ctx, db, func(sourceConn *sqlite3.SQLiteConn) error {
+			backup, err := destinationConn.Backup("main", sourceConn, "main")
+			if err != nil {
+				return err
+			}
+			if _, err := backup.Step(-1); err != nil {
+				backup.Finish()
+				return err
+			}
+			return backup.Finish()
+		})
+	})
+}
+
+func compressFile(source string, destination string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(destination)
+	if err != nil {
+		return err
+	}
+	writer := gzip.NewWriter(out)
+	_, err = io.Copy(writer, in)
+	if closeErr := writer.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+/*
+CreateSnapshot writes a gzip compressed copy of the database to the directory,
+named after the time it was taken. The snapshot only appears under its final
+name once it is complete, and existing snapshots are never overwritten.
+*/
+func CreateSnapshot(db *sql.DB, directory string) (*Snapshot, error) {
+	if err := os.MkdirAll(directory, 0o755); err != nil {
+		return nil, err
+	}
+	createdAt := time.Now().UTC().Truncate(time.Millisecond)
+	path := filepath.Join(directory, snapshotName(createdAt))
+	if _, err := os.Stat(path); err == nil {
+		return nil, fmt.Errorf("snapshot %s already exists", path)
+	}
+
+	copied, err := os.CreateTemp(directory, ".snapshot-*.sqlite")
+	if err != nil {
+		return nil, err
+	}
+	copied.Close()
+	defer os.Remove(copied.Name())
+	if err := copyDatabase(db, copied.Name()); err != nil {
+		return nil, fmt.Errorf("failed to copy database: %w", err)
+	}
+
+	compressed := copied.Name() + ".gz"
+	defer os.Remove(compressed)
+	if err := compressFile(copied.Name(), compressed); err != nil {
+		return nil, fmt.Errorf("failed to compress snapshot: %w", err)
+	}
+	if err := os.Rename(compressed, path); err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Snapshot{Path: path, CreatedAt: createdAt, Size: info.Size()}, nil
+}
+
+// ListSnapshots returns the snapshots in the directory, newest first.
+func ListSnapshots(directory string) ([]Snapshot, error) {
+	entries, err := os.ReadDir(directory)
+	if os.IsNotExist(err) {
+		return []Snapshot{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	snapshots := []Snapshot{}
+	for _, entry := range entries {
+		createdAt, ok := parseSnapshotName(entry.Name())
+		if !ok || entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, Snapshot{
+			Path:      filepath.Join(directory, entry.Name()),
+			CreatedAt: createdAt,
+			Size:      info.Size(),
+		})
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].CreatedAt.After(snapshots[j].CreatedAt)
+	})
+	return snapshots, nil
+}
+
+// PruneSnapshots deletes all but the newest keep snapshots of the directory and returns the deleted ones.
+func PruneSnapshots(directory string, keep int) ([]Snapshot, error) {
+	snapshots, err := ListSnapshots(directory)
+	if err != nil {
+		return nil, err
+	}
+	if keep < 0 || len(snapshots) <= keep {
+		return []Snapshot{}, nil
+	}
+	pruned := snapshots[keep:]
+	for _, snapshot := range pruned {
+		if err := os.Remove(snapshot.Path); err != nil {
+			return nil, err
+		}
+	}
+	return pruned, nil
+}
@@ -0,0 +1,171 @@
+/*
+Package client is a typed client of the crawler API for scripts.
+
+The methods in operations.go and the types in types.go are generated from
+api.Operations, run go generate ./client after changing the operations. The
+client does not import the crawler, so it builds without cgo.
+*/
+package client
+
+//go:generate go run ./generate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+type Client struct {
+	BaseURL    string
+	ApiKey     string
+	HTTPClient *http.Client
+}
+
+func CreateClient(baseURL string, apiKey string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		ApiKey:     apiKey,
+		HTTPClient: http.DefaultClient,
+	}
+}
+
+// Error is returned for responses with an error status.
+type Error struct {
+	StatusCode int
+	// empty if the response was no error payload of the API, e.g. from a proxy
+	Code      ErrorCode
+	Message   string
+	Details   []ErrorDetail
+	RequestId string
+	// result of the work done before the error as JSON, e.g. the RunReport of a failed worker run
+	Data json.RawMessage
+}
+
+func (err *Error) Error() string {
+	message := fmt.Sprintf("%d %s: %s", err.StatusCode, http.StatusText(err.StatusCode), err.Message)
+	if len(err.Code) > 0 {
+		message = fmt.Sprintf("%d %s: %s: %s", err.StatusCode, http.StatusText(err.StatusCode), err.Code, err.Message)
+	}
+	if len(err.RequestId) > 0 {
+		message += " (request " + err.RequestId + ")"
+	}
+	return message
+}
+
+func readError(response *http.Response) error {
+	defer response.Body.Close()
+	body, _ := io.ReadAll(response.Body)
+	clientError := Error{
+		StatusCode: response.StatusCode,
+		Message:    strings.TrimSpace(string(body)),
+		RequestId:  response.Header.Get(RequestIdHeader),
+	}
+	var payload ErrorPayload
+	if err := json.Unmarshal(body, &payload); err == nil && len(payload.Error.Code) > 0 {
+		clientError.Code = payload.Error.Code
+		clientError.Message = payload.Error.Message
+		clientError.Details = payload.Error.Details
+		clientError.RequestId = payload.RequestId
+		// decoded again to keep the data raw
+		var data struct {
+			Error struct {
+				Data json.RawMessage `json:"data"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(body, &data) == nil {
+			clientError.Data = data.Error.Data
+		}
+	}
+	return &clientError
+}
+
+/*
+Do sends a request with the API key and returns the response if its status is
+successful, an *Error otherwise. The caller must close the body of the response.
+*/
+func (client *Client) Do(
+	ctx context.Context,
+	method string,
+	path string,
+	query url.Values,
+	body io.Reader,
+	contentType string,
+) (*http.Response, error) {
+	target := client.BaseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	request, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	if len(contentType) > 0 {
+		request.Header.Set("Content-Type", contentType)
+	}
+	if len(client.ApiKey) > 0 {
+		request.Header.Set(ApiKeyHeader, client.ApiKey)
+	}
+
+	response, err := client.HTTPClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode >= http.StatusBadRequest {
+		return nil, readError(response)
+	}
+	return response, nil
+}
+
+// call sends the body as JSON, unless nil, and decodes the data of the JSON response into data.
+func (client *Client) call(ctx context.Context, method string, path string, query url.Values, body any, data any) error {
+	var reader io.Reader
+	contentType := ""
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+		contentType = "application/json"
+	}
+	response, err := client.Do(ctx, method, path, query, reader, contentType)
+	if err != nil {
+		return err
+	}
+	return decodePayload(response, data)
+}
+
+func decodePayload(response *http.Response, data any) error {
+	defer response.Body.Close()
+	payload := struct {
+		Data any `json:"data"`
+	}{Data: data}
+	if err := json.NewDecoder(response.Body).Decode(&payload); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+var pathParameterPattern = regexp.MustCompile(`:\w+`)
+
+// expandPath replaces the parameters of a route path, e.g. :id, by the values in their order.
+func expandPath(pattern string, values ...any) string {
+	i := 0
+	return pathParameterPattern.ReplaceAllStringFunc(pattern, func(string) string {
+		value := url.PathEscape(fmt.Sprint(values[i]))
+		i++
+		return value
+	})
+}
+
+func addQuery[T any](query url.Values, name string, value *T) {
+	if value != nil {
+		query.Set(name, fmt.Sprint(*value))
+	}
+}
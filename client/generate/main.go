@@ -0,0 +1,318 @@
+// Generates the methods of the client from the operations of the API, see go generate ./client.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"hb-crawler/rating-gain/api"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	outputFile = "operations.go"
+	typesFile  = "types.go"
+	// named types of the module are generated into typesFile, so that the client does not depend on the crawler
+	modulePath = "hb-crawler/rating-gain/"
+)
+
+// import names of the packages whose names differ from their directory
+var importNames = map[string]string{
+	"hb-crawler/rating-gain/hiking-buddies": "hb",
+}
+
+type generator struct {
+	buffer  bytes.Buffer
+	imports map[string]string
+	// names in the client of the named types of the module, in the order of their first use
+	typeNames map[reflect.Type]string
+	types     []reflect.Type
+}
+
+func (g *generator) printf(format string, args ...any) {
+	fmt.Fprintf(&g.buffer, format, args...)
+}
+
+func packageName(path string) string {
+	name, found := importNames[path]
+	if !found {
+		name = path[strings.LastIndex(path, "/")+1:]
+	}
+	return name
+}
+
+func (g *generator) importName(path string) string {
+	name := packageName(path)
+	g.imports[path] = name
+	return name
+}
+
+// clientTypeName returns the name of a type of the module in the client, prefixed by its package if the name is taken.
+func (g *generator) clientTypeName(t reflect.Type) string {
+	if name, found := g.typeNames[t]; found {
+		return name
+	}
+	name := t.Name()
+	for _, taken := range g.typeNames {
+		if taken == name {
+			name = fieldName(packageName(t.PkgPath())) + name
+			break
+		}
+	}
+	g.typeNames[t] = name
+	g.types = append(g.types, t)
+	return name
+}
+
+// typeName returns the Go expression of the type, importing the packages of named types of the standard library.
+func (g *generator) typeName(t reflect.Type) string {
+	if len(t.Name()) > 0 {
+		switch {
+		case len(t.PkgPath()) == 0:
+			return t.Name()
+		case strings.HasPrefix(t.PkgPath(), modulePath):
+			return g.clientTypeName(t)
+		case strings.Contains(strings.Split(t.PkgPath(), "/")[0], "."):
+			log.Fatalf("The client cannot depend on %s of %s\n", t.Name(), t.PkgPath())
+		}
+		return g.importName(t.PkgPath()) + "." + t.Name()
+	}
+	return g.underlyingType(t)
+}
+
+// underlyingType returns the Go expression of the type without its name.
+func (g *generator) underlyingType(t reflect.Type) string {
+	if t.Kind() <= reflect.Complex128 || t.Kind() == reflect.String {
+		return t.Kind().String()
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return "*" + g.typeName(t.Elem())
+	case reflect.Slice:
+		return "[]" + g.typeName(t.Elem())
+	case reflect.Map:
+		return "map[" + g.typeName(t.Key()) + "]" + g.typeName(t.Elem())
+	case reflect.Interface:
+		return "any"
+	case reflect.Struct:
+		return g.structType(t)
+	}
+	log.Fatalf("Unsupported type %s\n", t)
+	return ""
+}
+
+// structType returns the struct of the fields encoded as JSON, with their json tags.
+func (g *generator) structType(t reflect.Type) string {
+	fields := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		// the fields of embedded structs are encoded even if their type is unexported
+		if (!field.IsExported() && !field.Anonymous) || tag == "-" {
+			continue
+		}
+		line := g.typeName(field.Type)
+		if !field.Anonymous {
+			line = field.Name + " " + line
+		}
+		if len(tag) > 0 {
+			line += fmt.Sprintf(" `json:%q`", tag)
+		}
+		fields = append(fields, line)
+	}
+	return "struct {\n" + strings.Join(fields, "\n") + "\n}"
+}
+
+// typeDeclarations declares the named types used by the operations, and the types used by their fields.
+func (g *generator) typeDeclarations() {
+	g.printf("const (\n")
+	g.printf("ApiKeyHeader = %q\n", api.ApiKeyHeader)
+	g.printf("RequestIdHeader = %q\n", api.RequestIdHeader)
+	g.printf(")\n\n")
+	g.printf("const (\n")
+	for _, code := range api.ErrorCodes() {
+		g.printf("%sCode %s = %q\n", fieldName(string(code)), g.typeName(reflect.TypeOf(code)), code)
+	}
+	g.printf(")\n\n")
+	// declaring a type may add the types of its fields
+	for i := 0; i < len(g.types); i++ {
+		t := g.types[i]
+		g.printf("// %s is %s.%s of the API.\n", g.typeNames[t], t.PkgPath()[len(modulePath):], t.Name())
+		g.printf("type %s %s\n\n", g.typeNames[t], g.underlyingType(t))
+	}
+}
+
+var parameterTypes = map[string]string{
+	api.IntegerParameter: "int",
+	api.NumberParameter:  "float64",
+	api.StringParameter:  "string",
+	api.BooleanParameter: "bool",
+}
+
+// fieldName turns a snake case parameter name into an exported field name, e.g. event_id into EventId.
+func fieldName(name string) string {
+	words := strings.Split(name, "_")
+	for i, word := range words {
+		words[i] = strings.ToUpper(word[:1]) + word[1:]
+	}
+	return strings.Join(words, "")
+}
+
+func (g *generator) paramsStruct(operation *api.Operation) {
+	g.printf("// %sParams are the query parameters of %s.\n", operation.Id, operation.Id)
+	g.printf("type %sParams struct {\n", operation.Id)
+	for _, parameter := range operation.Query {
+		if len(parameter.Description) > 0 {
+			g.printf("// %s\n", parameter.Description)
+		}
+		g.printf("%s *%s\n", fieldName(parameter.Name), parameterTypes[parameter.Type])
+	}
+	g.printf("}\n\n")
+}
+
+func (g *generator) method(operation *api.Operation) {
+	arguments := []string{"ctx context.Context"}
+	pathValues := []string{fmt.Sprintf("%q", operation.Path)}
+	for _, parameter := range operation.PathParams {
+		arguments = append(arguments, parameter.Name+" "+parameterTypes[parameter.Type])
+		pathValues = append(pathValues, parameter.Name)
+	}
+	if len(operation.Query) > 0 {
+		arguments = append(arguments, fmt.Sprintf("params *%sParams", operation.Id))
+	}
+	body := "nil"
+	if operation.Body != nil {
+		bodyType := reflect.TypeOf(operation.Body)
+		if bodyType.Kind() == reflect.Struct {
+			bodyType = reflect.PointerTo(bodyType)
+		}
+		arguments = append(arguments, "body "+g.typeName(bodyType))
+		body = "body"
+	} else if len(operation.Uploads) > 0 {
+		arguments = append(arguments, "body io.Reader", "contentType string")
+	}
+
+	result := "*http.Response"
+	var responseType reflect.Type
+	if operation.Response != nil {
+		responseType = reflect.TypeOf(operation.Response)
+		result = g.typeName(responseType)
+		if responseType.Kind() == reflect.Struct {
+			result = "*" + result
+		}
+	}
+
+	g.printf("// %s calls %s %s: %s.\n", operation.Id, operation.Method, operation.Path, operation.Summary)
+	if operation.Response == nil {
+		g.printf("// The caller must close the body of the response.\n")
+	}
+	g.printf("func (client *Client) %s(%s) (%s, error) {\n", operation.Id, strings.Join(arguments, ", "), result)
+	g.printf("path := expandPath(%s)\n", strings.Join(pathValues, ", "))
+	g.printf("query := url.Values{}\n")
+	if len(operation.Query) > 0 {
+		g.printf("if params != nil {\n")
+		for _, parameter := range operation.Query {
+			g.printf("addQuery(query, %q, params.%s)\n", parameter.Name, fieldName(parameter.Name))
+		}
+		g.printf("}\n")
+	}
+
+	method := "http.Method" + strings.ToUpper(operation.Method[:1]) + strings.ToLower(operation.Method[1:])
+	if operation.Response == nil {
+		if operation.Body == nil && len(operation.Uploads) > 0 {
+			g.printf("return client.Do(ctx, %s, path, query, body, contentType)\n", method)
+		} else {
+			g.printf("return client.Do(ctx, %s, path, query, nil, \"\")\n", method)
+		}
+		g.printf("}\n\n")
+		return
+	}
+
+	// result on errors, the zero value of data for types without nil
+	failed := "nil"
+	switch responseType.Kind() {
+	case reflect.Struct, reflect.Slice, reflect.Map, reflect.Pointer, reflect.Interface:
+	default:
+		failed = "data"
+	}
+	if operation.Body == nil && len(operation.Uploads) > 0 {
+		g.printf("var data %s\n", g.typeName(responseType))
+		g.printf("response, err := client.Do(ctx, %s, path, query, body, contentType)\n", method)
+		g.printf("if err != nil {\nreturn %s, err\n}\n", failed)
+		g.printf("if err := decodePayload(response, &data); err != nil {\nreturn %s, err\n}\n", failed)
+	} else {
+		g.printf("var data %s\n", g.typeName(responseType))
+		g.printf("if err := client.call(ctx, %s, path, query, %s, &data); err != nil {\nreturn %s, err\n}\n", method, body, failed)
+	}
+	if responseType.Kind() == reflect.Struct {
+		g.printf("return &data, nil\n")
+	} else {
+		g.printf("return data, nil\n")
+	}
+	g.printf("}\n\n")
+}
+
+// write formats the source of the buffer with the imports into the file.
+func (g *generator) write(file string) {
+	paths := []string{}
+	for path := range g.imports {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	header := bytes.Buffer{}
+	header.WriteString("// Code generated by go run ./generate; DO NOT EDIT.\n\npackage client\n\n")
+	if len(paths) > 0 {
+		header.WriteString("import (\n")
+		for _, path := range paths {
+			name := g.imports[path]
+			if name == path[strings.LastIndex(path, "/")+1:] {
+				fmt.Fprintf(&header, "%q\n", path)
+			} else {
+				fmt.Fprintf(&header, "%s %q\n", name, path)
+			}
+		}
+		header.WriteString(")\n\n")
+	}
+
+	source, err := format.Source(append(header.Bytes(), g.buffer.Bytes()...))
+	if err != nil {
+		log.Fatalf("Failed to format %s: %+v\n", file, err)
+	}
+	if err := os.WriteFile(file, source, 0o644); err != nil {
+		log.Fatalf("Failed to write %s: %+v\n", file, err)
+	}
+}
+
+func main() {
+	g := generator{
+		imports: map[string]string{
+			"context":  "context",
+			"net/http": "http",
+			"net/url":  "url",
+		},
+		typeNames: map[reflect.Type]string{},
+	}
+	// the client decodes error responses
+	g.typeName(reflect.TypeOf(api.ErrorPayload{}))
+	for _, operation := range api.Operations() {
+		if len(operation.Query) > 0 {
+			g.paramsStruct(&operation)
+		}
+		g.method(&operation)
+	}
+	if bytes.Contains(g.buffer.Bytes(), []byte("io.Reader")) {
+		g.imports["io"] = "io"
+	}
+
+	g.write(outputFile)
+
+	g.buffer.Reset()
+	g.imports = map[string]string{}
+	g.typeDeclarations()
+	g.write(typesFile)
+}
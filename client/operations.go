@@ -0,0 +1,763 @@
+// Code generated by go run ./generate; DO NOT EDIT.
+
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// Healthcheck calls GET /healthcheck: Check server health.
+func (client *Client) Healthcheck(ctx context.Context) (string, error) {
+	path := expandPath("/healthcheck")
+	query := url.Values{}
+	var data string
+	if err := client.call(ctx, http.MethodGet, path, query, nil, &data); err != nil {
+		return data, err
+	}
+	return data, nil
+}
+
+// GetOpenApiDocument calls GET /openapi.json: OpenAPI document of the API.
+// The caller must close the body of the response.
+func (client *Client) GetOpenApiDocument(ctx context.Context) (*http.Response, error) {
+	path := expandPath("/openapi.json")
+	query := url.Values{}
+	return client.Do(ctx, http.MethodGet, path, query, nil, "")
+}
+
+// GetDocs calls GET /docs: Documentation page of the API.
+// The caller must close the body of the response.
+func (client *Client) GetDocs(ctx context.Context) (*http.Response, error) {
+	path := expandPath("/docs")
+	query := url.Values{}
+	return client.Do(ctx, http.MethodGet, path, query, nil, "")
+}
+
+// ListPointGainsParams are the query parameters of ListPointGains.
+type ListPointGainsParams struct {
+	// only samples of the event
+	EventId *int
+	// only samples of the user
+	UserId *int
+	// first day of the events, e.g. 2024-06-01
+	From *string
+	// last day of the events, e.g. 2024-06-30
+	To *string
+	// least route points
+	MinRoutePoints *int
+	// most route points
+	MaxRoutePoints *int
+	// true for samples with points after, false for dangling samples
+	Complete *bool
+	// activity code: HI (hiking), VF (via ferrata), CL (climbing), SK (skiing) or BI (biking)
+	Activity *string
+	// number of samples, all samples if negative
+	Limit *int
+	// number of samples to skip
+	Skip *int
+	// column to sort on, prefixed with - to sort descending, defaults to event_date
+	Sort *string
+	// next_cursor of the previous page
+	Cursor *string
+}
+
+// ListPointGains calls GET /point-gains/: List samples page by page.
+func (client *Client) ListPointGains(ctx context.Context, params *ListPointGainsParams) (*PointGainsPage, error) {
+	path := expandPath("/point-gains/")
+	query := url.Values{}
+	if params != nil {
+		addQuery(query, "event_id", params.EventId)
+		addQuery(query, "user_id", params.UserId)
+		addQuery(query, "from", params.From)
+		addQuery(query, "to", params.To)
+		addQuery(query, "min_route_points", params.MinRoutePoints)
+		addQuery(query, "max_route_points", params.MaxRoutePoints)
+		addQuery(query, "complete", params.Complete)
+		addQuery(query, "activity", params.Activity)
+		addQuery(query, "limit", params.Limit)
+		addQuery(query, "skip", params.Skip)
+		addQuery(query, "sort", params.Sort)
+		addQuery(query, "cursor", params.Cursor)
+	}
+	var data PointGainsPage
+	if err := client.call(ctx, http.MethodGet, path, query, nil, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// GetSampleParams are the query parameters of GetSample.
+type GetSampleParams struct {
+	// activity code: HI (hiking), VF (via ferrata), CL (climbing), SK (skiing) or BI (biking)
+	Activity *string
+	// number of samples, all samples by default
+	Limit *int
+	// json (default) or csv
+	Format *string
+}
+
+// GetSample calls GET /point-gains/sample: Complete samples with the scale and metrics of their route.
+func (client *Client) GetSample(ctx context.Context, params *GetSampleParams) ([]ReducedPointGainRecord, error) {
+	path := expandPath("/point-gains/sample")
+	query := url.Values{}
+	if params != nil {
+		addQuery(query, "activity", params.Activity)
+		addQuery(query, "limit", params.Limit)
+		addQuery(query, "format", params.Format)
+	}
+	var data []ReducedPointGainRecord
+	if err := client.call(ctx, http.MethodGet, path, query, nil, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// GetEventPointGains calls GET /point-gains/event/:id: Samples of an event.
+func (client *Client) GetEventPointGains(ctx context.Context, id int) ([]PointGainRecord, error) {
+	path := expandPath("/point-gains/event/:id", id)
+	query := url.Values{}
+	var data []PointGainRecord
+	if err := client.call(ctx, http.MethodGet, path, query, nil, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// GetWorkerStatus calls GET /worker/status: Status of the background workers.
+func (client *Client) GetWorkerStatus(ctx context.Context) (map[string]*WorkerStatus, error) {
+	path := expandPath("/worker/status")
+	query := url.Values{}
+	var data map[string]*WorkerStatus
+	if err := client.call(ctx, http.MethodGet, path, query, nil, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// StartWorkersParams are the query parameters of StartWorkers.
+type StartWorkersParams struct {
+	// only plan the writes
+	DryRun *bool
+}
+
+// StartWorkers calls POST /worker/start: Start all workers.
+func (client *Client) StartWorkers(ctx context.Context, params *StartWorkersParams) (map[string]*WorkerStatus, error) {
+	path := expandPath("/worker/start")
+	query := url.Values{}
+	if params != nil {
+		addQuery(query, "dry_run", params.DryRun)
+	}
+	var data map[string]*WorkerStatus
+	if err := client.call(ctx, http.MethodPost, path, query, nil, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// StopWorkers calls POST /worker/stop: Stop all workers.
+func (client *Client) StopWorkers(ctx context.Context) (map[string]*WorkerStatus, error) {
+	path := expandPath("/worker/stop")
+	query := url.Values{}
+	var data map[string]*WorkerStatus
+	if err := client.call(ctx, http.MethodPost, path, query, nil, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// RunWorkerParams are the query parameters of RunWorker.
+type RunWorkerParams struct {
+	// only plan the writes
+	DryRun *bool
+}
+
+// RunWorker calls POST /worker/:id/run: Run a worker once and report its writes, conflicts while the worker runs.
+func (client *Client) RunWorker(ctx context.Context, id string, params *RunWorkerParams) (*RunReport, error) {
+	path := expandPath("/worker/:id/run", id)
+	query := url.Values{}
+	if params != nil {
+		addQuery(query, "dry_run", params.DryRun)
+	}
+	var data RunReport
+	if err := client.call(ctx, http.MethodPost, path, query, nil, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// GetWorkerReport calls GET /worker/:id/report: Report of the last run of a worker.
+func (client *Client) GetWorkerReport(ctx context.Context, id string) (*RunReport, error) {
+	path := expandPath("/worker/:id/report", id)
+	query := url.Values{}
+	var data RunReport
+	if err := client.call(ctx, http.MethodGet, path, query, nil, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// ListCredentials calls GET /credentials/: Hiking Buddies accounts of the crawler, without passwords.
+func (client *Client) ListCredentials(ctx context.Context) ([]Account, error) {
+	path := expandPath("/credentials/")
+	query := url.Values{}
+	var data []Account
+	if err := client.call(ctx, http.MethodGet, path, query, nil, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// CreateCredential calls POST /credentials/: Add a Hiking Buddies account.
+func (client *Client) CreateCredential(ctx context.Context, body *Account) (*Account, error) {
+	path := expandPath("/credentials/")
+	query := url.Values{}
+	var data Account
+	if err := client.call(ctx, http.MethodPost, path, query, body, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// Estimate calls POST /analysis/estimate: Estimate the points after of a sample with the active model.
+func (client *Client) Estimate(ctx context.Context, body *ReducedPointGainRecord) (*Estimate, error) {
+	path := expandPath("/analysis/estimate")
+	query := url.Values{}
+	var data Estimate
+	if err := client.call(ctx, http.MethodPost, path, query, body, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// EstimateBatchParams are the query parameters of EstimateBatch.
+type EstimateBatchParams struct {
+	// json (default) or csv
+	Format *string
+}
+
+// EstimateBatch calls POST /analysis/estimate/batch: Estimate the points after of many samples, sent as JSON or as CSV with a route_points,points_before[,scale] header.
+func (client *Client) EstimateBatch(ctx context.Context, params *EstimateBatchParams, body []ReducedPointGainRecord) ([]BatchEstimate, error) {
+	path := expandPath("/analysis/estimate/batch")
+	query := url.Values{}
+	if params != nil {
+		addQuery(query, "format", params.Format)
+	}
+	var data []BatchEstimate
+	if err := client.call(ctx, http.MethodPost, path, query, body, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// PlanParams are the query parameters of Plan.
+type PlanParams struct {
+	// current points of the member
+	PointsBefore *int
+	// points to reach
+	Target *int
+	// hardest route to consider, defaults to 1000, at most 5000
+	MaxRoutePoints *int
+	// longest plan, defaults to 50, at most 100
+	MaxHikes *int
+	// SAC scale of the planned routes
+	Scale *string
+}
+
+// Plan calls GET /analysis/plan: Hikes a member needs to reach a target.
+func (client *Client) Plan(ctx context.Context, params *PlanParams) (*HikePlan, error) {
+	path := expandPath("/analysis/plan")
+	query := url.Values{}
+	if params != nil {
+		addQuery(query, "points_before", params.PointsBefore)
+		addQuery(query, "target", params.Target)
+		addQuery(query, "max_route_points", params.MaxRoutePoints)
+		addQuery(query, "max_hikes", params.MaxHikes)
+		addQuery(query, "scale", params.Scale)
+	}
+	var data HikePlan
+	if err := client.call(ctx, http.MethodGet, path, query, nil, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// CurveParams are the query parameters of Curve.
+type CurveParams struct {
+	// current points of the member
+	PointsBefore *int
+	// least route points, defaults to 0
+	From *int
+	// most route points, defaults to 1000, at most 5000
+	To *int
+	// route points between two points of the curve, defaults to 10, curves have at most 1000 points
+	Step *int
+	// SAC scale of the routes
+	Scale *string
+}
+
+// Curve calls GET /analysis/curve: Estimated points after across route points.
+func (client *Client) Curve(ctx context.Context, params *CurveParams) ([]CurvePoint, error) {
+	path := expandPath("/analysis/curve")
+	query := url.Values{}
+	if params != nil {
+		addQuery(query, "points_before", params.PointsBefore)
+		addQuery(query, "from", params.From)
+		addQuery(query, "to", params.To)
+		addQuery(query, "step", params.Step)
+		addQuery(query, "scale", params.Scale)
+	}
+	var data []CurvePoint
+	if err := client.call(ctx, http.MethodGet, path, query, nil, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// OptimizeParams are the query parameters of Optimize.
+type OptimizeParams struct {
+	// model family to fit, defaults to the family of the active model
+	Model *string
+	// mae (default), mse, huber or exact
+	Loss *string
+	// residual size where the huber loss turns linear
+	HuberDelta *float64
+	// weight of the L2 regularization
+	L2 *float64
+	// nelder-mead (default), bfgs or cmaes
+	Method *string
+	// limit of major iterations, at most 100000
+	MaxIterations *int
+	// comma separated params kept at their current values, e.g. A,B
+	Freeze *string
+	// number of refits on resampled samples, 2 to 1000
+	Bootstrap *int
+	// coverage of the bootstrap intervals, defaults to 0.95
+	Confidence *float64
+	// seed of the resampling
+	BootstrapSeed *int
+}
+
+// Optimize calls POST /analysis/optimize: Submit a job fitting and activating a new model.
+func (client *Client) Optimize(ctx context.Context, params *OptimizeParams) (*OptimizeJob, error) {
+	path := expandPath("/analysis/optimize")
+	query := url.Values{}
+	if params != nil {
+		addQuery(query, "model", params.Model)
+		addQuery(query, "loss", params.Loss)
+		addQuery(query, "huber_delta", params.HuberDelta)
+		addQuery(query, "l2", params.L2)
+		addQuery(query, "method", params.Method)
+		addQuery(query, "max_iterations", params.MaxIterations)
+		addQuery(query, "freeze", params.Freeze)
+		addQuery(query, "bootstrap", params.Bootstrap)
+		addQuery(query, "confidence", params.Confidence)
+		addQuery(query, "bootstrap_seed", params.BootstrapSeed)
+	}
+	var data OptimizeJob
+	if err := client.call(ctx, http.MethodPost, path, query, nil, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// ValidateParams are the query parameters of Validate.
+type ValidateParams struct {
+	// model family to fit, defaults to the family of the active model
+	Model *string
+	// holdout (default) or kfold
+	Validation *string
+	// number of folds, 2 to 20, defaults to 5
+	K *int
+	// random (default), date or event
+	Strategy *string
+	// share of validation samples, defaults to 0.2
+	Ratio *float64
+	// seed of random and event splits
+	Seed *int
+	// mae (default), mse, huber or exact
+	Loss *string
+	// residual size where the huber loss turns linear
+	HuberDelta *float64
+	// weight of the L2 regularization
+	L2 *float64
+	// nelder-mead (default), bfgs or cmaes
+	Method *string
+	// limit of major iterations, at most 100000
+	MaxIterations *int
+	// comma separated params kept at their current values, e.g. A,B
+	Freeze *string
+	// number of refits on resampled samples, 2 to 1000
+	Bootstrap *int
+	// coverage of the bootstrap intervals, defaults to 0.95
+	Confidence *float64
+	// seed of the resampling
+	BootstrapSeed *int
+}
+
+// Validate calls POST /analysis/validate: Submit a job fitting the estimator on a train split and reporting train and validation metrics.
+func (client *Client) Validate(ctx context.Context, params *ValidateParams) (*OptimizeJob, error) {
+	path := expandPath("/analysis/validate")
+	query := url.Values{}
+	if params != nil {
+		addQuery(query, "model", params.Model)
+		addQuery(query, "validation", params.Validation)
+		addQuery(query, "k", params.K)
+		addQuery(query, "strategy", params.Strategy)
+		addQuery(query, "ratio", params.Ratio)
+		addQuery(query, "seed", params.Seed)
+		addQuery(query, "loss", params.Loss)
+		addQuery(query, "huber_delta", params.HuberDelta)
+		addQuery(query, "l2", params.L2)
+		addQuery(query, "method", params.Method)
+		addQuery(query, "max_iterations", params.MaxIterations)
+		addQuery(query, "freeze", params.Freeze)
+		addQuery(query, "bootstrap", params.Bootstrap)
+		addQuery(query, "confidence", params.Confidence)
+		addQuery(query, "bootstrap_seed", params.BootstrapSeed)
+	}
+	var data OptimizeJob
+	if err := client.call(ctx, http.MethodPost, path, query, nil, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// CompareParams are the query parameters of Compare.
+type CompareParams struct {
+	// random (default), date or event
+	Strategy *string
+	// share of validation samples, defaults to 0.2
+	Ratio *float64
+	// seed of random and event splits
+	Seed *int
+	// mae (default), mse, huber or exact
+	Loss *string
+	// residual size where the huber loss turns linear
+	HuberDelta *float64
+	// weight of the L2 regularization
+	L2 *float64
+	// nelder-mead (default), bfgs or cmaes
+	Method *string
+	// limit of major iterations, at most 100000
+	MaxIterations *int
+	// comma separated params kept at their current values, e.g. A,B
+	Freeze *string
+	// number of refits on resampled samples, 2 to 1000
+	Bootstrap *int
+	// coverage of the bootstrap intervals, defaults to 0.95
+	Confidence *float64
+	// seed of the resampling
+	BootstrapSeed *int
+}
+
+// Compare calls POST /analysis/compare: Submit a job fitting every model family on the same split and ranking them by validation MAE.
+func (client *Client) Compare(ctx context.Context, params *CompareParams) (*OptimizeJob, error) {
+	path := expandPath("/analysis/compare")
+	query := url.Values{}
+	if params != nil {
+		addQuery(query, "strategy", params.Strategy)
+		addQuery(query, "ratio", params.Ratio)
+		addQuery(query, "seed", params.Seed)
+		addQuery(query, "loss", params.Loss)
+		addQuery(query, "huber_delta", params.HuberDelta)
+		addQuery(query, "l2", params.L2)
+		addQuery(query, "method", params.Method)
+		addQuery(query, "max_iterations", params.MaxIterations)
+		addQuery(query, "freeze", params.Freeze)
+		addQuery(query, "bootstrap", params.Bootstrap)
+		addQuery(query, "confidence", params.Confidence)
+		addQuery(query, "bootstrap_seed", params.BootstrapSeed)
+	}
+	var data OptimizeJob
+	if err := client.call(ctx, http.MethodPost, path, query, nil, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// ResidualsParams are the query parameters of Residuals.
+type ResidualsParams struct {
+	// scaled median absolute deviations beyond which samples are outliers, defaults to 3.5
+	Threshold *float64
+	// activity code: HI (hiking), VF (via ferrata), CL (climbing), SK (skiing) or BI (biking)
+	Activity *string
+	// json (default) or csv
+	Format *string
+	// table of CSV exports: residuals (default), outliers or aggregates
+	View *string
+}
+
+// Residuals calls GET /analysis/residuals: Residuals of the active model with aggregates and outliers.
+func (client *Client) Residuals(ctx context.Context, params *ResidualsParams) (*ResidualReport, error) {
+	path := expandPath("/analysis/residuals")
+	query := url.Values{}
+	if params != nil {
+		addQuery(query, "threshold", params.Threshold)
+		addQuery(query, "activity", params.Activity)
+		addQuery(query, "format", params.Format)
+		addQuery(query, "view", params.View)
+	}
+	var data ResidualReport
+	if err := client.call(ctx, http.MethodGet, path, query, nil, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// DatasetParams are the query parameters of Dataset.
+type DatasetParams struct {
+	// points changes between two samples of a user beyond which they are suspicious, defaults to 200
+	Jump *int
+	// json (default) or html
+	Format *string
+}
+
+// Dataset calls GET /analysis/dataset: Health of the collected samples.
+func (client *Client) Dataset(ctx context.Context, params *DatasetParams) (*DatasetReport, error) {
+	path := expandPath("/analysis/dataset")
+	query := url.Values{}
+	if params != nil {
+		addQuery(query, "jump", params.Jump)
+		addQuery(query, "format", params.Format)
+	}
+	var data DatasetReport
+	if err := client.call(ctx, http.MethodGet, path, query, nil, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// ListJobs calls GET /analysis/jobs: Optimize, validate and compare jobs since startup.
+func (client *Client) ListJobs(ctx context.Context) ([]OptimizeJob, error) {
+	path := expandPath("/analysis/jobs")
+	query := url.Values{}
+	var data []OptimizeJob
+	if err := client.call(ctx, http.MethodGet, path, query, nil, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// GetJob calls GET /analysis/jobs/:id: Progress and result of a job.
+func (client *Client) GetJob(ctx context.Context, id int) (*OptimizeJob, error) {
+	path := expandPath("/analysis/jobs/:id", id)
+	query := url.Values{}
+	var data OptimizeJob
+	if err := client.call(ctx, http.MethodGet, path, query, nil, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// StreamJob calls GET /analysis/jobs/:id/stream: Follow a job as server-sent events until it finishes.
+// The caller must close the body of the response.
+func (client *Client) StreamJob(ctx context.Context, id int) (*http.Response, error) {
+	path := expandPath("/analysis/jobs/:id/stream", id)
+	query := url.Values{}
+	return client.Do(ctx, http.MethodGet, path, query, nil, "")
+}
+
+// CancelJob calls POST /analysis/jobs/:id/cancel: Cancel a running job.
+func (client *Client) CancelJob(ctx context.Context, id int) (*OptimizeJob, error) {
+	path := expandPath("/analysis/jobs/:id/cancel", id)
+	query := url.Values{}
+	var data OptimizeJob
+	if err := client.call(ctx, http.MethodPost, path, query, nil, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// ListModels calls GET /analysis/models: Stored models.
+func (client *Client) ListModels(ctx context.Context) ([]ModelRecord, error) {
+	path := expandPath("/analysis/models")
+	query := url.Values{}
+	var data []ModelRecord
+	if err := client.call(ctx, http.MethodGet, path, query, nil, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// DiffModelsParams are the query parameters of DiffModels.
+type DiffModelsParams struct {
+	// id of the first model
+	From *int
+	// id of the second model
+	To *int
+}
+
+// DiffModels calls GET /analysis/models/diff: Compare the parameters and losses of two models.
+func (client *Client) DiffModels(ctx context.Context, params *DiffModelsParams) (*ModelDiff, error) {
+	path := expandPath("/analysis/models/diff")
+	query := url.Values{}
+	if params != nil {
+		addQuery(query, "from", params.From)
+		addQuery(query, "to", params.To)
+	}
+	var data ModelDiff
+	if err := client.call(ctx, http.MethodGet, path, query, nil, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// ActivateModel calls POST /analysis/models/:id/activate: Use a stored model as the active estimator.
+func (client *Client) ActivateModel(ctx context.Context, id int) (*ModelRecord, error) {
+	path := expandPath("/analysis/models/:id/activate", id)
+	query := url.Values{}
+	var data ModelRecord
+	if err := client.call(ctx, http.MethodPost, path, query, nil, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// RollbackModel calls POST /analysis/models/rollback: Re-activate the previously active model.
+func (client *Client) RollbackModel(ctx context.Context) (*ModelRecord, error) {
+	path := expandPath("/analysis/models/rollback")
+	query := url.Values{}
+	var data ModelRecord
+	if err := client.call(ctx, http.MethodPost, path, query, nil, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// RecommendParams are the query parameters of Recommend.
+type RecommendParams struct {
+	// member to recommend events to
+	UserId *int
+	// current points of the member, defaults to the latest known points
+	Points *int
+	// first day of the events, e.g. 2024-06-01
+	From *string
+	// last day of the events, e.g. 2024-06-30
+	To *string
+	// comma separated SAC scales, e.g. T2,T3
+	Scale *string
+	// activity code: HI (hiking), VF (via ferrata), CL (climbing), SK (skiing) or BI (biking)
+	Activity *string
+	// shortest route
+	MinDistance *float64
+	// longest route
+	MaxDistance *float64
+	// number of recommendations
+	Limit *int
+}
+
+// Recommend calls GET /recommendations/: Upcoming events ranked by the gain the active model predicts for a member.
+func (client *Client) Recommend(ctx context.Context, params *RecommendParams) ([]Recommendation, error) {
+	path := expandPath("/recommendations/")
+	query := url.Values{}
+	if params != nil {
+		addQuery(query, "user_id", params.UserId)
+		addQuery(query, "points", params.Points)
+		addQuery(query, "from", params.From)
+		addQuery(query, "to", params.To)
+		addQuery(query, "scale", params.Scale)
+		addQuery(query, "activity", params.Activity)
+		addQuery(query, "min_distance", params.MinDistance)
+		addQuery(query, "max_distance", params.MaxDistance)
+		addQuery(query, "limit", params.Limit)
+	}
+	var data []Recommendation
+	if err := client.call(ctx, http.MethodGet, path, query, nil, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// ListExportDatasets calls GET /export/: Exportable datasets with their columns.
+func (client *Client) ListExportDatasets(ctx context.Context) ([]ExportDataset, error) {
+	path := expandPath("/export/")
+	query := url.Values{}
+	var data []ExportDataset
+	if err := client.call(ctx, http.MethodGet, path, query, nil, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// ExportParams are the query parameters of Export.
+type ExportParams struct {
+	// csv (default), ndjson or parquet
+	Format *string
+	// comma separated columns to export, all columns by default
+	Columns *string
+	// only samples of the event
+	EventId *int
+	// only samples of the user
+	UserId *int
+	// first day of the events, e.g. 2024-06-01
+	From *string
+	// last day of the events, e.g. 2024-06-30
+	To *string
+	// least route points
+	MinRoutePoints *int
+	// most route points
+	MaxRoutePoints *int
+	// true for samples with points after, false for dangling samples
+	Complete *bool
+	// activity code: HI (hiking), VF (via ferrata), CL (climbing), SK (skiing) or BI (biking)
+	Activity *string
+	// number of samples, all samples if negative
+	Limit *int
+	// number of samples to skip
+	Skip *int
+}
+
+// Export calls GET /export/:dataset: Stream a dataset from the database.
+// The caller must close the body of the response.
+func (client *Client) Export(ctx context.Context, dataset string, params *ExportParams) (*http.Response, error) {
+	path := expandPath("/export/:dataset", dataset)
+	query := url.Values{}
+	if params != nil {
+		addQuery(query, "format", params.Format)
+		addQuery(query, "columns", params.Columns)
+		addQuery(query, "event_id", params.EventId)
+		addQuery(query, "user_id", params.UserId)
+		addQuery(query, "from", params.From)
+		addQuery(query, "to", params.To)
+		addQuery(query, "min_route_points", params.MinRoutePoints)
+		addQuery(query, "max_route_points", params.MaxRoutePoints)
+		addQuery(query, "complete", params.Complete)
+		addQuery(query, "activity", params.Activity)
+		addQuery(query, "limit", params.Limit)
+		addQuery(query, "skip", params.Skip)
+	}
+	return client.Do(ctx, http.MethodGet, path, query, nil, "")
+}
+
+// ImportParams are the query parameters of Import.
+type ImportParams struct {
+	// sqlite, csv or ndjson, inferred from the name of an uploaded file otherwise
+	Format *string
+	// dataset of csv and ndjson exports
+	Dataset *string
+	// report the changes without keeping them
+	DryRun *bool
+}
+
+// Import calls POST /import/: Merge another instance's database or dataset export.
+func (client *Client) Import(ctx context.Context, params *ImportParams, body io.Reader, contentType string) (*ImportReport, error) {
+	path := expandPath("/import/")
+	query := url.Values{}
+	if params != nil {
+		addQuery(query, "format", params.Format)
+		addQuery(query, "dataset", params.Dataset)
+		addQuery(query, "dry_run", params.DryRun)
+	}
+	var data ImportReport
+	response, err := client.Do(ctx, http.MethodPost, path, query, body, contentType)
+	if err != nil {
+		return nil, err
+	}
+	if err := decodePayload(response, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
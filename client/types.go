@@ -0,0 +1,491 @@
+// Code generated by go run ./generate; DO NOT EDIT.
+
+package client
+
+import (
+	"time"
+)
+
+const (
+	ApiKeyHeader    = "X-API-Key"
+	RequestIdHeader = "X-Request-ID"
+)
+
+const (
+	BadRequestCode          ErrorCode = "bad_request"
+	InvalidParameterCode    ErrorCode = "invalid_parameter"
+	InvalidBodyCode         ErrorCode = "invalid_body"
+	UnauthorizedCode        ErrorCode = "unauthorized"
+	ForbiddenCode           ErrorCode = "forbidden"
+	NotFoundCode            ErrorCode = "not_found"
+	MethodNotAllowedCode    ErrorCode = "method_not_allowed"
+	ConflictCode            ErrorCode = "conflict"
+	UpstreamUnavailableCode ErrorCode = "upstream_unavailable"
+	InternalErrorCode       ErrorCode = "internal_error"
+)
+
+// ErrorPayload is api.ErrorPayload of the API.
+type ErrorPayload struct {
+	Ok        bool     `json:"ok"`
+	Error     ApiError `json:"error"`
+	RequestId string   `json:"request_id"`
+}
+
+// PointGainsPage is api.PointGainsPage of the API.
+type PointGainsPage struct {
+	Records    *[]PointGainRecord `json:"records"`
+	Total      int                `json:"total"`
+	NextCursor *string            `json:"next_cursor"`
+	Next       *string            `json:"next"`
+}
+
+// ReducedPointGainRecord is database.ReducedPointGainRecord of the API.
+type ReducedPointGainRecord struct {
+	RoutePoints      int           `json:"route_points"`
+	UserPointsBefore int           `json:"points_before"`
+	UserPointsAfter  int           `json:"points_after"`
+	EventId          int           `json:"event_id"`
+	EventDate        int64         `json:"event_date"`
+	UserId           int           `json:"user_id"`
+	EventTitle       *string       `json:"event_title"`
+	RouteId          *int          `json:"route_id"`
+	RouteName        *string       `json:"route_name"`
+	Scale            *string       `json:"scale"`
+	Route            RouteFeatures `json:"route"`
+}
+
+// PointGainRecord is database.PointGainRecord of the API.
+type PointGainRecord struct {
+	EventId          int
+	RoutePoints      int
+	UserId           int
+	UserPointsBefore *int
+	UserPointsAfter  *int
+	EventDate        int64
+	Kind             SampleKind
+	Activity         string
+	RouteId          *int
+}
+
+// WorkerStatus is worker.WorkerStatus of the API.
+type WorkerStatus struct {
+	Running bool       `json:"running"`
+	DryRun  bool       `json:"dry_run"`
+	LastRun *time.Time `json:"last_run"`
+}
+
+// RunReport is worker.RunReport of the API.
+type RunReport struct {
+	DryRun     bool               `json:"dry_run"`
+	StartedAt  time.Time          `json:"started_at"`
+	FinishedAt *time.Time         `json:"finished_at"`
+	Operations []PlannedOperation `json:"operations"`
+	Error      *string            `json:"error"`
+}
+
+// Account is database.Account of the API.
+type Account struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// Estimate is api.Estimate of the API.
+type Estimate struct {
+	PointsAfter float64 `json:"pointsAfter"`
+}
+
+// BatchEstimate is api.BatchEstimate of the API.
+type BatchEstimate struct {
+	RoutePoints  int     `json:"route_points"`
+	PointsBefore int     `json:"points_before"`
+	PointsAfter  float64 `json:"points_after"`
+}
+
+// HikePlan is analysis.HikePlan of the API.
+type HikePlan struct {
+	PointsBefore       int           `json:"points_before"`
+	Target             int           `json:"target"`
+	MinimumRoutePoints *int          `json:"minimum_route_points"`
+	Hikes              []PlannedHike `json:"hikes"`
+	Reached            bool          `json:"reached"`
+}
+
+// CurvePoint is analysis.CurvePoint of the API.
+type CurvePoint struct {
+	RoutePoints int     `json:"route_points"`
+	PointsAfter float64 `json:"points_after"`
+	Gain        float64 `json:"gain"`
+}
+
+// OptimizeJob is api.OptimizeJob of the API.
+type OptimizeJob struct {
+	Id          int                `json:"id"`
+	Kind        JobKind            `json:"kind"`
+	Model       string             `json:"model"`
+	Options     OptimizeOptions    `json:"options"`
+	Status      JobStatus          `json:"status"`
+	Progress    *Progress          `json:"progress"`
+	Result      *OptimizeResult    `json:"result,omitempty"`
+	ModelId     *int64             `json:"model_id,omitempty"`
+	Validation  *ValidationResult  `json:"validation,omitempty"`
+	Leaderboard []LeaderboardEntry `json:"leaderboard,omitempty"`
+	Error       string             `json:"error,omitempty"`
+	CreatedAt   time.Time          `json:"created_at"`
+	FinishedAt  *time.Time         `json:"finished_at,omitempty"`
+}
+
+// ResidualReport is analysis.ResidualReport of the API.
+type ResidualReport struct {
+	Model           string          `json:"model"`
+	Metrics         Metrics         `json:"metrics"`
+	Median          float64         `json:"median"`
+	MAD             float64         `json:"mad"`
+	OutlierDistance float64         `json:"outlier_distance"`
+	Residuals       []Residual      `json:"residuals"`
+	Aggregates      []BucketMetrics `json:"aggregates"`
+	Outliers        []Residual      `json:"outliers"`
+}
+
+// DatasetReport is analysis.DatasetReport of the API.
+type DatasetReport struct {
+	GeneratedAt              int64            `json:"generated_at"`
+	Total                    int              `json:"total"`
+	Complete                 int              `json:"complete"`
+	Dangling                 int              `json:"dangling"`
+	Historical               int              `json:"historical"`
+	Valid                    int              `json:"valid"`
+	ValidWithoutRoute        int              `json:"valid_without_route"`
+	NonIncreasing            []DatasetSample  `json:"non_increasing"`
+	Duplicates               []DuplicateGain  `json:"duplicates"`
+	EventsWithoutRoutePoints []UnpointedEvent `json:"events_without_route_points"`
+	JumpThreshold            int              `json:"jump_threshold"`
+	SuspiciousUsers          int              `json:"suspicious_users"`
+	SuspiciousJumps          []PointsJump     `json:"suspicious_jumps"`
+	ByMonth                  []Coverage       `json:"by_month"`
+	ByRoutePoints            []Coverage       `json:"by_route_points"`
+	OldestDangling           *DanglingAge     `json:"oldest_dangling"`
+}
+
+// ModelRecord is database.ModelRecord of the API.
+type ModelRecord struct {
+	Id          int                `json:"id"`
+	Type        string             `json:"type"`
+	Params      []float64          `json:"params"`
+	Fingerprint string             `json:"fingerprint"`
+	InitialLoss float64            `json:"initial_loss"`
+	Loss        float64            `json:"loss"`
+	Metrics     map[string]float64 `json:"metrics"`
+	Active      bool               `json:"active"`
+	CreatedAt   int64              `json:"created_at"`
+	ActivatedAt *int64             `json:"activated_at"`
+}
+
+// ModelDiff is analysis.ModelDiff of the API.
+type ModelDiff struct {
+	From            int         `json:"from"`
+	To              int         `json:"to"`
+	SameType        bool        `json:"same_type"`
+	SameTrainingSet bool        `json:"same_training_set"`
+	LossDelta       float64     `json:"loss_delta"`
+	Params          []ParamDiff `json:"params"`
+}
+
+// Recommendation is api.Recommendation of the API.
+type Recommendation struct {
+	EventId      int       `json:"event_id"`
+	Title        string    `json:"title"`
+	Start        time.Time `json:"start"`
+	Activity     Activity  `json:"activity"`
+	RouteId      int       `json:"route_id"`
+	RouteName    string    `json:"route_name"`
+	Scale        string    `json:"scale"`
+	Distance     float64   `json:"distance"`
+	RoutePoints  int       `json:"route_points"`
+	PointsBefore int       `json:"points_before"`
+	PointsAfter  float64   `json:"points_after"`
+	Gain         float64   `json:"gain"`
+}
+
+// ExportDataset is database.ExportDataset of the API.
+type ExportDataset struct {
+	Name    string         `json:"name"`
+	Columns []ExportColumn `json:"columns"`
+}
+
+// ImportReport is database.ImportReport of the API.
+type ImportReport struct {
+	DryRun   bool                  `json:"dry_run"`
+	Datasets []DatasetImportReport `json:"datasets"`
+}
+
+// ErrorCode is api.ErrorCode of the API.
+type ErrorCode string
+
+// ApiError is api.ApiError of the API.
+type ApiError struct {
+	Code    ErrorCode     `json:"code"`
+	Message string        `json:"message"`
+	Details []ErrorDetail `json:"details,omitempty"`
+	Data    any           `json:"data,omitempty"`
+}
+
+// RouteFeatures is database.RouteFeatures of the API.
+type RouteFeatures struct {
+	Elevation     *float64 `json:"elevation"`
+	Distance      *float64 `json:"distance"`
+	ElevationGain *float64 `json:"elevation_gain"`
+	ElevationLoss *float64 `json:"elevation_loss"`
+	T1Distance    *float64 `json:"t1_distance"`
+	T2Distance    *float64 `json:"t2_distance"`
+	T3Distance    *float64 `json:"t3_distance"`
+	T4Distance    *float64 `json:"t4_distance"`
+	T5Distance    *float64 `json:"t5_distance"`
+	T6Distance    *float64 `json:"t6_distance"`
+}
+
+// SampleKind is database.SampleKind of the API.
+type SampleKind string
+
+// PlannedOperation is worker.PlannedOperation of the API.
+type PlannedOperation struct {
+	Operation OperationType `json:"operation"`
+	Table     string        `json:"table"`
+	Record    any           `json:"record"`
+}
+
+// PlannedHike is analysis.PlannedHike of the API.
+type PlannedHike struct {
+	RoutePoints  int `json:"route_points"`
+	PointsBefore int `json:"points_before"`
+	PointsAfter  int `json:"points_after"`
+}
+
+// JobKind is api.JobKind of the API.
+type JobKind string
+
+// OptimizeOptions is analysis.OptimizeOptions of the API.
+type OptimizeOptions struct {
+	Loss          LossFunction   `json:"loss"`
+	HuberDelta    float64        `json:"huber_delta"`
+	L2            float64        `json:"l2"`
+	Method        OptimizeMethod `json:"method"`
+	MaxIterations int            `json:"max_iterations"`
+	Frozen        []string       `json:"frozen"`
+	Bootstrap     int            `json:"bootstrap"`
+	BootstrapSeed int64          `json:"bootstrap_seed"`
+	Confidence    float64        `json:"confidence"`
+}
+
+// JobStatus is api.JobStatus of the API.
+type JobStatus string
+
+// Progress is analysis.Progress of the API.
+type Progress struct {
+	Stage       string  `json:"stage"`
+	Iteration   int     `json:"iteration"`
+	Loss        float64 `json:"loss"`
+	Evaluations int     `json:"evaluations"`
+	Resamples   int     `json:"resamples"`
+	Fits        int     `json:"fits"`
+}
+
+// OptimizeResult is analysis.OptimizeResult of the API.
+type OptimizeResult struct {
+	Model         string            `json:"model"`
+	ParamNames    []string          `json:"param_names"`
+	InitialParams []float64         `json:"initial_params"`
+	InitialLoss   float64           `json:"initial_loss"`
+	Params        []float64         `json:"params"`
+	Loss          float64           `json:"loss"`
+	Options       OptimizeOptions   `json:"options"`
+	Iterations    int               `json:"iterations"`
+	Status        string            `json:"status"`
+	Uncertainty   *BootstrapSummary `json:"uncertainty,omitempty"`
+}
+
+// ValidationResult is analysis.ValidationResult of the API.
+type ValidationResult struct {
+	Strategy   SplitStrategy `json:"strategy"`
+	Folds      []FoldResult  `json:"folds"`
+	Train      Metrics       `json:"train"`
+	Validation Metrics       `json:"validation"`
+}
+
+// LeaderboardEntry is analysis.LeaderboardEntry of the API.
+type LeaderboardEntry struct {
+	Model      string    `json:"model"`
+	Params     []float64 `json:"params"`
+	Loss       float64   `json:"loss"`
+	Error      string    `json:"error,omitempty"`
+	Train      *Metrics  `json:"train,omitempty"`
+	Validation *Metrics  `json:"validation,omitempty"`
+}
+
+// Metrics is analysis.Metrics of the API.
+type Metrics struct {
+	Count int     `json:"count"`
+	MAE   float64 `json:"mae"`
+	RMSE  float64 `json:"rmse"`
+	Bias  float64 `json:"bias"`
+}
+
+// Residual is analysis.Residual of the API.
+type Residual struct {
+	Sample    ReducedPointGainRecord `json:"sample"`
+	Predicted float64                `json:"predicted"`
+	Residual  float64                `json:"residual"`
+	Outlier   bool                   `json:"outlier"`
+}
+
+// BucketMetrics is analysis.BucketMetrics of the API.
+type BucketMetrics struct {
+	Group  string `json:"group"`
+	Bucket string `json:"bucket"`
+	Metrics
+}
+
+// DatasetSample is analysis.DatasetSample of the API.
+type DatasetSample struct {
+	EventId      int        `json:"event_id"`
+	UserId       int        `json:"user_id"`
+	RoutePoints  int        `json:"route_points"`
+	PointsBefore *int       `json:"points_before"`
+	PointsAfter  *int       `json:"points_after"`
+	EventDate    int64      `json:"event_date"`
+	Kind         SampleKind `json:"kind"`
+	Activity     string     `json:"activity"`
+}
+
+// DuplicateGain is analysis.DuplicateGain of the API.
+type DuplicateGain struct {
+	UserId       int   `json:"user_id"`
+	PointsBefore int   `json:"points_before"`
+	PointsAfter  int   `json:"points_after"`
+	EventIds     []int `json:"event_ids"`
+}
+
+// UnpointedEvent is analysis.UnpointedEvent of the API.
+type UnpointedEvent struct {
+	EventId int    `json:"event_id"`
+	Title   string `json:"title"`
+	RouteId int    `json:"route_id"`
+	Date    int64  `json:"date"`
+}
+
+// PointsJump is analysis.PointsJump of the API.
+type PointsJump struct {
+	UserId       int `json:"user_id"`
+	FromEventId  int `json:"from_event_id"`
+	ToEventId    int `json:"to_event_id"`
+	PointsAfter  int `json:"points_after"`
+	PointsBefore int `json:"points_before"`
+	Change       int `json:"change"`
+}
+
+// Coverage is analysis.Coverage of the API.
+type Coverage struct {
+	Bucket   string `json:"bucket"`
+	Total    int    `json:"total"`
+	Complete int    `json:"complete"`
+	Dangling int    `json:"dangling"`
+	Valid    int    `json:"valid"`
+}
+
+// DanglingAge is analysis.DanglingAge of the API.
+type DanglingAge struct {
+	DatasetSample
+	AgeDays float64 `json:"age_days"`
+}
+
+// ParamDiff is analysis.ParamDiff of the API.
+type ParamDiff struct {
+	Index int      `json:"index"`
+	Name  string   `json:"name"`
+	From  *float64 `json:"from"`
+	To    *float64 `json:"to"`
+	Delta *float64 `json:"delta"`
+}
+
+// Activity is hiking-buddies.Activity of the API.
+type Activity string
+
+// ExportColumn is database.ExportColumn of the API.
+type ExportColumn struct {
+	Name     string     `json:"name"`
+	Type     ColumnType `json:"type"`
+	Nullable bool       `json:"nullable"`
+}
+
+// DatasetImportReport is database.DatasetImportReport of the API.
+type DatasetImportReport struct {
+	Dataset   string           `json:"dataset"`
+	Read      int              `json:"read"`
+	Inserted  []string         `json:"inserted"`
+	Updated   []ImportUpdate   `json:"updated"`
+	Unchanged int              `json:"unchanged"`
+	Conflicts []ImportConflict `json:"conflicts"`
+}
+
+// ErrorDetail is api.ErrorDetail of the API.
+type ErrorDetail struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// OperationType is worker.OperationType of the API.
+type OperationType string
+
+// LossFunction is analysis.LossFunction of the API.
+type LossFunction string
+
+// OptimizeMethod is analysis.OptimizeMethod of the API.
+type OptimizeMethod string
+
+// BootstrapSummary is analysis.BootstrapSummary of the API.
+type BootstrapSummary struct {
+	Resamples  int                `json:"resamples"`
+	Failed     int                `json:"failed"`
+	Confidence float64            `json:"confidence"`
+	Params     []ParamUncertainty `json:"params"`
+}
+
+// SplitStrategy is analysis.SplitStrategy of the API.
+type SplitStrategy string
+
+// FoldResult is analysis.FoldResult of the API.
+type FoldResult struct {
+	Fold           int       `json:"fold"`
+	TrainSize      int       `json:"train_size"`
+	ValidationSize int       `json:"validation_size"`
+	Params         []float64 `json:"params"`
+	Train          Metrics   `json:"train"`
+	Validation     Metrics   `json:"validation"`
+}
+
+// ColumnType is database.ColumnType of the API.
+type ColumnType string
+
+// ImportUpdate is database.ImportUpdate of the API.
+type ImportUpdate struct {
+	Key    string   `json:"key"`
+	Fields []string `json:"fields"`
+}
+
+// ImportConflict is database.ImportConflict of the API.
+type ImportConflict struct {
+	Key      string `json:"key"`
+	Field    string `json:"field"`
+	Local    any    `json:"local"`
+	Incoming any    `json:"incoming"`
+	Kept     any    `json:"kept"`
+}
+
+// ParamUncertainty is analysis.ParamUncertainty of the API.
+type ParamUncertainty struct {
+	Name     string  `json:"name"`
+	Estimate float64 `json:"estimate"`
+	Mean     float64 `json:"mean"`
+	StdDev   float64 `json:"std_dev"`
+	Lower    float64 `json:"lower"`
+	Upper    float64 `json:"upper"`
+}
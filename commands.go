@@ -0,0 +1,316 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"hb-crawler/rating-gain/analysis"
+	"hb-crawler/rating-gain/backup"
+	"hb-crawler/rating-gain/database"
+	hb "hb-crawler/rating-gain/hiking-buddies"
+	"os"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	AnalysisCommand = "analysis"
+	SearchCommand   = "search"
+	ImportCommand   = "import"
+	BackupCommand   = "backup"
+	RestoreCommand  = "restore"
+	ApiKeyCommand   = "api-key"
+	CreateCommand   = "create"
+	ListCommand     = "list"
+	RevokeCommand   = "revoke"
+
+	// restores the newest snapshot of the backup directory
+	latestSnapshot = "latest"
+
+	ExitCommandFailed = 1
+	ExitUsage         = 64
+)
+
+func printUsage() {
+	fmt.Fprintf(
+		os.Stderr, "usage: %s [%s %s [flags] | %s [flags] file | %s [flags] | %s [flags] snapshot|%s | %s %s|%s|%s]\n",
+		os.Args[0], AnalysisCommand, SearchCommand, ImportCommand, BackupCommand, RestoreCommand, latestSnapshot,
+		ApiKeyCommand, CreateCommand, ListCommand, RevokeCommand,
+	)
+	fmt.Fprintln(os.Stderr, "Without a command the crawler and the API server are started.")
+}
+
+// runCommand runs the command given by the arguments and returns the exit code.
+// The lock of the database is only held for restores.
+func runCommand(repo *database.DatabaseRepository, databasePath string, lock *backup.DatabaseLock, args []string) int {
+	switch {
+	case args[0] == ImportCommand:
+		return runImport(repo, args[1:])
+	case args[0] == BackupCommand:
+		return runBackup(repo, databasePath, args[1:])
+	case args[0] == RestoreCommand:
+		return runRestore(repo, databasePath, lock, args[1:])
+	case len(args) >= 2 && args[0] == ApiKeyCommand:
+		return runApiKeyCommand(repo, args[1], args[2:])
+	case len(args) >= 2 && args[0] == AnalysisCommand && args[1] == SearchCommand:
+		return runHypothesisSearch(repo, args[2:])
+	default:
+		printUsage()
+		return ExitUsage
+	}
+}
+
+func runImport(repo *database.DatabaseRepository, args []string) int {
+	flags := flag.NewFlagSet(ImportCommand, flag.ContinueOnError)
+	format := flags.String("format", "", "sqlite, csv or ndjson, inferred from the file extension by default")
+	dataset := flags.String("dataset", "", "dataset of csv and ndjson exports, inferred from file names like hb_point-gains.csv by default")
+	dryRun := flags.Bool("dry-run", false, "report the changes without keeping them")
+	asJSON := flags.Bool("json", false, "print the report as JSON")
+	if err := flags.Parse(args); err != nil {
+		return ExitUsage
+	}
+	if flags.NArg() != 1 {
+		printUsage()
+		return ExitUsage
+	}
+	filename := flags.Arg(0)
+	if len(*format) == 0 {
+		*format = string(database.InferImportFormat(filename))
+	}
+
+	var report *database.ImportReport
+	var err error
+	if database.ImportFormat(*format) == database.SQLiteImport {
+		report, err = database.ImportDatabase(repo.PointGains.Conn(), filename, *dryRun)
+	} else {
+		if len(*dataset) == 0 {
+			*dataset = database.InferImportDataset(filename)
+		}
+		var file *os.File
+		if file, err = os.Open(filename); err == nil {
+			report, err = database.ImportExport(repo.PointGains.Conn(), *dataset, database.ImportFormat(*format), file, *dryRun)
+			file.Close()
+		}
+	}
+	if err != nil {
+		log.Errorf("Failed to import %s: %+v\n", filename, err)
+		return ExitCommandFailed
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			log.Errorf("Failed to encode import report: %+v\n", err)
+			return ExitCommandFailed
+		}
+		return ExitOK
+	}
+	for _, dataset := range report.Datasets {
+		fmt.Printf(
+			"%s: read %d, inserted %d, updated %d, unchanged %d, conflicts %d\n",
+			dataset.Dataset, dataset.Read, len(dataset.Inserted), len(dataset.Updated), dataset.Unchanged, len(dataset.Conflicts),
+		)
+		for _, conflict := range dataset.Conflicts {
+			fmt.Printf(
+				"\t%s %s: local %v, incoming %v, kept %v\n",
+				conflict.Key, conflict.Field, conflict.Local, conflict.Incoming, conflict.Kept,
+			)
+		}
+	}
+	if report.DryRun {
+		fmt.Println("Dry run, no changes were kept.")
+	}
+	return ExitOK
+}
+
+func runBackup(repo *database.DatabaseRepository, databasePath string, args []string) int {
+	config := getBackupConfig(databasePath)
+	flags := flag.NewFlagSet(BackupCommand, flag.ContinueOnError)
+	flags.StringVar(&config.Directory, "dir", config.Directory, "directory the snapshot is written to")
+	flags.IntVar(&config.Retention, "keep", config.Retention, "number of snapshots kept, -1 to keep all")
+	if err := flags.Parse(args); err != nil {
+		return ExitUsage
+	}
+
+	snapshot, err := backup.CreateScheduler(repo.PointGains.Conn(), nil, config).Run()
+	if err != nil {
+		log.Errorf("Failed to back up database: %+v\n", err)
+		return ExitCommandFailed
+	}
+	fmt.Println(snapshot.Path)
+	return ExitOK
+}
+
+/*
+Replaces the database with a snapshot, after writing a snapshot of the current
+database to the backup directory so that the restore can be undone. The
+crawler must not be running while its database is restored, the lock is taken
+before the database is opened.
+*/
+func runRestore(repo *database.DatabaseRepository, databasePath string, lock *backup.DatabaseLock, args []string) int {
+	config := getBackupConfig(databasePath)
+	flags := flag.NewFlagSet(RestoreCommand, flag.ContinueOnError)
+	flags.StringVar(&config.Directory, "dir", config.Directory, "backup directory of the current database's snapshot and of latest")
+	skipSnapshot := flags.Bool("no-snapshot", false, "do not snapshot the current database before replacing it")
+	if err := flags.Parse(args); err != nil {
+		return ExitUsage
+	}
+	if flags.NArg() != 1 {
+		printUsage()
+		return ExitUsage
+	}
+
+	snapshotPath := flags.Arg(0)
+	if snapshotPath == latestSnapshot {
+		snapshots, err := backup.ListSnapshots(config.Directory)
+		if err != nil || len(snapshots) == 0 {
+			log.Errorf("No snapshot found in %s: %+v\n", config.Directory, err)
+			return ExitCommandFailed
+		}
+		snapshotPath = snapshots[0].Path
+	}
+
+	if !*skipSnapshot {
+		current, err := backup.CreateSnapshot(repo.PointGains.Conn(), config.Directory)
+		if err != nil {
+			log.Errorf("Failed to snapshot the current database: %+v\n", err)
+			return ExitCommandFailed
+		}
+		log.Infof("Current database saved as %s", current.Path)
+	}
+	if err := repo.PointGains.Conn().Close(); err != nil {
+		log.Errorf("Failed to close database: %+v\n", err)
+		return ExitCommandFailed
+	}
+
+	version, err := backup.RestoreLocked(lock, snapshotPath, databasePath)
+	if err != nil {
+		log.Errorf("Failed to restore %s: %+v\n", snapshotPath, err)
+		return ExitCommandFailed
+	}
+	fmt.Printf("Restored %s (schema version %d) to %s\n", snapshotPath, version, databasePath)
+	return ExitOK
+}
+
+func runApiKeyCommand(repo *database.DatabaseRepository, command string, args []string) int {
+	flags := flag.NewFlagSet(ApiKeyCommand+" "+command, flag.ContinueOnError)
+	name := flags.String("name", "", "name telling who or what uses the key")
+	role := flags.String("role", string(database.ReadOnlyRole), "read-only or admin")
+	if err := flags.Parse(args); err != nil {
+		return ExitUsage
+	}
+
+	switch command {
+	case CreateCommand:
+		parsedRole, err := database.ParseApiKeyRole(*role)
+		if err != nil || len(*name) == 0 {
+			fmt.Fprintln(os.Stderr, "a name and a role of read-only or admin are required")
+			return ExitUsage
+		}
+		key, apiKey, err := repo.ApiKey.CreateApiKey(*name, parsedRole)
+		if err != nil {
+			log.Errorf("Failed to create API key: %+v\n", err)
+			return ExitCommandFailed
+		}
+		fmt.Fprintf(os.Stderr, "Created %s key %d for %s. Store the key now, it cannot be shown again:\n", apiKey.Role, apiKey.Id, apiKey.Name)
+		fmt.Println(key)
+	case ListCommand:
+		keys, err := repo.ApiKey.GetAllApiKeys()
+		if err != nil {
+			log.Errorf("Failed to list API keys: %+v\n", err)
+			return ExitCommandFailed
+		}
+		for _, apiKey := range *keys {
+			status := "active"
+			if apiKey.RevokedAt != nil {
+				status = "revoked " + time.Unix(*apiKey.RevokedAt, 0).Format(time.RFC3339)
+			}
+			fmt.Printf(
+				"%d\t%s...\t%s\t%s\tcreated %s\t%s\n",
+				apiKey.Id, apiKey.Hint, apiKey.Role, apiKey.Name, time.Unix(apiKey.CreatedAt, 0).Format(time.RFC3339), status,
+			)
+		}
+	case RevokeCommand:
+		if flags.NArg() != 1 {
+			printUsage()
+			return ExitUsage
+		}
+		id, err := strconv.Atoi(flags.Arg(0))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "the id of the key to revoke is required")
+			return ExitUsage
+		}
+		if err := repo.ApiKey.RevokeApiKey(id); err != nil {
+			log.Errorf("Failed to revoke API key: %+v\n", err)
+			return ExitCommandFailed
+		}
+		fmt.Printf("Revoked API key %d\n", id)
+	default:
+		printUsage()
+		return ExitUsage
+	}
+	return ExitOK
+}
+
+func runHypothesisSearch(repo *database.DatabaseRepository, args []string) int {
+	params := analysis.DefaultHypothesisSearchParams()
+	flags := flag.NewFlagSet(AnalysisCommand+" "+SearchCommand, flag.ContinueOnError)
+	flags.IntVar(&params.MaxSize, "max-size", params.MaxSize, "largest formula size in number of operators, variables and constants")
+	flags.IntVar(&params.BeamWidth, "beam", params.BeamWidth, "formulas of each size kept to build larger formulas from")
+	flags.IntVar(&params.SearchSamples, "samples", params.SearchSamples, "samples to search on, 0 for all")
+	flags.Int64Var(&params.Seed, "seed", params.Seed, "seed of the search sample selection")
+	flags.IntVar(&params.Top, "top", params.Top, "number of hypotheses to report")
+	flags.IntVar(&params.Counterexamples, "counterexamples", params.Counterexamples, "counterexamples reported per hypothesis")
+	activity := flags.String("activity", "", "only use samples of the activity, e.g. HI")
+	asJSON := flags.Bool("json", false, "print the report as JSON")
+	if err := flags.Parse(args); err != nil {
+		return ExitUsage
+	}
+	if len(*activity) > 0 {
+		if _, err := hb.ParseActivity(*activity); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return ExitUsage
+		}
+	}
+
+	records, err := repo.PointGains.GetValidPointsGainEntry(&database.ValidPointGainsQuery{
+		Limit:    -1,
+		Activity: *activity,
+	})
+	if err != nil {
+		log.Errorf("Failed to get samples: %+v\n", err)
+		return ExitCommandFailed
+	}
+	hypotheses, err := analysis.SearchHypotheses(*records, params)
+	if err != nil {
+		log.Errorf("Failed to search hypotheses: %+v\n", err)
+		return ExitCommandFailed
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(hypotheses); err != nil {
+			log.Errorf("Failed to encode hypotheses: %+v\n", err)
+			return ExitCommandFailed
+		}
+		return ExitOK
+	}
+	for rank, hypothesis := range hypotheses {
+		fmt.Printf(
+			"%d. %s reproduces %d of %d gains (%.1f%%)\n",
+			rank+1, hypothesis.Formula, hypothesis.Matches, hypothesis.Total, 100*hypothesis.Accuracy,
+		)
+		for _, counterexample := range hypothesis.Counterexamples {
+			sample := counterexample.Sample
+			fmt.Printf(
+				"\tevent %d: route points %d, points before %d, gained %d, predicted %g\n",
+				sample.EventId, sample.RoutePoints, sample.UserPointsBefore, counterexample.Gain, counterexample.Predicted,
+			)
+		}
+	}
+	return ExitOK
+}
@@ -0,0 +1,184 @@
+package database
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type ApiKeyRole string
+
+const (
+	ReadOnlyRole ApiKeyRole = "read-only"
+	AdminRole    ApiKeyRole = "admin"
+
+	apiKeyPrefix = "hb_"
+	// random bytes of a key, encoded as base64 after the prefix
+	apiKeySize = 32
+	// characters of a key stored in clear to tell keys apart
+	apiKeyHintLength = len(apiKeyPrefix) + 6
+)
+
+func ParseApiKeyRole(role string) (ApiKeyRole, error) {
+	switch ApiKeyRole(role) {
+	case ReadOnlyRole, AdminRole:
+		return ApiKeyRole(role), nil
+	}
+	return "", fmt.Errorf("unknown role %s, use %s or %s", role, ReadOnlyRole, AdminRole)
+}
+
+// Allows tells whether the role may access routes requiring the given role. Admins may access all routes.
+func (role ApiKeyRole) Allows(required ApiKeyRole) bool {
+	return role == AdminRole || role == required
+}
+
+type ApiKey struct {
+	Id   int        `json:"id"`
+	Name string     `json:"name"`
+	Role ApiKeyRole `json:"role"`
+	// first characters of the key
+	Hint      string `json:"hint"`
+	CreatedAt int64  `json:"created_at"`
+	RevokedAt *int64 `json:"revoked_at"`
+}
+
+type ApiKeyRepository struct {
+	db *sql.DB
+}
+
+func CreateApiKeyRepository(db *sql.DB) *ApiKeyRepository {
+	return &ApiKeyRepository{db: db}
+}
+
+func (repo *ApiKeyRepository) Migrate() error {
+	log.Debugf("Migrating API key repository...")
+	query := `
+		CREATE TABLE IF NOT EXISTS apiKeys(
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			role TEXT NOT NULL,
+			keyHash TEXT NOT NULL UNIQUE,
+			hint TEXT NOT NULL,
+			createdAt INTEGER NOT NULL,
+			revokedAt INTEGER
+		);
+	`
+	_, err := repo.db.Exec(query)
+	return err
+}
+
+func (repo *ApiKeyRepository) Conn() *sql.DB {
+	return repo.db
+}
+
+// keys are random, so a plain SHA-256 is enough to keep them from being read out of the database
+func hashApiKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+/*
+CreateApiKey mints a new key with the given role. Only the hash of the key is
+stored, so the returned key cannot be retrieved later.
+*/
+func (repo *ApiKeyRepository) CreateApiKey(name string, role ApiKeyRole) (string, *ApiKey, error) {
+	secret := make([]byte, apiKeySize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, err
+	}
+	key := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	apiKey := ApiKey{
+		Name:      name,
+		Role:      role,
+		Hint:      key[:apiKeyHintLength],
+		CreatedAt: time.Now().Unix(),
+	}
+
+	query := `
+		INSERT INTO apiKeys(name, role, keyHash, hint, createdAt)
+		VALUES (?, ?, ?, ?, ?)
+	`
+	result, err := repo.Conn().Exec(query, apiKey.Name, apiKey.Role, hashApiKey(key), apiKey.Hint, apiKey.CreatedAt)
+	if err != nil {
+		return "", nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return "", nil, err
+	}
+	apiKey.Id = int(id)
+	return key, &apiKey, nil
+}
+
+// GetActiveApiKey returns the unrevoked key, or nil if there is none.
+func (repo *ApiKeyRepository) GetActiveApiKey(key string) (*ApiKey, error) {
+	query := `
+		SELECT id, name, role, hint, createdAt, revokedAt
+		FROM apiKeys
+		WHERE keyHash = ? AND revokedAt IS NULL
+	`
+	var apiKey ApiKey
+	if err := repo.Conn().QueryRow(query, hashApiKey(key)).Scan(
+		&apiKey.Id, &apiKey.Name, &apiKey.Role, &apiKey.Hint, &apiKey.CreatedAt, &apiKey.RevokedAt,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &apiKey, nil
+}
+
+func (repo *ApiKeyRepository) GetAllApiKeys() (*[]ApiKey, error) {
+	query := `
+		SELECT id, name, role, hint, createdAt, revokedAt
+		FROM apiKeys
+		ORDER BY id
+	`
+	keys := []ApiKey{}
+	rows, err := repo.Conn().Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var apiKey ApiKey
+		if err := rows.Scan(
+			&apiKey.Id, &apiKey.Name, &apiKey.Role, &apiKey.Hint, &apiKey.CreatedAt, &apiKey.RevokedAt,
+		); err != nil {
+			return nil, err
+		}
+		keys = append(keys, apiKey)
+	}
+	return &keys, rows.Err()
+}
+
+func (repo *ApiKeyRepository) CountActiveApiKeys() (int, error) {
+	count := 0
+	err := repo.Conn().QueryRow(`SELECT COUNT(*) FROM apiKeys WHERE revokedAt IS NULL`).Scan(&count)
+	return count, err
+}
+
+// RevokeApiKey revokes the key with the given id, failing if there is no such unrevoked key.
+func (repo *ApiKeyRepository) RevokeApiKey(id int) error {
+	query := `
+		UPDATE apiKeys
+		SET revokedAt = ?
+		WHERE id = ? AND revokedAt IS NULL
+	`
+	result, err := repo.Conn().Exec(query, time.Now().Unix(), id)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return fmt.Errorf("no active API key with id %d", id)
+	}
+	return nil
+}
@@ -17,9 +17,13 @@ const (
 	dataDirectoryPath     = ".data"
 	rootDataDirectoryPath = "/data"
 	defaultDirectoryPath  = dataDirectoryPath + "/" + dbFilename
+
+	// version of the schema the migrations produce, stored as the user_version of the database.
+	// Increase it whenever a migration changes the schema.
+	SchemaVersion = 5
 )
 
-func locateDatabase() (*string, error) {
+func LocateDatabase() (*string, error) {
 	paths := []string{
 		sameDirectoryPath, dataDirectoryPath, rootDataDirectoryPath,
 	}
@@ -42,13 +46,10 @@ func locateDatabase() (*string, error) {
 	return nil, fmt.Errorf("no database file found")
 }
 
-func InitializeDatabase() (*sql.DB, error) {
-	pathName, err := locateDatabase()
-	if err != nil {
-		return nil, err
-	}
-	log.Infof("Using database at location %s", *pathName)
-	db, err := sql.Open("sqlite3", *pathName)
+func InitializeDatabase(pathName string) (*sql.DB, error) {
+	log.Infof("Using database at location %s", pathName)
+	// in WAL mode long reads like exports do not block the writes of the workers
+	db, err := sql.Open("sqlite3", pathName+"?_journal_mode=WAL")
 
 	if err != nil {
 		return nil, err
@@ -60,6 +61,8 @@ func InitializeDatabase() (*sql.DB, error) {
 		&LoginCredentialRepository{db: db},
 		&RouteRepository{db: db},
 		&PointGainsRepository{db: db},
+		&ModelRepository{db: db},
+		&ApiKeyRepository{db: db},
 	}
 
 	for _, repo := range repositories {
@@ -72,15 +75,29 @@ func InitializeDatabase() (*sql.DB, error) {
 		}
 	}
 
+	if _, err := db.Exec(fmt.Sprintf("PRAGMA user_version = %d", SchemaVersion)); err != nil {
+		db.Close()
+		return nil, err
+	}
+
 	return db, nil
 }
 
+// GetSchemaVersion returns the schema version of the database, 0 for databases no version was written to.
+func GetSchemaVersion(db *sql.DB) (int, error) {
+	version := 0
+	err := db.QueryRow("PRAGMA user_version").Scan(&version)
+	return version, err
+}
+
 type DatabaseRepository struct {
 	User       *UserRepository
 	Route      *RouteRepository
 	Login      *LoginCredentialRepository
 	Event      *EventRepository
 	PointGains *PointGainsRepository
+	Model      *ModelRepository
+	ApiKey     *ApiKeyRepository
 }
 
 func GetRepository(db *sql.DB) *DatabaseRepository {
@@ -89,6 +106,8 @@ func GetRepository(db *sql.DB) *DatabaseRepository {
 	login := CreateLoginCredentialRepository(db)
 	event := CreateEventRepository(db)
 	pointGains := CreatePointGainsRepository(db)
+	model := CreateModelRepository(db)
+	apiKey := CreateApiKeyRepository(db)
 
 	return &DatabaseRepository{
 		User:       user,
@@ -96,5 +115,7 @@ func GetRepository(db *sql.DB) *DatabaseRepository {
 		Login:      login,
 		Event:      event,
 		PointGains: pointGains,
+		Model:      model,
+		ApiKey:     apiKey,
 	}
 }
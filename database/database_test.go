@@ -0,0 +1,39 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteDuringOpenRead(t *testing.T) {
+	db, err := InitializeDatabase(filepath.Join(t.TempDir(), "db.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	repo := PointGainsRepository{db: db}
+	before := 100
+	for eventId := 1; eventId <= 2; eventId++ {
+		if err := repo.CreatePointsGainEntry(&PointGainRecord{
+			EventId: eventId, UserId: 7, RoutePoints: 50, UserPointsBefore: &before, EventDate: 1000,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// an export holds its cursor while it streams
+	rows, err := db.Query("SELECT eventId FROM pointsGain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		t.Fatal("expected samples to read")
+	}
+
+	if err := repo.CreatePointsGainEntry(&PointGainRecord{
+		EventId: 3, UserId: 7, RoutePoints: 50, UserPointsBefore: &before, EventDate: 2000,
+	}); err != nil {
+		t.Errorf("failed to write while reading: %+v", err)
+	}
+}
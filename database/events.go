@@ -40,3 +40,47 @@ func (repo *EventRepository) Conn() *sql.DB {
 func CreateEventRepository(db *sql.DB) *EventRepository {
 	return &EventRepository{db: db}
 }
+
+func (repo *EventRepository) SaveEvent(event *EventRecord) error {
+	query := `
+		INSERT INTO events(id, title, routeId, date, organizerId)
+		VALUES(?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			title=excluded.title,
+			routeId=excluded.routeId,
+			date=excluded.date,
+			organizerId=excluded.organizerId;
+	`
+	_, err := PrepareAndExecute(
+		repo.Conn(), query,
+		event.Id, event.Title, event.RouteId, event.Date.Unix(), event.OrganizerId,
+	)
+	return err
+}
+
+// GetEventsWithoutRoutePoints returns the events whose route is unknown or has no points.
+func (repo *EventRepository) GetEventsWithoutRoutePoints() (*[]EventRecord, error) {
+	query := `
+		SELECT events.id, events.title, events.routeId, events.date, events.organizerId
+		FROM events
+		LEFT JOIN routes ON routes.id = events.routeId
+		WHERE routes.points IS NULL
+		ORDER BY events.date ASC
+	`
+	rows, err := repo.Conn().Query(query)
+	if err != nil {
+		return nil, err
+	}
+
+	events := []EventRecord{}
+	for rows.Next() {
+		var event EventRecord
+		var date int64
+		if err := rows.Scan(&event.Id, &event.Title, &event.RouteId, &date, &event.OrganizerId); err != nil {
+			return nil, err
+		}
+		event.Date = time.Unix(date, 0)
+		events = append(events, event)
+	}
+	return &events, nil
+}
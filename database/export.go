@@ -0,0 +1,191 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+type ColumnType string
+
+const (
+	IntegerColumn ColumnType = "integer"
+	RealColumn    ColumnType = "real"
+	TextColumn    ColumnType = "text"
+)
+
+type ExportColumn struct {
+	Name     string     `json:"name"`
+	Type     ColumnType `json:"type"`
+	Nullable bool       `json:"nullable"`
+	// column or SQL expression the values are selected from
+	expression string
+}
+
+// ExportDataset is a table that can be exported row by row, see ExportDatasets.
+type ExportDataset struct {
+	Name    string         `json:"name"`
+	Columns []ExportColumn `json:"columns"`
+	table   string
+	order   string
+	filters queryColumns
+}
+
+var exportDatasets = []ExportDataset{
+	{
+		Name: "point-gains",
+		Columns: []ExportColumn{
+			{"event_id", IntegerColumn, false, "eventId"},
+			{"user_id", IntegerColumn, false, "userId"},
+			{"route_points", IntegerColumn, false, "routePoints"},
+			{"points_before", IntegerColumn, true, "pointsBefore"},
+			{"points_after", IntegerColumn, true, "pointsAfter"},
+			{"event_date", IntegerColumn, false, "eventDate"},
+			{"kind", TextColumn, false, "sampleKind"},
+			{"activity", TextColumn, false, "activity"},
+			{"route_id", IntegerColumn, true, "routeId"},
+		},
+		table:   "pointsGain",
+		order:   "eventDate, eventId, userId",
+		filters: pointsGainColumns,
+	},
+	{
+		Name: "routes",
+		Columns: []ExportColumn{
+			{"id", IntegerColumn, false, "id"},
+			{"name", TextColumn, false, "name"},
+			{"points", IntegerColumn, true, "points"},
+			{"scale", TextColumn, false, "scale"},
+			{"elevation", IntegerColumn, false, "elevation"},
+			{"distance", RealColumn, false, "distance"},
+			{"elevation_gain", RealColumn, true, "elevation_gain"},
+			{"elevation_loss", RealColumn, true, "elevation_loss"},
+			{"t1_distance", RealColumn, true, "t1_distance"},
+			{"t2_distance", RealColumn, true, "t2_distance"},
+			{"t3_distance", RealColumn, true, "t3_distance"},
+			{"t4_distance", RealColumn, true, "t4_distance"},
+			{"t5_distance", RealColumn, true, "t5_distance"},
+			{"t6_distance", RealColumn, true, "t6_distance"},
+			{"crawled_at", IntegerColumn, true, "crawledAt"},
+		},
+		table:   "routes",
+		order:   "id",
+		filters: queryColumns{routePoints: "points"},
+	},
+	{
+		Name: "events",
+		Columns: []ExportColumn{
+			{"id", IntegerColumn, false, "id"},
+			{"title", TextColumn, false, "title"},
+			{"route_id", IntegerColumn, false, "routeId"},
+			{"date", IntegerColumn, false, "date"},
+			{"organizer_id", IntegerColumn, false, "organizerId"},
+		},
+		table:   "events",
+		order:   "date, id",
+		filters: queryColumns{eventId: "id", eventDate: "date"},
+	},
+	{
+		Name: "users",
+		Columns: []ExportColumn{
+			{"id", IntegerColumn, false, "id"},
+			{"name", TextColumn, false, "name"},
+			{"last_name", TextColumn, false, "lastname"},
+		},
+		table:   "users",
+		order:   "id",
+		filters: queryColumns{userId: "id"},
+	},
+}
+
+func ExportDatasets() []ExportDataset {
+	return exportDatasets
+}
+
+func GetExportDataset(name string) (*ExportDataset, error) {
+	names := []string{}
+	for i := range exportDatasets {
+		if exportDatasets[i].Name == name {
+			return &exportDatasets[i], nil
+		}
+		names = append(names, exportDatasets[i].Name)
+	}
+	return nil, fmt.Errorf("unknown dataset %s, use one of %s", name, strings.Join(names, ", "))
+}
+
+// SelectColumns returns the columns with the given names in their order, or all columns if no names are given.
+func (dataset *ExportDataset) SelectColumns(names []string) ([]ExportColumn, error) {
+	if len(names) == 0 {
+		return dataset.Columns, nil
+	}
+	columns := []ExportColumn{}
+	for _, name := range names {
+		found := false
+		for _, column := range dataset.Columns {
+			if column.Name == name {
+				columns = append(columns, column)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("dataset %s has no column %s", dataset.Name, name)
+		}
+	}
+	return columns, nil
+}
+
+// Query selects the columns of the rows matching the filters of the query. The caller must close the rows.
+func (dataset *ExportDataset) Query(conn *sql.DB, columns []ExportColumn, params *PointGainsQuery) (*sql.Rows, error) {
+	where, args, err := params.filterOn(dataset.filters)
+	if err != nil {
+		return nil, fmt.Errorf("%s of dataset %s", err.Error(), dataset.Name)
+	}
+	expressions := []string{}
+	for _, column := range columns {
+		expressions = append(expressions, column.expression)
+	}
+	query := fmt.Sprintf(
+		`SELECT %s FROM %s WHERE %s ORDER BY %s LIMIT ? OFFSET ?`,
+		strings.Join(expressions, ", "), dataset.table, where, dataset.order,
+	)
+	args = append(args, params.Limit, params.Skip)
+	return conn.Query(query, args...)
+}
+
+// ScanExportRow scans the current row into int64, float64 or string values, nil where null.
+func ScanExportRow(rows *sql.Rows, columns []ExportColumn) ([]any, error) {
+	destinations := make([]any, len(columns))
+	for i, column := range columns {
+		switch column.Type {
+		case IntegerColumn:
+			destinations[i] = &sql.NullInt64{}
+		case RealColumn:
+			destinations[i] = &sql.NullFloat64{}
+		default:
+			destinations[i] = &sql.NullString{}
+		}
+	}
+	if err := rows.Scan(destinations...); err != nil {
+		return nil, err
+	}
+
+	values := make([]any, len(columns))
+	for i, destination := range destinations {
+		switch value := destination.(type) {
+		case *sql.NullInt64:
+			if value.Valid {
+				values[i] = value.Int64
+			}
+		case *sql.NullFloat64:
+			if value.Valid {
+				values[i] = value.Float64
+			}
+		case *sql.NullString:
+			if value.Valid {
+				values[i] = value.String
+			}
+		}
+	}
+	return values, nil
+}
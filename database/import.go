@@ -0,0 +1,606 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+type ImportFormat string
+
+const (
+	CSVImport    ImportFormat = "csv"
+	NDJSONImport ImportFormat = "ndjson"
+	SQLiteImport ImportFormat = "sqlite"
+)
+
+// ErrInvalidImport is wrapped by the errors of imports whose data cannot be read, as opposed to failures of the database.
+var ErrInvalidImport = errors.New("invalid import")
+
+/*
+InferImportFormat guesses the format from the extension of the file name and
+InferImportDataset the dataset from file names as given by /export, e.g.
+hb_point-gains.csv.
+*/
+func InferImportFormat(filename string) ImportFormat {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return CSVImport
+	case ".ndjson", ".jsonl":
+		return NDJSONImport
+	default:
+		return SQLiteImport
+	}
+}
+
+func InferImportDataset(filename string) string {
+	name := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	return strings.TrimPrefix(name, "hb_")
+}
+
+// ImportRow holds the values of a row by export column name. Columns the source lacks are left out.
+type ImportRow map[string]any
+
+// ImportSource yields the rows of a dataset to import, and io.EOF after the last row.
+type ImportSource interface {
+	Next() (ImportRow, error)
+}
+
+type ImportUpdate struct {
+	Key    string   `json:"key"`
+	Fields []string `json:"fields"`
+}
+
+// ImportConflict is a column both rows have different values of.
+type ImportConflict struct {
+	Key      string `json:"key"`
+	Field    string `json:"field"`
+	Local    any    `json:"local"`
+	Incoming any    `json:"incoming"`
+	Kept     any    `json:"kept"`
+}
+
+type DatasetImportReport struct {
+	Dataset   string           `json:"dataset"`
+	Read      int              `json:"read"`
+	Inserted  []string         `json:"inserted"`
+	Updated   []ImportUpdate   `json:"updated"`
+	Unchanged int              `json:"unchanged"`
+	Conflicts []ImportConflict `json:"conflicts"`
+}
+
+type ImportReport struct {
+	// dry runs roll the import back
+	DryRun   bool                  `json:"dry_run"`
+	Datasets []DatasetImportReport `json:"datasets"`
+}
+
+// resolver picks the merged value of a column of two rows with the same key.
+type resolver func(column string, local ImportRow, incoming ImportRow) any
+
+// normalizer corrects incoming rows written by older versions before they are merged.
+type normalizer func(row ImportRow)
+
+// preferLocal keeps the local value and fills it from the incoming row where unknown.
+func preferLocal(column string, local ImportRow, incoming ImportRow) any {
+	if local[column] != nil {
+		return local[column]
+	}
+	return incoming[column]
+}
+
+func compareValues(a any, b any) int {
+	switch a := a.(type) {
+	case int64:
+		if b, ok := b.(int64); ok {
+			return int(a - b)
+		}
+	case float64:
+		if b, ok := b.(float64); ok {
+			if a < b {
+				return -1
+			} else if a > b {
+				return 1
+			}
+			return 0
+		}
+	case string:
+		if b, ok := b.(string); ok {
+			return strings.Compare(a, b)
+		}
+	}
+	return 0
+}
+
+func pickValue(column string, local ImportRow, incoming ImportRow, preferIncoming func(a any, b any) bool) any {
+	if local[column] == nil {
+		return incoming[column]
+	}
+	if incoming[column] != nil && preferIncoming(incoming[column], local[column]) {
+		return incoming[column]
+	}
+	return local[column]
+}
+
+/*
+resolvePointsGain prefers the earliest snapshot of the points before and the
+latest checkpoint of the points after. Live samples snapshot the points before
+and check the points after soon after the event, while historical samples have
+no points before and take the points after long after the event, so live
+samples win the points before, points after and kind regardless of the values,
+even while they are still waiting for their points after.
+*/
+func resolvePointsGain(column string, local ImportRow, incoming ImportRow) any {
+	switch column {
+	case "points_before", "points_after", "kind":
+		localLive := local["kind"] == string(LiveSample)
+		incomingLive := incoming["kind"] == string(LiveSample)
+		if localLive != incomingLive && local["kind"] != nil && incoming["kind"] != nil {
+			if incomingLive {
+				return incoming[column]
+			}
+			return local[column]
+		}
+		if column == "points_before" {
+			return pickValue(column, local, incoming, func(a any, b any) bool { return compareValues(a, b) < 0 })
+		}
+		if column == "points_after" {
+			return pickValue(column, local, incoming, func(a any, b any) bool { return compareValues(a, b) > 0 })
+		}
+	}
+	return preferLocal(column, local, incoming)
+}
+
+// normalizePointsGain forgets the points before that historical samples of older versions mirrored from their points after.
+func normalizePointsGain(row ImportRow) {
+	if row["kind"] == string(HistoricalSample) {
+		row["points_before"] = nil
+	}
+}
+
+// resolveRoute prefers the values of the more recently crawled route.
+func resolveRoute(column string, local ImportRow, incoming ImportRow) any {
+	if incoming["crawled_at"] != nil && (local["crawled_at"] == nil || compareValues(incoming["crawled_at"], local["crawled_at"]) > 0) {
+		return pickValue(column, incoming, local, func(any, any) bool { return false })
+	}
+	return preferLocal(column, local, incoming)
+}
+
+type importTable struct {
+	dataset   string
+	keys      []string
+	resolve   resolver
+	normalize normalizer
+}
+
+// tables in the order they are imported from another database
+var importTables = []importTable{
+	{"users", []string{"id"}, preferLocal, nil},
+	{"routes", []string{"id"}, resolveRoute, nil},
+	{"events", []string{"id"}, preferLocal, nil},
+	{"point-gains", []string{"event_id", "user_id"}, resolvePointsGain, normalizePointsGain},
+}
+
+func getImportTable(dataset string) (*importTable, error) {
+	for i := range importTables {
+		if importTables[i].dataset == dataset {
+			return &importTables[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: cannot import dataset %s", ErrInvalidImport, dataset)
+}
+
+func rowKey(keys []string, row ImportRow) string {
+	parts := []string{}
+	for _, key := range keys {
+		parts = append(parts, fmt.Sprint(row[key]))
+	}
+	return strings.Join(parts, "/")
+}
+
+func (dataset *ExportDataset) column(name string) *ExportColumn {
+	for i := range dataset.Columns {
+		if dataset.Columns[i].Name == name {
+			return &dataset.Columns[i]
+		}
+	}
+	return nil
+}
+
+func selectLocalRow(tx *sql.Tx, dataset *ExportDataset, table *importTable, row ImportRow) (ImportRow, error) {
+	expressions := []string{}
+	for _, column := range dataset.Columns {
+		expressions = append(expressions, column.expression)
+	}
+	conditions := []string{}
+	args := []any{}
+	for _, key := range table.keys {
+		conditions = append(conditions, dataset.column(key).expression+" = ?")
+		args = append(args, row[key])
+	}
+	query := fmt.Sprintf(
+		`SELECT %s FROM %s WHERE %s`,
+		strings.Join(expressions, ", "), dataset.table, strings.Join(conditions, " AND "),
+	)
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	values, err := ScanExportRow(rows, dataset.Columns)
+	if err != nil {
+		return nil, err
+	}
+	local := ImportRow{}
+	for i, column := range dataset.Columns {
+		local[column.Name] = values[i]
+	}
+	return local, nil
+}
+
+func insertRow(tx *sql.Tx, dataset *ExportDataset, row ImportRow) error {
+	columns := []string{}
+	placeholders := []string{}
+	args := []any{}
+	for _, column := range dataset.Columns {
+		if value, found := row[column.Name]; found && value != nil {
+			columns = append(columns, column.expression)
+			placeholders = append(placeholders, "?")
+			args = append(args, value)
+		}
+	}
+	query := fmt.Sprintf(
+		`INSERT INTO %s(%s) VALUES(%s)`,
+		dataset.table, strings.Join(columns, ", "), strings.Join(placeholders, ", "),
+	)
+	_, err := tx.Exec(query, args...)
+	return err
+}
+
+func updateRow(tx *sql.Tx, dataset *ExportDataset, table *importTable, row ImportRow, fields []string) error {
+	assignments := []string{}
+	args := []any{}
+	for _, field := range fields {
+		assignments = append(assignments, dataset.column(field).expression+" = ?")
+		args = append(args, row[field])
+	}
+	conditions := []string{}
+	for _, key := range table.keys {
+		conditions = append(conditions, dataset.column(key).expression+" = ?")
+		args = append(args, row[key])
+	}
+	query := fmt.Sprintf(
+		`UPDATE %s SET %s WHERE %s`,
+		dataset.table, strings.Join(assignments, ", "), strings.Join(conditions, " AND "),
+	)
+	_, err := tx.Exec(query, args...)
+	return err
+}
+
+// mergeRow inserts the incoming row or merges it into the local row with the same key.
+func mergeRow(tx *sql.Tx, dataset *ExportDataset, table *importTable, incoming ImportRow, report *DatasetImportReport) error {
+	for _, key := range table.keys {
+		if incoming[key] == nil {
+			return fmt.Errorf("%w: row %d of %s has no %s", ErrInvalidImport, report.Read, dataset.Name, key)
+		}
+	}
+	if table.normalize != nil {
+		table.normalize(incoming)
+	}
+	key := rowKey(table.keys, incoming)
+	local, err := selectLocalRow(tx, dataset, table, incoming)
+	if err != nil {
+		return err
+	}
+	if local == nil {
+		if err := insertRow(tx, dataset, incoming); err != nil {
+			// rows lacking required columns violate the constraints of the table
+			var sqliteErr sqlite3.Error
+			if errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrConstraint {
+				return fmt.Errorf("%w: failed to insert %s %s: %w", ErrInvalidImport, dataset.Name, key, err)
+			}
+			return fmt.Errorf("failed to insert %s %s: %w", dataset.Name, key, err)
+		}
+		report.Inserted = append(report.Inserted, key)
+		return nil
+	}
+
+	merged := ImportRow{}
+	fields := []string{}
+	// resolve against the unmerged rows, as resolvers may look at other columns
+	for _, column := range dataset.Columns {
+		value := table.resolve(column.Name, local, incoming)
+		merged[column.Name] = value
+		if local[column.Name] != nil && incoming[column.Name] != nil &&
+			!reflect.DeepEqual(local[column.Name], incoming[column.Name]) {
+			report.Conflicts = append(report.Conflicts, ImportConflict{
+				Key: key, Field: column.Name, Local: local[column.Name], Incoming: incoming[column.Name], Kept: value,
+			})
+		}
+		if !reflect.DeepEqual(value, local[column.Name]) {
+			fields = append(fields, column.Name)
+		}
+	}
+	if len(fields) == 0 {
+		report.Unchanged++
+		return nil
+	}
+	for _, key := range table.keys {
+		merged[key] = local[key]
+	}
+	if err := updateRow(tx, dataset, table, merged, fields); err != nil {
+		return fmt.Errorf("failed to update %s %s: %w", dataset.Name, key, err)
+	}
+	report.Updated = append(report.Updated, ImportUpdate{Key: key, Fields: fields})
+	return nil
+}
+
+func importDataset(tx *sql.Tx, datasetName string, source ImportSource) (*DatasetImportReport, error) {
+	dataset, err := GetExportDataset(datasetName)
+	if err != nil {
+		return nil, err
+	}
+	table, err := getImportTable(datasetName)
+	if err != nil {
+		return nil, err
+	}
+	report := DatasetImportReport{
+		Dataset:   datasetName,
+		Inserted:  []string{},
+		Updated:   []ImportUpdate{},
+		Conflicts: []ImportConflict{},
+	}
+	for {
+		row, err := source.Next()
+		if err == io.EOF {
+			return &report, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to read row %d of %s: %w", ErrInvalidImport, report.Read+1, datasetName, err)
+		}
+		report.Read++
+		if err := mergeRow(tx, dataset, table, row, &report); err != nil {
+			return nil, err
+		}
+	}
+}
+
+/*
+importInTransaction runs the imports in one transaction, so that a failing
+import leaves the database unchanged, and rolls dry runs back.
+*/
+func importInTransaction(conn *sql.DB, dryRun bool, run func(tx *sql.Tx, report *ImportReport) error) (*ImportReport, error) {
+	tx, err := conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	report := ImportReport{DryRun: dryRun, Datasets: []DatasetImportReport{}}
+	if err := run(tx, &report); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if dryRun {
+		return &report, tx.Rollback()
+	}
+	return &report, tx.Commit()
+}
+
+// parseImportValue converts a value read from an export to the type of the column.
+func parseImportValue(column *ExportColumn, value any) (any, error) {
+	switch value := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		if column.Type == TextColumn {
+			return value, nil
+		}
+		if len(value) == 0 {
+			return nil, nil
+		}
+		if column.Type == IntegerColumn {
+			return strconv.ParseInt(value, 10, 64)
+		}
+		return strconv.ParseFloat(value, 64)
+	case json.Number:
+		if column.Type == IntegerColumn {
+			return value.Int64()
+		}
+		if column.Type == RealColumn {
+			return value.Float64()
+		}
+		return value.String(), nil
+	}
+	return nil, fmt.Errorf("unexpected value %v of column %s", value, column.Name)
+}
+
+type csvImportSource struct {
+	dataset *ExportDataset
+	reader  *csv.Reader
+	header  []*ExportColumn
+}
+
+func createCSVImportSource(dataset *ExportDataset, r io.Reader) (ImportSource, error) {
+	reader := csv.NewReader(r)
+	names, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read csv header: %w", ErrInvalidImport, err)
+	}
+	header := []*ExportColumn{}
+	for _, name := range names {
+		column := dataset.column(strings.TrimSpace(name))
+		if column == nil {
+			return nil, fmt.Errorf("%w: dataset %s has no column %s", ErrInvalidImport, dataset.Name, name)
+		}
+		header = append(header, column)
+	}
+	return &csvImportSource{dataset: dataset, reader: reader, header: header}, nil
+}
+
+func (source *csvImportSource) Next() (ImportRow, error) {
+	record, err := source.reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	row := ImportRow{}
+	for i, column := range source.header {
+		if row[column.Name], err = parseImportValue(column, record[i]); err != nil {
+			return nil, err
+		}
+	}
+	return row, nil
+}
+
+type ndjsonImportSource struct {
+	dataset *ExportDataset
+	decoder *json.Decoder
+}
+
+func (source *ndjsonImportSource) Next() (ImportRow, error) {
+	object := map[string]any{}
+	if err := source.decoder.Decode(&object); err != nil {
+		return nil, err
+	}
+	row := ImportRow{}
+	for name, value := range object {
+		column := source.dataset.column(name)
+		if column == nil {
+			return nil, fmt.Errorf("dataset %s has no column %s", source.dataset.Name, name)
+		}
+		parsed, err := parseImportValue(column, value)
+		if err != nil {
+			return nil, err
+		}
+		row[name] = parsed
+	}
+	return row, nil
+}
+
+// ImportExport merges an export of one dataset in CSV or NDJSON, as written by /export, into the database.
+func ImportExport(conn *sql.DB, datasetName string, format ImportFormat, r io.Reader, dryRun bool) (*ImportReport, error) {
+	dataset, err := GetExportDataset(datasetName)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidImport, err)
+	}
+	var source ImportSource
+	switch format {
+	case CSVImport:
+		if source, err = createCSVImportSource(dataset, r); err != nil {
+			return nil, err
+		}
+	case NDJSONImport:
+		decoder := json.NewDecoder(r)
+		decoder.UseNumber()
+		source = &ndjsonImportSource{dataset: dataset, decoder: decoder}
+	default:
+		return nil, fmt.Errorf("%w: cannot import %s exports", ErrInvalidImport, format)
+	}
+	return importInTransaction(conn, dryRun, func(tx *sql.Tx, report *ImportReport) error {
+		datasetReport, err := importDataset(tx, datasetName, source)
+		if err != nil {
+			return err
+		}
+		report.Datasets = append(report.Datasets, *datasetReport)
+		return nil
+	})
+}
+
+type rowsImportSource struct {
+	rows    *sql.Rows
+	columns []ExportColumn
+}
+
+func (source *rowsImportSource) Next() (ImportRow, error) {
+	if !source.rows.Next() {
+		if err := source.rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	values, err := ScanExportRow(source.rows, source.columns)
+	if err != nil {
+		return nil, err
+	}
+	row := ImportRow{}
+	for i, column := range source.columns {
+		row[column.Name] = values[i]
+	}
+	return row, nil
+}
+
+// sourceColumns returns the columns of the dataset the table of another database has, which may predate migrations.
+func sourceColumns(source *sql.DB, dataset *ExportDataset) ([]ExportColumn, error) {
+	rows, err := source.Query(fmt.Sprintf(`SELECT name FROM pragma_table_info('%s')`, dataset.table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	existing := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		existing[name] = true
+	}
+	columns := []ExportColumn{}
+	for _, column := range dataset.Columns {
+		if existing[column.expression] {
+			columns = append(columns, column)
+		}
+	}
+	return columns, rows.Err()
+}
+
+// ImportDatabase merges the users, routes, events and samples of the SQLite database at the path into the database.
+func ImportDatabase(conn *sql.DB, path string, dryRun bool) (*ImportReport, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidImport, err)
+	}
+	source, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?mode=ro", path))
+	if err != nil {
+		return nil, err
+	}
+	defer source.Close()
+
+	return importInTransaction(conn, dryRun, func(tx *sql.Tx, report *ImportReport) error {
+		for _, table := range importTables {
+			dataset, err := GetExportDataset(table.dataset)
+			if err != nil {
+				return err
+			}
+			// the upload is not a SQLite database if its tables cannot be read
+			columns, err := sourceColumns(source, dataset)
+			if err != nil {
+				return fmt.Errorf("%w: %w", ErrInvalidImport, err)
+			}
+			if len(columns) == 0 {
+				// the other instance never created the table
+				continue
+			}
+			rows, err := dataset.Query(source, columns, &PointGainsQuery{Limit: -1})
+			if err != nil {
+				return fmt.Errorf("%w: %w", ErrInvalidImport, err)
+			}
+			datasetReport, err := importDataset(tx, table.dataset, &rowsImportSource{rows: rows, columns: columns})
+			rows.Close()
+			if err != nil {
+				return err
+			}
+			report.Datasets = append(report.Datasets, *datasetReport)
+		}
+		return nil
+	})
+}
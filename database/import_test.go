@@ -0,0 +1,99 @@
+package database
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestImportResolvesPointsGain(t *testing.T) {
+	db, repo := createTestRepository(t)
+	integer := func(value int) *int { return &value }
+
+	tests := []struct {
+		name            string
+		local, incoming PointGainRecord
+		expected        PointGainRecord
+	}{
+		{
+			"live over larger historical",
+			PointGainRecord{UserPointsBefore: integer(100), UserPointsAfter: integer(110), Kind: LiveSample},
+			PointGainRecord{UserPointsAfter: integer(500), Kind: HistoricalSample},
+			PointGainRecord{UserPointsBefore: integer(100), UserPointsAfter: integer(110), Kind: LiveSample},
+		},
+		{
+			"incoming live over historical",
+			PointGainRecord{UserPointsAfter: integer(500), Kind: HistoricalSample},
+			PointGainRecord{UserPointsBefore: integer(100), UserPointsAfter: integer(110), Kind: LiveSample},
+			PointGainRecord{UserPointsBefore: integer(100), UserPointsAfter: integer(110), Kind: LiveSample},
+		},
+		{
+			"dangling live over complete historical",
+			PointGainRecord{UserPointsBefore: integer(100), Kind: LiveSample},
+			PointGainRecord{UserPointsAfter: integer(500), Kind: HistoricalSample},
+			PointGainRecord{UserPointsBefore: integer(100), Kind: LiveSample},
+		},
+		{
+			"incoming dangling live over complete historical",
+			PointGainRecord{UserPointsAfter: integer(500), Kind: HistoricalSample},
+			PointGainRecord{UserPointsBefore: integer(100), Kind: LiveSample},
+			PointGainRecord{UserPointsBefore: integer(100), Kind: LiveSample},
+		},
+		{
+			"complete live fills dangling live",
+			PointGainRecord{UserPointsBefore: integer(100), Kind: LiveSample},
+			PointGainRecord{UserPointsBefore: integer(100), UserPointsAfter: integer(120), Kind: LiveSample},
+			PointGainRecord{UserPointsBefore: integer(100), UserPointsAfter: integer(120), Kind: LiveSample},
+		},
+		{
+			"latest checkpoint of live samples",
+			PointGainRecord{UserPointsBefore: integer(90), UserPointsAfter: integer(110), Kind: LiveSample},
+			PointGainRecord{UserPointsBefore: integer(100), UserPointsAfter: integer(120), Kind: LiveSample},
+			PointGainRecord{UserPointsBefore: integer(90), UserPointsAfter: integer(120), Kind: LiveSample},
+		},
+		{
+			"latest checkpoint of historical samples",
+			PointGainRecord{UserPointsAfter: integer(500), Kind: HistoricalSample},
+			PointGainRecord{UserPointsAfter: integer(480), Kind: HistoricalSample},
+			PointGainRecord{UserPointsAfter: integer(500), Kind: HistoricalSample},
+		},
+	}
+
+	lines := []string{}
+	for i, test := range tests {
+		local := test.local
+		local.EventId, local.UserId, local.RoutePoints, local.EventDate = i+1, 7, 50, 1000
+		if err := repo.PointGains.CreatePointsGainEntry(&local); err != nil {
+			t.Fatal(err)
+		}
+		line, _ := json.Marshal(map[string]any{
+			"event_id": i + 1, "user_id": 7, "route_points": 50, "event_date": 1000,
+			"points_before": test.incoming.UserPointsBefore, "points_after": test.incoming.UserPointsAfter,
+			"kind": test.incoming.Kind, "activity": DefaultActivity,
+		})
+		lines = append(lines, string(line))
+	}
+	if _, err := ImportExport(db, "point-gains", NDJSONImport, strings.NewReader(strings.Join(lines, "\n")), false); err != nil {
+		t.Fatal(err)
+	}
+
+	format := func(value *int) any {
+		if value == nil {
+			return nil
+		}
+		return *value
+	}
+	for i, test := range tests {
+		records, err := repo.PointGains.GetPointGainsByEventId(i + 1)
+		if err != nil || len(*records) != 1 {
+			t.Fatalf("%s: %v, %v", test.name, records, err)
+		}
+		merged := (*records)[0]
+		if format(merged.UserPointsBefore) != format(test.expected.UserPointsBefore) ||
+			format(merged.UserPointsAfter) != format(test.expected.UserPointsAfter) || merged.Kind != test.expected.Kind {
+			t.Errorf("%s: merged %v -> %v %s, expected %v -> %v %s", test.name,
+				format(merged.UserPointsBefore), format(merged.UserPointsAfter), merged.Kind,
+				format(test.expected.UserPointsBefore), format(test.expected.UserPointsAfter), test.expected.Kind)
+		}
+	}
+}
@@ -104,6 +104,31 @@ func (repo *LoginCredentialRepository) GetAvailableAccount() (*Account, error) {
 	return &account, nil
 }
 
+func (repo *LoginCredentialRepository) GetAvailableAccounts(limit int) ([]Account, error) {
+	query := `
+		SELECT username, password
+		FROM accounts
+		ORDER BY RANDOM()
+		LIMIT ?
+	`
+	accounts := []Account{}
+	rows, err := repo.Conn().Query(query, limit)
+	if err != nil {
+		return accounts, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var account Account
+		if err := rows.Scan(&account.Username, &account.Password); err != nil {
+			return []Account{}, err
+		}
+		accounts = append(accounts, account)
+	}
+
+	return accounts, nil
+}
+
 func (repo *LoginCredentialRepository) GetAllAvailableAccounts() ([]Account, error) {
 	query := `
 		SELECT username, password
@@ -0,0 +1,262 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type ModelRepository struct {
+	db *sql.DB
+}
+
+type ModelRecord struct {
+	Id          int                `json:"id"`
+	Type        string             `json:"type"`
+	Params      []float64          `json:"params"`
+	Fingerprint string             `json:"fingerprint"`
+	InitialLoss float64            `json:"initial_loss"`
+	Loss        float64            `json:"loss"`
+	Metrics     map[string]float64 `json:"metrics"`
+	Active      bool               `json:"active"`
+	CreatedAt   int64              `json:"created_at"`
+	ActivatedAt *int64             `json:"activated_at"`
+}
+
+func CreateModelRepository(db *sql.DB) *ModelRepository {
+	return &ModelRepository{db: db}
+}
+
+func (repo *ModelRepository) Conn() *sql.DB {
+	return repo.db
+}
+
+func (repo *ModelRepository) Migrate() error {
+	log.Debugf("Migrating models repository...")
+	query := `
+		CREATE TABLE IF NOT EXISTS models(
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			modelType TEXT NOT NULL,
+			params TEXT NOT NULL,
+			fingerprint TEXT NOT NULL,
+			initialLoss REAL NOT NULL,
+			loss REAL NOT NULL,
+			metrics TEXT NOT NULL DEFAULT '{}',
+			active INTEGER NOT NULL DEFAULT 0,
+			createdAt INTEGER NOT NULL,
+			activatedAt INTEGER DEFAULT NULL
+		);
+		CREATE TABLE IF NOT EXISTS modelActivations(
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			modelId INTEGER NOT NULL,
+			activatedAt INTEGER NOT NULL,
+			rolledBack INTEGER NOT NULL DEFAULT 0
+		);
+	`
+	_, err := repo.db.Exec(query)
+	return err
+}
+
+const modelColumns = `
+	id, modelType, params, fingerprint, initialLoss, loss, metrics, active, createdAt, activatedAt
+`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanModel(row rowScanner) (*ModelRecord, error) {
+	var model ModelRecord
+	var params, metrics string
+	if err := row.Scan(
+		&model.Id, &model.Type, &params, &model.Fingerprint,
+		&model.InitialLoss, &model.Loss, &metrics, &model.Active,
+		&model.CreatedAt, &model.ActivatedAt,
+	); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(params), &model.Params); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(metrics), &model.Metrics); err != nil {
+		return nil, err
+	}
+	return &model, nil
+}
+
+func (repo *ModelRepository) CreateModel(model *ModelRecord) (*int64, error) {
+	query := `
+		INSERT INTO models(
+			modelType, params, fingerprint, initialLoss, loss, metrics, createdAt
+		) VALUES(?, ?, ?, ?, ?, ?, ?)
+	`
+	params, err := json.Marshal(model.Params)
+	if err != nil {
+		return nil, err
+	}
+	metrics := model.Metrics
+	if metrics == nil {
+		metrics = map[string]float64{}
+	}
+	metricsJSON, err := json.Marshal(metrics)
+	if err != nil {
+		return nil, err
+	}
+
+	return PrepareAndExecute(
+		repo.Conn(), query,
+		model.Type, string(params), model.Fingerprint,
+		model.InitialLoss, model.Loss, string(metricsJSON), time.Now().Unix(),
+	)
+}
+
+func (repo *ModelRepository) GetModels() (*[]ModelRecord, error) {
+	query := `SELECT ` + modelColumns + ` FROM models ORDER BY id DESC`
+	rows, err := repo.Conn().Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	models := []ModelRecord{}
+	for rows.Next() {
+		model, err := scanModel(rows)
+		if err != nil {
+			return nil, err
+		}
+		models = append(models, *model)
+	}
+	return &models, nil
+}
+
+// GetModelById returns nil if no model with the given id exists.
+func (repo *ModelRepository) GetModelById(id int) (*ModelRecord, error) {
+	query := `SELECT ` + modelColumns + ` FROM models WHERE id=?`
+	model, err := scanModel(repo.Conn().QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return model, err
+}
+
+// GetActiveModel returns nil if no model has been activated yet.
+func (repo *ModelRepository) GetActiveModel() (*ModelRecord, error) {
+	query := `SELECT ` + modelColumns + ` FROM models WHERE active=1 LIMIT 1`
+	model, err := scanModel(repo.Conn().QueryRow(query))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return model, err
+}
+
+/*
+The activations of models form a history: activating a model appends it and
+rolling back marks the last activation as rolled back, so that repeated
+rollbacks walk back along the history instead of flipping between two models.
+*/
+const previousActivationQuery = `
+	SELECT id, modelId FROM modelActivations
+	WHERE rolledBack=0
+	ORDER BY id DESC
+	LIMIT 1 OFFSET ?
+`
+
+type querier interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// getActivation returns the activation offset back from the last one not rolled back, nil if there is none.
+func getActivation(conn querier, offset int) (activationId *int64, modelId *int, err error) {
+	var id int64
+	var model int
+	err = conn.QueryRow(previousActivationQuery, offset).Scan(&id, &model)
+	if err == sql.ErrNoRows {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return &id, &model, nil
+}
+
+// GetPreviouslyActiveModel returns the model a rollback re-activates, or nil if there is none.
+func (repo *ModelRepository) GetPreviouslyActiveModel() (*ModelRecord, error) {
+	_, modelId, err := getActivation(repo.Conn(), 1)
+	if err != nil || modelId == nil {
+		return nil, err
+	}
+	return repo.GetModelById(*modelId)
+}
+
+func setActiveModel(tx *sql.Tx, id int, now int64) error {
+	if _, err := tx.Exec(`UPDATE models SET active=0 WHERE active=1`); err != nil {
+		return err
+	}
+	result, err := tx.Exec(`UPDATE models SET active=1, activatedAt=? WHERE id=?`, now, id)
+	if err != nil {
+		return err
+	}
+	if updated, err := result.RowsAffected(); err != nil || updated == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ActivateModel appends the model to the activation history unless it is already active.
+func (repo *ModelRepository) ActivateModel(id int) error {
+	tx, err := repo.Conn().Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Unix()
+	if err := setActiveModel(tx, id, now); err != nil {
+		return err
+	}
+	_, current, err := getActivation(tx, 0)
+	if err != nil {
+		return err
+	}
+	if current == nil || *current != id {
+		if _, err := tx.Exec(
+			`INSERT INTO modelActivations(modelId, activatedAt) VALUES(?, ?)`, id, now,
+		); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// RollbackModel re-activates the model of the previous activation, which must be the given one.
+func (repo *ModelRepository) RollbackModel(id int) error {
+	tx, err := repo.Conn().Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	last, _, err := getActivation(tx, 0)
+	if err != nil {
+		return err
+	}
+	_, previous, err := getActivation(tx, 1)
+	if err != nil {
+		return err
+	}
+	if previous == nil || *previous != id {
+		return fmt.Errorf("model %d is not the previously active model", id)
+	}
+	if _, err := tx.Exec(`UPDATE modelActivations SET rolledBack=1 WHERE id=?`, *last); err != nil {
+		return err
+	}
+	if err := setActiveModel(tx, id, time.Now().Unix()); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
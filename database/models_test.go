@@ -0,0 +1,84 @@
+package database
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+func createTestRepository(t *testing.T) (*sql.DB, *DatabaseRepository) {
+	path := filepath.Join(t.TempDir(), "db.sqlite")
+	db, err := InitializeDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, GetRepository(db)
+}
+
+func createTestModels(t *testing.T, repo *ModelRepository, count int) []int {
+	ids := []int{}
+	for i := 0; i < count; i++ {
+		id, err := repo.CreateModel(&ModelRecord{Type: "linear", Params: []float64{float64(i)}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, int(*id))
+	}
+	return ids
+}
+
+func expectActiveModel(t *testing.T, repo *ModelRepository, id int) {
+	t.Helper()
+	model, err := repo.GetActiveModel()
+	if err != nil || model == nil || model.Id != id {
+		t.Fatalf("active model %+v, %v, expected %d", model, err, id)
+	}
+}
+
+func rollback(t *testing.T, repo *ModelRepository) *ModelRecord {
+	t.Helper()
+	previous, err := repo.GetPreviouslyActiveModel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if previous == nil {
+		return nil
+	}
+	if err := repo.RollbackModel(previous.Id); err != nil {
+		t.Fatal(err)
+	}
+	return previous
+}
+
+func TestRollbackWalksHistory(t *testing.T) {
+	_, repo := createTestRepository(t)
+	ids := createTestModels(t, repo.Model, 3)
+	// all within the same second, so that timestamps cannot order them
+	for _, id := range []int{ids[0], ids[1], ids[1], ids[2]} {
+		if err := repo.Model.ActivateModel(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, expected := range []int{ids[1], ids[0]} {
+		if previous := rollback(t, repo.Model); previous == nil || previous.Id != expected {
+			t.Fatalf("rolled back to %+v, expected %d", previous, expected)
+		}
+		expectActiveModel(t, repo.Model, expected)
+	}
+	if previous := rollback(t, repo.Model); previous != nil {
+		t.Errorf("rolled back past the first activation to %d", previous.Id)
+	}
+
+	// activating again continues the history from the active model
+	if err := repo.Model.ActivateModel(ids[2]); err != nil {
+		t.Fatal(err)
+	}
+	if previous := rollback(t, repo.Model); previous == nil || previous.Id != ids[0] {
+		t.Errorf("rolled back to %+v, expected %d", previous, ids[0])
+	}
+	if err := repo.Model.RollbackModel(ids[2]); err == nil {
+		t.Error("rolled back to a model other than the previous one")
+	}
+}
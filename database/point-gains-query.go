@@ -0,0 +1,211 @@
+package database
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const DefaultPointGainsSort = "event_date"
+
+type pointGainsColumn struct {
+	expression string
+	value      func(record *PointGainRecord) any
+}
+
+// columns the samples can be sorted on, samples without points before or after sort first
+var pointGainsSortColumns = map[string]pointGainsColumn{
+	"event_id":     {"eventId", func(r *PointGainRecord) any { return r.EventId }},
+	"user_id":      {"userId", func(r *PointGainRecord) any { return r.UserId }},
+	"route_points": {"routePoints", func(r *PointGainRecord) any { return r.RoutePoints }},
+	"points_before": {"COALESCE(pointsBefore, -1)", func(r *PointGainRecord) any {
+		if r.UserPointsBefore == nil {
+			return -1
+		}
+		return *r.UserPointsBefore
+	}},
+	"points_after": {"COALESCE(pointsAfter, -1)", func(r *PointGainRecord) any {
+		if r.UserPointsAfter == nil {
+			return -1
+		}
+		return *r.UserPointsAfter
+	}},
+	"event_date": {"eventDate", func(r *PointGainRecord) any { return r.EventDate }},
+	"kind":       {"sampleKind", func(r *PointGainRecord) any { return string(r.Kind) }},
+	"activity":   {"activity", func(r *PointGainRecord) any { return r.Activity }},
+}
+
+func PointGainsSortColumns() []string {
+	names := []string{}
+	for name := range pointGainsSortColumns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+/*
+PointGainsCursor points behind the last sample of a page. Samples are ordered
+by the sort column and then by their key, so pages stay stable while new
+samples arrive.
+*/
+type PointGainsCursor struct {
+	Sort       string `json:"s"`
+	Descending bool   `json:"d"`
+	Value      any    `json:"v"`
+	EventId    int    `json:"e"`
+	UserId     int    `json:"u"`
+}
+
+func (cursor *PointGainsCursor) Encode() string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+/*
+DecodePointGainsCursor decodes cursors of NextCursor. Cursors are sent by
+clients, so the value must be an integer or a string like the values of the
+sort column it names.
+*/
+func DecodePointGainsCursor(encoded string) (*PointGainsCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("malformed cursor")
+	}
+	var cursor PointGainsCursor
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&cursor); err != nil {
+		return nil, fmt.Errorf("malformed cursor")
+	}
+	column, found := pointGainsSortColumns[cursor.Sort]
+	if !found {
+		return nil, fmt.Errorf("malformed cursor")
+	}
+	_, textColumn := column.value(&PointGainRecord{}).(string)
+	switch value := cursor.Value.(type) {
+	case json.Number:
+		integer, err := value.Int64()
+		if err != nil || textColumn {
+			return nil, fmt.Errorf("malformed cursor")
+		}
+		cursor.Value = integer
+	case string:
+		if !textColumn {
+			return nil, fmt.Errorf("malformed cursor")
+		}
+	default:
+		return nil, fmt.Errorf("malformed cursor")
+	}
+	return &cursor, nil
+}
+
+// NextCursor returns the cursor of the page following the record.
+func (params *PointGainsQuery) NextCursor(record *PointGainRecord) *PointGainsCursor {
+	column := params.sortColumnName()
+	return &PointGainsCursor{
+		Sort:       column,
+		Descending: params.Descending,
+		Value:      pointGainsSortColumns[column].value(record),
+		EventId:    record.EventId,
+		UserId:     record.UserId,
+	}
+}
+
+func (params *PointGainsQuery) sortColumnName() string {
+	if len(params.Sort) == 0 {
+		return DefaultPointGainsSort
+	}
+	return params.Sort
+}
+
+func (params *PointGainsQuery) Validate() error {
+	column := params.sortColumnName()
+	if _, found := pointGainsSortColumns[column]; !found {
+		return fmt.Errorf("cannot sort by %s, use one of %s", column, strings.Join(PointGainsSortColumns(), ", "))
+	}
+	if cursor := params.Cursor; cursor != nil && (cursor.Sort != column || cursor.Descending != params.Descending) {
+		return fmt.Errorf("cursor belongs to another sort")
+	}
+	return nil
+}
+
+// queryColumns names the columns the filters of a PointGainsQuery apply to, empty where a table lacks them.
+type queryColumns struct {
+	activity, eventId, userId, eventDate, routePoints, pointsAfter string
+}
+
+var pointsGainColumns = queryColumns{
+	activity:    "activity",
+	eventId:     "eventId",
+	userId:      "userId",
+	eventDate:   "eventDate",
+	routePoints: "routePoints",
+	pointsAfter: "pointsAfter",
+}
+
+// filter returns the WHERE clause of the filters on the samples, leaving out the cursor.
+func (params *PointGainsQuery) filter() (string, []any) {
+	where, args, _ := params.filterOn(pointsGainColumns)
+	return where, args
+}
+
+// filterOn returns the WHERE clause of the filters on a table with the given columns.
+func (params *PointGainsQuery) filterOn(columns queryColumns) (string, []any, error) {
+	conditions := []string{"1 = 1"}
+	args := []any{}
+	var err error
+	add := func(filter string, column string, condition string, arg any) {
+		if len(column) == 0 {
+			err = fmt.Errorf("cannot filter by %s", filter)
+			return
+		}
+		conditions = append(conditions, fmt.Sprintf(condition, column))
+		args = append(args, arg)
+	}
+	if len(params.Activity) > 0 {
+		add("activity", columns.activity, "%s = ?", params.Activity)
+	}
+	if params.EventId != nil {
+		add("event", columns.eventId, "%s = ?", *params.EventId)
+	}
+	if params.UserId != nil {
+		add("user", columns.userId, "%s = ?", *params.UserId)
+	}
+	if params.From != nil {
+		add("date", columns.eventDate, "%s >= ?", *params.From)
+	}
+	if params.Before != nil {
+		add("date", columns.eventDate, "%s < ?", *params.Before)
+	}
+	if params.MinRoutePoints != nil {
+		add("route points", columns.routePoints, "%s >= ?", *params.MinRoutePoints)
+	}
+	if params.MaxRoutePoints != nil {
+		add("route points", columns.routePoints, "%s <= ?", *params.MaxRoutePoints)
+	}
+	if params.Complete != nil {
+		condition := "%s IS NULL"
+		if *params.Complete {
+			condition = "%s IS NOT NULL"
+		}
+		if len(columns.pointsAfter) == 0 {
+			err = fmt.Errorf("cannot filter by completeness")
+		} else {
+			conditions = append(conditions, fmt.Sprintf(condition, columns.pointsAfter))
+		}
+	}
+	return strings.Join(conditions, " AND "), args, err
+}
+
+// CountPointGains counts the samples matching the filters of the query regardless of its cursor and limit.
+func (repo *PointGainsRepository) CountPointGains(params *PointGainsQuery) (int, error) {
+	where, args := params.filter()
+	query := fmt.Sprintf(`SELECT COUNT(*) FROM pointsGain WHERE %s`, where)
+	count := 0
+	err := repo.Conn().QueryRow(query, args...).Scan(&count)
+	return count, err
+}
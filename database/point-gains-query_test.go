@@ -0,0 +1,109 @@
+package database
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+)
+
+func encodeRawCursor(json string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(json))
+}
+
+func TestDecodePointGainsCursor(t *testing.T) {
+	cursor := &PointGainsCursor{Sort: "route_points", Descending: true, Value: 120, EventId: 3, UserId: 7}
+	decoded, err := DecodePointGainsCursor(cursor.Encode())
+	if err != nil || decoded.Value != int64(120) || decoded.EventId != 3 || decoded.UserId != 7 || !decoded.Descending {
+		t.Errorf("decoded %+v, %v", decoded, err)
+	}
+
+	tests := []struct {
+		cursor string
+		valid  bool
+	}{
+		{`{"s":"kind","v":"live","e":1,"u":1}`, true},
+		{`{"s":"points_after","v":-1,"e":1,"u":1}`, true},
+		{`{"s":"event_date","v":{"a":1},"e":1,"u":1}`, false},
+		{`{"s":"event_date","v":[1,2],"e":1,"u":1}`, false},
+		{`{"s":"event_date","v":null,"e":1,"u":1}`, false},
+		{`{"s":"event_date","v":true,"e":1,"u":1}`, false},
+		{`{"s":"event_date","v":1.5,"e":1,"u":1}`, false},
+		{`{"s":"event_date","v":"1000","e":1,"u":1}`, false},
+		{`{"s":"kind","v":1,"e":1,"u":1}`, false},
+		{`{"s":"unknown","v":1,"e":1,"u":1}`, false},
+	}
+	for _, test := range tests {
+		if _, err := DecodePointGainsCursor(encodeRawCursor(test.cursor)); (err == nil) != test.valid {
+			t.Errorf("decoding %s returned %v", test.cursor, err)
+		}
+	}
+	if _, err := DecodePointGainsCursor("not base64!"); err == nil {
+		t.Error("decoded a cursor that is not base64")
+	}
+}
+
+func TestPointGainsCursorPaging(t *testing.T) {
+	_, repo := createTestRepository(t)
+	// ties on every sort column, and dangling samples sorting on the sentinel of points after
+	for i := 0; i < 12; i++ {
+		before, after := 100+i%3*10, 150+i%4*10
+		record := PointGainRecord{
+			EventId: 1 + i%5, UserId: i, RoutePoints: 50 + i%2*50, UserPointsBefore: &before,
+			EventDate: int64(1000 + i%3), Activity: "HI",
+		}
+		if i%4 != 0 {
+			record.UserPointsAfter = &after
+		}
+		if err := repo.PointGains.CreatePointsGainEntry(&record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, sort := range []string{"event_date", "route_points", "points_before", "points_after", "kind"} {
+		for _, descending := range []bool{false, true} {
+			name := fmt.Sprintf("%s descending %t", sort, descending)
+			all, err := repo.PointGains.GetAllPointGains(&PointGainsQuery{Limit: -1, Sort: sort, Descending: descending})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(*all) != 12 {
+				t.Fatalf("%s: listed %d samples", name, len(*all))
+			}
+			paged := []PointGainRecord{}
+			query := PointGainsQuery{Limit: 5, Sort: sort, Descending: descending}
+			for page := 0; page < 5; page++ {
+				records, err := repo.PointGains.GetAllPointGains(&query)
+				if err != nil {
+					t.Fatalf("%s: %v", name, err)
+				}
+				paged = append(paged, *records...)
+				if len(*records) < query.Limit {
+					break
+				}
+				// cursors pass through clients encoded
+				if query.Cursor, err = DecodePointGainsCursor(query.NextCursor(&(*records)[len(*records)-1]).Encode()); err != nil {
+					t.Fatalf("%s: %v", name, err)
+				}
+			}
+			if len(paged) != len(*all) {
+				t.Fatalf("%s: paged %d samples, expected %d", name, len(paged), len(*all))
+			}
+			for i := range paged {
+				if paged[i].EventId != (*all)[i].EventId || paged[i].UserId != (*all)[i].UserId {
+					t.Errorf("%s: sample %d is %d/%d, expected %d/%d", name, i,
+						paged[i].EventId, paged[i].UserId, (*all)[i].EventId, (*all)[i].UserId)
+				}
+			}
+		}
+	}
+
+	// dangling samples sort first ascending and last descending on points after
+	all, _ := repo.PointGains.GetAllPointGains(&PointGainsQuery{Limit: -1, Sort: "points_after"})
+	if (*all)[0].UserPointsAfter != nil || (*all)[2].UserPointsAfter != nil || (*all)[3].UserPointsAfter == nil {
+		t.Errorf("dangling samples do not sort first: %+v", *all)
+	}
+	all, _ = repo.PointGains.GetAllPointGains(&PointGainsQuery{Limit: -1, Sort: "points_after", Descending: true})
+	if (*all)[11].UserPointsAfter != nil || (*all)[8].UserPointsAfter == nil {
+		t.Errorf("dangling samples do not sort last descending: %+v", *all)
+	}
+}
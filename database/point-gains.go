@@ -8,28 +8,135 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+const (
+	PointsGainDBMigration_19_10_26_Kind = `
+		ALTER TABLE pointsGain ADD COLUMN sampleKind TEXT NOT NULL DEFAULT 'live';
+	`
+	// only hiking events were recorded before the activity column was introduced
+	PointsGainDBMigration_19_10_26_Activity = `
+		ALTER TABLE pointsGain ADD COLUMN activity TEXT NOT NULL DEFAULT 'HI';
+	`
+	// the route of samples was only known through their event, which was not stored for every sample
+	PointsGainDBMigration_19_10_26_Route = `
+		ALTER TABLE pointsGain ADD COLUMN routeId INTEGER;
+	`
+	PointsGainRouteBackfill_19_10_26 = `
+		UPDATE pointsGain
+		SET routeId = (SELECT events.routeId FROM events WHERE events.id = pointsGain.eventId)
+		WHERE routeId IS NULL
+	`
+	// SQLite cannot drop the NOT NULL constraint of pointsBefore, so the table is rebuilt,
+	// forgetting the points before historical samples used to mirror from their points after
+	PointsGainDBMigration_19_10_26_PointsBefore = `
+		CREATE TABLE pointsGain_migrated(
+			eventId INTEGER NOT NULL,
+			userId INTEGER NOT NULL,
+			routePoints INTEGER NOT NULL,
+			pointsBefore INTEGER,
+			pointsAfter INTEGER,
+			eventDate INTEGER NOT NULL,
+			sampleKind TEXT NOT NULL DEFAULT 'live',
+			activity TEXT NOT NULL DEFAULT 'HI',
+			routeId INTEGER,
+
+			PRIMARY KEY (eventId, userId)
+		);
+		INSERT INTO pointsGain_migrated
+		SELECT
+			eventId, userId, routePoints,
+			CASE WHEN sampleKind = 'historical' THEN NULL ELSE pointsBefore END,
+			pointsAfter, eventDate, sampleKind, activity, routeId
+		FROM pointsGain;
+		DROP TABLE pointsGain;
+		ALTER TABLE pointsGain_migrated RENAME TO pointsGain;
+	`
+)
+
+// activity code of samples recorded before activities were tracked
+const DefaultActivity = "HI"
+
+type SampleKind string
+
+const (
+	// points before were crawled ahead of the points assignment
+	LiveSample SampleKind = "live"
+	// crawled after the points were assigned, so points before are unknown and NULL
+	HistoricalSample SampleKind = "historical"
+)
+
 type PointGainsRepository struct {
 	db *sql.DB
 }
 
 type PointGainRecord struct {
-	EventId          int
-	RoutePoints      int
-	UserId           int
-	UserPointsBefore int
+	EventId     int
+	RoutePoints int
+	UserId      int
+	// nil for historical samples
+	UserPointsBefore *int
 	UserPointsAfter  *int
 	EventDate        int64
+	Kind             SampleKind
+	Activity         string
+	// nil if the route of the event is unknown
+	RouteId *int
 }
 
 type ReducedPointGainRecord struct {
-	RoutePoints      int `json:"route_points"`
-	UserPointsBefore int `json:"points_before"`
-	UserPointsAfter  int `json:"points_after"`
+	RoutePoints      int   `json:"route_points"`
+	UserPointsBefore int   `json:"points_before"`
+	UserPointsAfter  int   `json:"points_after"`
+	EventId          int   `json:"event_id"`
+	EventDate        int64 `json:"event_date"`
+	UserId           int   `json:"user_id"`
+	// title of the event and id and name of its route, nil if the event or route is unknown
+	EventTitle *string `json:"event_title"`
+	RouteId    *int    `json:"route_id"`
+	RouteName  *string `json:"route_name"`
+	// SAC scale of the event's route, nil if the event or route is unknown
+	Scale *string       `json:"scale"`
+	Route RouteFeatures `json:"route"`
+}
+
+// RouteFeatures are the raw metrics of the route of a sample, nil where unknown.
+type RouteFeatures struct {
+	Elevation     *float64 `json:"elevation"`
+	Distance      *float64 `json:"distance"`
+	ElevationGain *float64 `json:"elevation_gain"`
+	ElevationLoss *float64 `json:"elevation_loss"`
+	// distances per SAC difficulty
+	T1Distance *float64 `json:"t1_distance"`
+	T2Distance *float64 `json:"t2_distance"`
+	T3Distance *float64 `json:"t3_distance"`
+	T4Distance *float64 `json:"t4_distance"`
+	T5Distance *float64 `json:"t5_distance"`
+	T6Distance *float64 `json:"t6_distance"`
 }
 
 type PointGainsQuery struct {
-	Limit int
-	Skip  int
+	Limit    int
+	Skip     int
+	Activity string
+	EventId  *int
+	UserId   *int
+	// unix range of the event date, From inclusive and Before exclusive
+	From   *int64
+	Before *int64
+	// inclusive range of the route points
+	MinRoutePoints *int
+	MaxRoutePoints *int
+	// only samples with or without points after
+	Complete *bool
+	// one of PointGainsSortColumns, DefaultPointGainsSort if empty
+	Sort       string
+	Descending bool
+	// continue behind the sample of the cursor, see PointGainsCursor
+	Cursor *PointGainsCursor
+}
+
+type ValidPointGainsQuery struct {
+	Limit    int
+	Activity string
 }
 
 func CreatePointGainsRepository(db *sql.DB) *PointGainsRepository {
@@ -47,7 +154,7 @@ func (repo *PointGainsRepository) Migrate() error {
 			eventId INTEGER NOT NULL,
 			userId INTEGER NOT NULL,
 			routePoints INTEGER NOT NULL,
-			pointsBefore INTEGER NOT NULL,
+			pointsBefore INTEGER,
 			pointsAfter INTEGER,
 			eventDate INTEGER NOT NULL,
 
@@ -56,24 +163,69 @@ func (repo *PointGainsRepository) Migrate() error {
 	`
 
 	_, err := repo.db.Exec(query)
+
+	migrations := []string{
+		PointsGainDBMigration_19_10_26_Kind, PointsGainDBMigration_19_10_26_Activity, PointsGainDBMigration_19_10_26_Route,
+	}
+	for _, query := range migrations {
+		// ignore error as the column may exist already
+		repo.db.Exec(query)
+	}
+	if err != nil {
+		return err
+	}
+	if err := repo.migrateNullablePointsBefore(); err != nil {
+		return err
+	}
+	// events are migrated before, so samples recorded before the route column get the route of their event
+	_, err = repo.db.Exec(PointsGainRouteBackfill_19_10_26)
 	return err
 }
 
+// migrateNullablePointsBefore rebuilds tables created while pointsBefore was NOT NULL, see PointsGainDBMigration_19_10_26_PointsBefore.
+func (repo *PointGainsRepository) migrateNullablePointsBefore() error {
+	notNull := false
+	if err := repo.db.QueryRow(
+		`SELECT "notnull" FROM pragma_table_info('pointsGain') WHERE name = 'pointsBefore'`,
+	).Scan(&notNull); err != nil || !notNull {
+		return err
+	}
+	log.Infof("Migrating points before of historical samples to NULL...")
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(PointsGainDBMigration_19_10_26_PointsBefore); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
 func (repo *PointGainsRepository) CreatePointsGainEntry(
 	pointsGain *PointGainRecord,
 ) error {
 	query := `
 		INSERT OR IGNORE INTO pointsGain(
-			eventId, userId, routePoints, pointsBefore, pointsAfter, eventDate
-		) VALUES(?, ?, ?, ?, ?, ?)
+			eventId, userId, routePoints, pointsBefore, pointsAfter, eventDate, sampleKind, activity, routeId
+		) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?)
 		ON CONFLICT(eventId, userId) DO UPDATE SET
-			pointsBefore=excluded.pointsBefore
+			pointsBefore=COALESCE(excluded.pointsBefore, pointsBefore),
+			routeId=COALESCE(routeId, excluded.routeId)
 	`
+	kind := pointsGain.Kind
+	if len(kind) == 0 {
+		kind = LiveSample
+	}
+	activity := pointsGain.Activity
+	if len(activity) == 0 {
+		activity = DefaultActivity
+	}
 	_, err := PrepareAndExecute(
 		repo.Conn(), query,
 		pointsGain.EventId, pointsGain.UserId, pointsGain.RoutePoints,
 		pointsGain.UserPointsBefore, pointsGain.UserPointsAfter,
-		pointsGain.EventDate,
+		pointsGain.EventDate, kind, activity, pointsGain.RouteId,
 	)
 	return err
 }
@@ -113,7 +265,7 @@ func extractRowToRecords(rows *sql.Rows) (*[]PointGainRecord, error) {
 		if err := rows.Scan(
 			&nextRecord.EventId, &nextRecord.UserId,
 			&nextRecord.RoutePoints, &nextRecord.UserPointsBefore, &nextRecord.UserPointsAfter,
-			&nextRecord.EventDate,
+			&nextRecord.EventDate, &nextRecord.Kind, &nextRecord.Activity, &nextRecord.RouteId,
 		); err != nil {
 			return nil, err
 		}
@@ -127,7 +279,7 @@ func extractRowToRecords(rows *sql.Rows) (*[]PointGainRecord, error) {
 func (repo *PointGainsRepository) GetPointGainsByEventId(id int) (*[]PointGainRecord, error) {
 	query := `
 		SELECT 
-			eventId, userId, routePoints, pointsBefore, pointsAfter, eventDate
+			eventId, userId, routePoints, pointsBefore, pointsAfter, eventDate, sampleKind, activity, routeId
 		FROM pointsGain
 		WHERE eventId=?
 	`
@@ -146,19 +298,34 @@ func (repo *PointGainsRepository) GetAllPointGains(queryParams *PointGainsQuery)
 		Limit: -1,
 	}
 	if queryParams != nil {
-		params.Limit = queryParams.Limit
-		params.Skip = queryParams.Skip
+		params = *queryParams
+	}
+	if err := params.Validate(); err != nil {
+		return nil, err
 	}
 
-	query := `
-		SELECT 
-			eventId, userId, routePoints, pointsBefore, pointsAfter, eventDate
+	where, args := params.filter()
+	column := pointGainsSortColumns[params.sortColumnName()]
+	direction, comparison := "ASC", ">"
+	if params.Descending {
+		direction, comparison = "DESC", "<"
+	}
+	if cursor := params.Cursor; cursor != nil {
+		where += fmt.Sprintf(" AND (%s, eventId, userId) %s (?, ?, ?)", column.expression, comparison)
+		args = append(args, cursor.Value, cursor.EventId, cursor.UserId)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT
+			eventId, userId, routePoints, pointsBefore, pointsAfter, eventDate, sampleKind, activity, routeId
 		FROM pointsGain
-		ORDER BY eventDate ASC
-		OFFSET ?
+		WHERE %s
+		ORDER BY %s %s, eventId %s, userId %s
 		LIMIT ?
-	`
-	rows, err := repo.Conn().Query(query, params.Skip, params.Limit)
+		OFFSET ?
+	`, where, column.expression, direction, direction, direction)
+	args = append(args, params.Limit, params.Skip)
+	rows, err := repo.Conn().Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -169,7 +336,7 @@ func (repo *PointGainsRepository) GetAllPointGains(queryParams *PointGainsQuery)
 func (repo *PointGainsRepository) GetDanglingPointsGainEntryToday(targetHour time.Time) (*[]PointGainRecord, error) {
 	query := `
 		SELECT
-			eventId, userId, routePoints, pointsBefore, pointsAfter, eventDate
+			eventId, userId, routePoints, pointsBefore, pointsAfter, eventDate, sampleKind, activity, routeId
 		FROM pointsGain
 		WHERE 
 			pointsAfter IS NULL AND
@@ -191,22 +358,83 @@ func (repo *PointGainsRepository) GetDanglingPointsGainEntryToday(targetHour tim
 	return extractRowToRecords(rows)
 }
 
-func (repo *PointGainsRepository) GetValidPointsGainEntry(desiredLimit *int) (*[]ReducedPointGainRecord, error) {
+// GetLatestUserPoints returns the points of the user after their most recent sample, or nil if there is none.
+func (repo *PointGainsRepository) GetLatestUserPoints(userId int) (*int, error) {
+	query := `
+		SELECT COALESCE(pointsAfter, pointsBefore) FROM pointsGain
+		WHERE userId = ?
+		ORDER BY eventDate DESC
+		LIMIT 1
+	`
+	var points int
+	if err := repo.Conn().QueryRow(query, userId).Scan(&points); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &points, nil
+}
+
+// GetUserTimelines returns all samples, complete or not, ordered by user and event date.
+func (repo *PointGainsRepository) GetUserTimelines() (*[]PointGainRecord, error) {
 	query := `
 		SELECT
-			routePoints, pointsBefore, pointsAfter
+			eventId, userId, routePoints, pointsBefore, pointsAfter, eventDate, sampleKind, activity, routeId
 		FROM pointsGain
-		WHERE
-			pointsAfter IS NOT NULL AND
-			pointsBefore < pointsAfter
-		ORDER BY eventDate DESC
+		ORDER BY userId ASC, eventDate ASC, eventId ASC
+	`
+	rows, err := repo.Conn().Query(query)
+	if err != nil {
+		return nil, err
+	}
+
+	return extractRowToRecords(rows)
+}
+
+/*
+validPointsGainSamples joins the samples fitted on with their event and route.
+The route of samples stored before their route was recorded is taken from the
+event if it is known.
+*/
+const validPointsGainSamples = `
+	FROM pointsGain pg
+	LEFT JOIN events ON events.id = pg.eventId
+	LEFT JOIN routes ON routes.id = COALESCE(pg.routeId, events.routeId)
+	WHERE
+		pg.pointsAfter IS NOT NULL AND
+		pg.pointsBefore < pg.pointsAfter AND
+		pg.sampleKind = 'live' AND
+		(? = '' OR pg.activity = ?)
+`
+
+// CountValidPointsGainWithoutRoute counts the samples fitted on whose route features are unknown.
+func (repo *PointGainsRepository) CountValidPointsGainWithoutRoute(activity string) (int, error) {
+	query := `SELECT COUNT(*) ` + validPointsGainSamples + ` AND routes.id IS NULL`
+	count := 0
+	err := repo.Conn().QueryRow(query, activity, activity).Scan(&count)
+	return count, err
+}
+
+func (repo *PointGainsRepository) GetValidPointsGainEntry(queryParams *ValidPointGainsQuery) (*[]ReducedPointGainRecord, error) {
+	query := `
+		SELECT
+			pg.routePoints, pg.pointsBefore, pg.pointsAfter, pg.eventId, pg.eventDate, pg.userId,
+			events.title, routes.id, routes.name, routes.scale,
+			routes.elevation, routes.distance, routes.elevation_gain, routes.elevation_loss,
+			routes.t1_distance, routes.t2_distance, routes.t3_distance,
+			routes.t4_distance, routes.t5_distance, routes.t6_distance
+	` + validPointsGainSamples + `
+		ORDER BY pg.eventDate DESC
 		LIMIT ?
 	`
-	limit := -1
-	if desiredLimit != nil {
-		limit = *desiredLimit
+	params := ValidPointGainsQuery{
+		Limit: -1,
+	}
+	if queryParams != nil {
+		params = *queryParams
 	}
-	rows, err := repo.Conn().Query(query, limit)
+	rows, err := repo.Conn().Query(query, params.Activity, params.Activity, params.Limit)
 	if err != nil {
 		return nil, err
 	}
@@ -216,6 +444,12 @@ func (repo *PointGainsRepository) GetValidPointsGainEntry(desiredLimit *int) (*[
 		var nextRecord ReducedPointGainRecord
 		if err := rows.Scan(
 			&nextRecord.RoutePoints, &nextRecord.UserPointsBefore, &nextRecord.UserPointsAfter,
+			&nextRecord.EventId, &nextRecord.EventDate, &nextRecord.UserId,
+			&nextRecord.EventTitle, &nextRecord.RouteId, &nextRecord.RouteName, &nextRecord.Scale,
+			&nextRecord.Route.Elevation, &nextRecord.Route.Distance,
+			&nextRecord.Route.ElevationGain, &nextRecord.Route.ElevationLoss,
+			&nextRecord.Route.T1Distance, &nextRecord.Route.T2Distance, &nextRecord.Route.T3Distance,
+			&nextRecord.Route.T4Distance, &nextRecord.Route.T5Distance, &nextRecord.Route.T6Distance,
 		); err != nil {
 			return nil, err
 		}
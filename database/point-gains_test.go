@@ -0,0 +1,137 @@
+package database
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMigrateNullablePointsBefore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.sqlite")
+	old, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the schema of version 2, where historical samples mirrored their points after
+	if _, err := old.Exec(`
+		CREATE TABLE pointsGain(
+			eventId INTEGER NOT NULL,
+			userId INTEGER NOT NULL,
+			routePoints INTEGER NOT NULL,
+			pointsBefore INTEGER NOT NULL,
+			pointsAfter INTEGER,
+			eventDate INTEGER NOT NULL,
+
+			PRIMARY KEY (eventId, userId)
+		);
+		ALTER TABLE pointsGain ADD COLUMN sampleKind TEXT NOT NULL DEFAULT 'live';
+		ALTER TABLE pointsGain ADD COLUMN activity TEXT NOT NULL DEFAULT 'HI';
+		INSERT INTO pointsGain VALUES (1, 7, 120, 100, 110, 1000, 'live', 'HI');
+		INSERT INTO pointsGain VALUES (2, 7, 80, 500, 500, 500, 'historical', 'HI');
+		INSERT INTO pointsGain VALUES (3, 7, 90, 110, NULL, 2000, 'live', 'HI');
+	`); err != nil {
+		t.Fatal(err)
+	}
+	old.Close()
+
+	db, err := InitializeDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	repo := GetRepository(db)
+
+	records, err := repo.PointGains.GetAllPointGains(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := map[int]*int{}
+	for _, record := range *records {
+		before[record.EventId] = record.UserPointsBefore
+	}
+	if len(before) != 3 || before[2] != nil || before[1] == nil || *before[1] != 100 || before[3] == nil || *before[3] != 110 {
+		t.Errorf("migrated samples %+v", *records)
+	}
+
+	// historical samples can be stored without points before now
+	after := 600
+	if err := repo.PointGains.CreatePointsGainEntry(&PointGainRecord{
+		EventId: 4, UserId: 7, RoutePoints: 50, UserPointsAfter: &after, EventDate: 3000, Kind: HistoricalSample,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// and do not clear the points before of a live sample
+	if err := repo.PointGains.CreatePointsGainEntry(&PointGainRecord{
+		EventId: 1, UserId: 7, RoutePoints: 120, UserPointsAfter: &after, EventDate: 1000, Kind: HistoricalSample,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	records, _ = repo.PointGains.GetPointGainsByEventId(1)
+	if (*records)[0].UserPointsBefore == nil || *(*records)[0].UserPointsBefore != 100 {
+		t.Errorf("historical sample overwrote %+v", (*records)[0])
+	}
+
+	latest, err := repo.PointGains.GetLatestUserPoints(7)
+	if err != nil || latest == nil || *latest != 600 {
+		t.Errorf("latest points %v, %v", latest, err)
+	}
+	// migrating again keeps the data
+	db.Close()
+	if db, err = InitializeDatabase(path); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if count, _ := GetRepository(db).PointGains.CountPointGains(&PointGainsQuery{}); count != 4 {
+		t.Errorf("%d samples after migrating again", count)
+	}
+}
+
+func TestValidPointsGainRoutes(t *testing.T) {
+	_, repo := createTestRepository(t)
+	points := 100
+	if _, err := repo.Route.SaveRoute(&RouteRecord{Id: 10, Name: "Ridge", Scale: "T2", Points: &points}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Event.SaveEvent(&EventRecord{Id: 1, RouteId: 10, Date: time.Unix(1000, 0), Title: "Ridge hike"}); err != nil {
+		t.Fatal(err)
+	}
+	routeId := 10
+	for _, record := range []PointGainRecord{
+		// stored before the route was recorded, its event is known
+		{EventId: 1, UserId: 7},
+		// the event was never stored
+		{EventId: 2, UserId: 7, RouteId: &routeId},
+		{EventId: 3, UserId: 7},
+	} {
+		before, after := 100, 120
+		record.RoutePoints, record.UserPointsBefore, record.UserPointsAfter = points, &before, &after
+		if err := repo.PointGains.CreatePointsGainEntry(&record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records, err := repo.PointGains.GetValidPointsGainEntry(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	routes := map[int]*int{}
+	for _, record := range *records {
+		routes[record.EventId] = record.RouteId
+	}
+	if len(routes) != 3 || routes[1] == nil || *routes[1] != 10 || routes[2] == nil || *routes[2] != 10 || routes[3] != nil {
+		t.Errorf("valid samples %+v", *records)
+	}
+	if count, err := repo.PointGains.CountValidPointsGainWithoutRoute(""); err != nil || count != 1 {
+		t.Errorf("%d samples without route, %v", count, err)
+	}
+
+	// migrating stores the route of the event on the sample
+	if err := repo.PointGains.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	samples, _ := repo.PointGains.GetPointGainsByEventId(1)
+	if route := (*samples)[0].RouteId; route == nil || *route != 10 {
+		t.Errorf("backfilled route %v", route)
+	}
+}
@@ -41,6 +41,32 @@ type RouteRecord struct {
 	T6_Distance   *float32
 }
 
+func toFloat64(value *float32) *float64 {
+	if value == nil {
+		return nil
+	}
+	converted := float64(*value)
+	return &converted
+}
+
+// Features returns the route metrics the same way the samples of the route are read for fitting.
+func (route *RouteRecord) Features() RouteFeatures {
+	elevation := float64(route.Elevation)
+	distance := float64(route.Distance)
+	return RouteFeatures{
+		Elevation:     &elevation,
+		Distance:      &distance,
+		ElevationGain: toFloat64(route.ElevationGain),
+		ElevationLoss: toFloat64(route.ElevationLoss),
+		T1Distance:    toFloat64(route.T1_Distance),
+		T2Distance:    toFloat64(route.T2_Distance),
+		T3Distance:    toFloat64(route.T3_Distance),
+		T4Distance:    toFloat64(route.T4_Distance),
+		T5Distance:    toFloat64(route.T5_Distance),
+		T6Distance:    toFloat64(route.T6_Distance),
+	}
+}
+
 func (repo *RouteRepository) Migrate() error {
 	log.Debugf("Migrating routes repository...")
 
@@ -96,12 +122,18 @@ func (repo *RouteRepository) SaveRoute(route *RouteRecord) (bool, error) {
 
 func (repo *RouteRepository) GetRouteById(id int, record *RouteRecord) error {
 	query := `
-		SELECT id, name, points, elevation, scale, distance FROM routes
+		SELECT
+			id, name, points, elevation, scale, distance, elevation_gain, elevation_loss,
+			t1_distance, t2_distance, t3_distance, t4_distance, t5_distance, t6_distance
+		FROM routes
 		WHERE id=?
 	`
 	var route RouteRecord
 	if err := repo.Conn().QueryRow(query, id).Scan(
-		&route.Id, &route.Name, route.Points, &route.Elevation, &route.Scale, &route.Distance,
+		&route.Id, &route.Name, &route.Points, &route.Elevation, &route.Scale, &route.Distance,
+		&route.ElevationGain, &route.ElevationLoss,
+		&route.T1_Distance, &route.T2_Distance, &route.T3_Distance,
+		&route.T4_Distance, &route.T5_Distance, &route.T6_Distance,
 	); err != nil {
 		if err == sql.ErrNoRows {
 			return nil
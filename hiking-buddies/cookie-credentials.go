@@ -1,5 +1,10 @@
 package hiking_buddies
 
+import (
+	"sync"
+	"time"
+)
+
 type CookieCredential struct {
 	SessionId, CSRFToken string
 }
@@ -10,3 +15,39 @@ func (c *CookieCredential) AsCookie() map[string]string {
 		"csrftoken": c.CSRFToken,
 	}
 }
+
+// SessionStore keeps the last session the workers logged in with, so that
+// other crawlers reuse it instead of logging in on their own.
+type SessionStore struct {
+	mutex      sync.Mutex
+	credential *CookieCredential
+	storedAt   time.Time
+}
+
+func CreateSessionStore() *SessionStore {
+	return &SessionStore{}
+}
+
+// Set stores the credential, a nil store stores nothing.
+func (s *SessionStore) Set(credential *CookieCredential) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.credential = credential
+	s.storedAt = time.Now()
+}
+
+// Get returns the stored credential, nil if none was stored or it is older than CredentialMaxAge.
+func (s *SessionStore) Get() *CookieCredential {
+	if s == nil {
+		return nil
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.credential == nil || time.Since(s.storedAt) > CredentialMaxAge {
+		return nil
+	}
+	return s.credential
+}
@@ -1,11 +1,42 @@
 package hiking_buddies
 
-import "time"
+import (
+	"fmt"
+	"hb-crawler/rating-gain/database"
+	"strings"
+	"time"
+)
+
+type Activity string
 
+// codes of the activities the event list of the site returns
 const (
-	HikingActivity = "HI"
+	HikingActivity     Activity = "HI"
+	ViaFerrataActivity Activity = "VF"
+	ClimbingActivity   Activity = "CL"
+	SkiingActivity     Activity = "SK"
+	BikingActivity     Activity = "BI"
 )
 
+var Activities = []Activity{
+	HikingActivity,
+	ViaFerrataActivity,
+	ClimbingActivity,
+	SkiingActivity,
+	BikingActivity,
+}
+
+// ParseActivity accepts the codes of Activities, ignoring case and surrounding spaces.
+func ParseActivity(code string) (Activity, error) {
+	activity := Activity(strings.ToUpper(strings.TrimSpace(code)))
+	for _, known := range Activities {
+		if activity == known {
+			return activity, nil
+		}
+	}
+	return "", fmt.Errorf("unknown activity %q, known activities are %v", code, Activities)
+}
+
 type Event struct {
 	Organizer       Organizer `json:"organizer"`
 	Route           Route     `json:"route"`
@@ -13,8 +44,18 @@ type Event struct {
 	DurationInDays  int       `json:"num_of_days"`
 	Start           time.Time `json:"start"`
 	ParticipantsId  []int     `json:"participants"`
-	Activity        string    `json:"activity"`
+	Activity        Activity  `json:"activity"`
 	ID              int       `json:"id"`
 	RouteData       RouteData `json:"route_data"`
 	Title           string    `json:"title"`
 }
+
+func (e *Event) ToEventRecord() *database.EventRecord {
+	return &database.EventRecord{
+		Id:          e.ID,
+		RouteId:     e.Route.RouteID,
+		OrganizerId: e.Organizer.ID,
+		Date:        e.Start,
+		Title:       e.Title,
+	}
+}
@@ -0,0 +1,22 @@
+package hiking_buddies
+
+import "testing"
+
+func TestParseActivity(t *testing.T) {
+	tests := map[string]Activity{
+		"HI":   HikingActivity,
+		" hi ": HikingActivity,
+		"VF":   ViaFerrataActivity,
+		"bi":   BikingActivity,
+	}
+	for code, want := range tests {
+		if got, err := ParseActivity(code); err != nil || got != want {
+			t.Errorf("ParseActivity(%q) = %q, %v, wanted %q", code, got, err, want)
+		}
+	}
+	for _, code := range []string{"", "H1", "HX", "HI,VF", "HIKING"} {
+		if got, err := ParseActivity(code); err == nil {
+			t.Errorf("ParseActivity(%q) = %q, wanted an error", code, got)
+		}
+	}
+}
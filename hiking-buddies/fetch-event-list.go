@@ -7,6 +7,8 @@ import (
 type EventListResponse map[string][]Event
 type PastEventListResponse struct {
 	Results []Event
+	Count   int     `json:"count"`
+	Next    *string `json:"next"`
 }
 
 func doFetch[R interface{}](url URL, cookieCredential *CookieCredential, result *R) (*R, error) {
@@ -36,3 +38,10 @@ func FetchUpcomingEvents(cookieCredential *CookieCredential) (*EventListResponse
 func FetchPastEvents(cookieCredential *CookieCredential) (*PastEventListResponse, error) {
 	return doFetch(PastEventListEndpoint, cookieCredential, &PastEventListResponse{})
 }
+
+// FetchPastEventsPage fetches one page of the paginated past event list,
+// starting from page 1 for the most recent events.
+func FetchPastEventsPage(cookieCredential *CookieCredential, page int) (*PastEventListResponse, error) {
+	url := URL(fmt.Sprintf("%s?page=%d", PastEventListEndpoint, page))
+	return doFetch(url, cookieCredential, &PastEventListResponse{})
+}
@@ -119,6 +119,10 @@ type GetRoutePointsParams struct {
 	Id         int
 	Record     *database.RouteRecord
 	Credential *CookieCredential
+	// caches fetched routes, defaults to Repo.SaveRoute
+	Save func(route *database.RouteRecord) error
+	// waited for before fetching routes that are not cached, nil to not wait
+	Limiter *RateLimiter
 }
 
 func GetRoutePoints(p *GetRoutePointsParams) error {
@@ -142,6 +146,7 @@ func GetRoutePoints(p *GetRoutePointsParams) error {
 	}
 
 	log.Debugf("Route %d's point is not cached, fetching...", p.Id)
+	p.Limiter.Wait()
 
 	points, err := FetchRoutePoints(p.Id, p.Credential)
 	if err != nil {
@@ -151,7 +156,14 @@ func GetRoutePoints(p *GetRoutePointsParams) error {
 
 	log.Infof("Route %d has %d points (found by fetching) \n", p.Id, *points)
 	log.Infof("Caching route %d to database", p.Id)
-	if _, err := p.Repo.SaveRoute(&database.RouteRecord{
+	save := p.Save
+	if save == nil {
+		save = func(route *database.RouteRecord) error {
+			_, err := p.Repo.SaveRoute(route)
+			return err
+		}
+	}
+	if err := save(&database.RouteRecord{
 		Id:        p.Id,
 		Elevation: p.Record.Elevation,
 		Points:    points,
@@ -162,7 +174,10 @@ func GetRoutePoints(p *GetRoutePointsParams) error {
 		log.Errorf("Failed to cache route %d: %+v\n", p.Id, err)
 	}
 
-	*(p.Record) = fetchedRoute
+	// routes that were not cached keep the metrics of the event
+	if fetchedRoute.Id != 0 {
+		*(p.Record) = fetchedRoute
+	}
 	p.Record.Points = points
 
 	return nil
@@ -32,13 +32,13 @@ type Organizer struct {
 type User = Organizer
 
 type RouteData struct {
-	OrganizerID   int    `json:"organizer_id"`
-	Activity      string `json:"activity"`
-	EventTitle    string `json:"event_title"`
-	FormattedDate string `json:"formatted_date"`
-	Route         Route  `json:"title"`
-	EventID       int    `json:"event_id"`
-	Date          string `json:"date"`
+	OrganizerID   int      `json:"organizer_id"`
+	Activity      Activity `json:"activity"`
+	EventTitle    string   `json:"event_title"`
+	FormattedDate string   `json:"formatted_date"`
+	Route         Route    `json:"title"`
+	EventID       int      `json:"event_id"`
+	Date          string   `json:"date"`
 }
 
 type URL string
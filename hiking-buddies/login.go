@@ -24,6 +24,9 @@ const (
 
 	loginCookieName = "sessionid"
 	csrfCookieName  = "csrftoken"
+
+	// sessions are logged in again once they are older
+	CredentialMaxAge = 3 * time.Hour
 )
 
 func createHeaders() network.Headers {
@@ -104,7 +107,7 @@ func doLogin(credential *Credential) (*CookieCredential, error) {
 func getCachedCredential(repo *database.LoginCredentialRepository, credential *Credential) (*CookieCredential, error) {
 	savedCredential := database.LoginCredentialRecord{}
 	now := time.Now()
-	ageThreshold := now.Add(time.Duration(-3) * time.Hour).Unix()
+	ageThreshold := now.Add(-CredentialMaxAge).Unix()
 
 	logrus.Debugf("Retrieving credentials for user %s newer than time %d", credential.Email, ageThreshold)
 	err := repo.GetCredential(&savedCredential, credential.Email, ageThreshold)
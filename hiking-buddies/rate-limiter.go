@@ -0,0 +1,37 @@
+package hiking_buddies
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter spaces out requests against Hiking Buddies so that concurrent
+// crawlers sharing it never hit the site more often than once per interval.
+type RateLimiter struct {
+	mutex    sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func CreateRateLimiter(interval time.Duration) *RateLimiter {
+	return &RateLimiter{interval: interval}
+}
+
+// Wait blocks until the caller is allowed to send the next request.
+// A nil limiter never blocks.
+func (l *RateLimiter) Wait() {
+	if l == nil || l.interval <= 0 {
+		return
+	}
+
+	l.mutex.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	wait := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mutex.Unlock()
+
+	time.Sleep(wait)
+}
@@ -0,0 +1,46 @@
+package hiking_buddies
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const DefaultUpcomingEventsTTL = 15 * time.Minute
+
+// UpcomingEventCache keeps the upcoming event list for a while, so that not every request fetches it.
+type UpcomingEventCache struct {
+	mutex     sync.Mutex
+	ttl       time.Duration
+	events    []Event
+	fetchedAt time.Time
+}
+
+func CreateUpcomingEventCache(ttl time.Duration) *UpcomingEventCache {
+	return &UpcomingEventCache{ttl: ttl}
+}
+
+// Get returns the cached upcoming events ordered by start, fetching them with the credential once expired.
+func (cache *UpcomingEventCache) Get(credential *CookieCredential) ([]Event, error) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if cache.events != nil && time.Since(cache.fetchedAt) < cache.ttl {
+		return cache.events, nil
+	}
+
+	response, err := FetchUpcomingEvents(credential)
+	if err != nil {
+		return nil, err
+	}
+	events := []Event{}
+	for _, eventsOfDay := range *response {
+		events = append(events, eventsOfDay...)
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Start.Before(events[j].Start)
+	})
+
+	cache.events = events
+	cache.fetchedAt = time.Now()
+	return events, nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"hb-crawler/rating-gain/backup"
+	"hb-crawler/rating-gain/worker"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultDrainTimeout = 30 * time.Second
+
+	ExitOK             = 0
+	ExitShutdownFailed = 1
+	ExitDrainTimeout   = 2
+)
+
+type Lifecycle struct {
+	Server       *http.Server
+	WorkerGroup  *worker.WorkerGroup
+	Backups      *backup.Scheduler
+	WaitGroup    *sync.WaitGroup
+	DB           *sql.DB
+	DrainTimeout time.Duration
+	// released once the database is closed
+	DatabaseLock *backup.DatabaseLock
+}
+
+func (l *Lifecycle) waitForWorkers() <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		l.WaitGroup.Wait()
+		close(done)
+	}()
+	return done
+}
+
+/*
+Blocks until SIGINT or SIGTERM is received or the server and all workers have
+stopped by themselves. On a signal the API stops accepting requests, workers
+and scheduled backups are asked to stop and all are given DrainTimeout to
+finish before the database is closed. A second signal during the drain kills the process.
+
+Returns the code the process should exit with.
+*/
+func (l *Lifecycle) Run() int {
+	ctx, stopListening := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopListening()
+
+	done := l.waitForWorkers()
+	select {
+	case <-done:
+		log.Info("Server and workers stopped")
+		return l.closeDatabase(ExitOK)
+	case <-ctx.Done():
+	}
+	// restore default signal handling so that a second signal terminates immediately
+	stopListening()
+
+	log.Infof("Shutdown signal received, draining for at most %s...", l.DrainTimeout)
+	drainCtx, cancel := context.WithTimeout(context.Background(), l.DrainTimeout)
+	defer cancel()
+
+	exitCode := ExitOK
+	l.WorkerGroup.Shutdown()
+	l.Backups.Stop()
+	if err := l.Server.Shutdown(drainCtx); err != nil {
+		log.Warnf("failed to shutdown server: %+v\n", err)
+		exitCode = ExitShutdownFailed
+	}
+
+	select {
+	case <-done:
+		log.Info("All workers drained")
+	case <-drainCtx.Done():
+		log.Errorf("Workers did not stop within %s, exiting anyway", l.DrainTimeout)
+		exitCode = ExitDrainTimeout
+	}
+
+	return l.closeDatabase(exitCode)
+}
+
+func (l *Lifecycle) closeDatabase(exitCode int) int {
+	log.Info("Closing database...")
+	if err := l.DB.Close(); err != nil {
+		log.Warnf("failed to close database: %+v\n", err)
+		if exitCode == ExitOK {
+			exitCode = ExitShutdownFailed
+		}
+	}
+	if err := l.DatabaseLock.Unlock(); err != nil {
+		log.Warnf("failed to release database lock: %+v\n", err)
+	}
+	return exitCode
+}
@@ -1,54 +1,157 @@
 package main
 
 import (
-	"context"
+	"fmt"
 	"hb-crawler/rating-gain/api"
+	"hb-crawler/rating-gain/backup"
 	"hb-crawler/rating-gain/database"
+	hb "hb-crawler/rating-gain/hiking-buddies"
 	"hb-crawler/rating-gain/worker"
 	"os"
-	"os/signal"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
 
-func registerInterrupt(handlers func()) {
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-	go func() {
-		for range c {
-			handlers()
+const (
+	PastEventConcurrencyEnvVariable = "HB_PAST_EVENT_CONCURRENCY"
+	RequestIntervalEnvVariable      = "HB_REQUEST_INTERVAL"
+	EnableBackfillEnvVariable       = "HB_ENABLE_BACKFILL"
+	ActivitiesEnvVariable           = "HB_ACTIVITIES"
+	DryRunEnvVariable               = "HB_DRY_RUN"
+	DrainTimeoutEnvVariable         = "HB_DRAIN_TIMEOUT"
+	BackupDirectoryEnvVariable      = "HB_BACKUP_DIR"
+	BackupIntervalEnvVariable       = "HB_BACKUP_INTERVAL"
+	BackupRetentionEnvVariable      = "HB_BACKUP_RETENTION"
+)
+
+// parseActivities reads the comma separated activity codes, failing on unknown ones so that typos do not filter out events.
+func parseActivities(codes string) (map[hb.Activity]bool, error) {
+	activities := map[hb.Activity]bool{}
+	for _, code := range strings.Split(codes, ",") {
+		activity, err := hb.ParseActivity(code)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", ActivitiesEnvVariable, err)
 		}
-	}()
+		activities[activity] = true
+	}
+	return activities, nil
+}
+
+func getWorkerGroupConfig() (*worker.WorkerGroupConfig, error) {
+	config := worker.DefaultWorkerGroupConfig()
+
+	if concurrency, err := strconv.Atoi(os.Getenv(PastEventConcurrencyEnvVariable)); err == nil && concurrency > 0 {
+		config.PastEventConcurrency = concurrency
+	}
+
+	if interval, err := time.ParseDuration(os.Getenv(RequestIntervalEnvVariable)); err == nil {
+		config.RequestInterval = interval
+	}
+
+	if enableBackfill, err := strconv.ParseBool(os.Getenv(EnableBackfillEnvVariable)); err == nil {
+		config.EnableBackfill = enableBackfill
+	}
+
+	if dryRun, err := strconv.ParseBool(os.Getenv(DryRunEnvVariable)); err == nil {
+		config.DryRun = dryRun
+	}
+
+	if codes := os.Getenv(ActivitiesEnvVariable); len(codes) > 0 {
+		activities, err := parseActivities(codes)
+		if err != nil {
+			return nil, err
+		}
+		config.EnabledActivities = activities
+	}
+
+	return config, nil
+}
+
+func getDrainTimeout() time.Duration {
+	if timeout, err := time.ParseDuration(os.Getenv(DrainTimeoutEnvVariable)); err == nil {
+		return timeout
+	}
+	return DefaultDrainTimeout
+}
+
+func getBackupConfig(databasePath string) *backup.SchedulerConfig {
+	config := backup.DefaultSchedulerConfig(databasePath)
+
+	if directory := os.Getenv(BackupDirectoryEnvVariable); len(directory) > 0 {
+		config.Directory = directory
+	}
+
+	if interval, err := time.ParseDuration(os.Getenv(BackupIntervalEnvVariable)); err == nil {
+		config.Interval = interval
+	}
+
+	if retention, err := strconv.Atoi(os.Getenv(BackupRetentionEnvVariable)); err == nil && retention > 0 {
+		config.Retention = retention
+	}
+
+	return config
 }
 
 func main() {
 	log.SetLevel(log.DebugLevel)
 
 	log.Info("Initializing database...\n")
-	db, err := database.InitializeDatabase()
+	databasePath, err := database.LocateDatabase()
+	if err != nil {
+		log.Fatalf("Failed to locate database: %+v\n", err)
+	}
+	// the crawler and restores hold the lock from before the database is migrated,
+	// the other commands run next to a running crawler
+	var databaseLock *backup.DatabaseLock
+	if len(os.Args) == 1 || os.Args[1] == RestoreCommand {
+		if databaseLock, err = backup.LockDatabase(*databasePath); err != nil {
+			log.Fatalf("Failed to lock database: %+v\n", err)
+		}
+	}
+	db, err := database.InitializeDatabase(*databasePath)
 	if err != nil {
 		log.Fatalf("Failed to initialize databse: %+v\n", err)
 	}
-	defer db.Close()
 	repo := database.GetRepository(db)
 
+	if len(os.Args) > 1 {
+		exitCode := runCommand(repo, *databasePath, databaseLock, os.Args[1:])
+		db.Close()
+		if databaseLock != nil {
+			databaseLock.Unlock()
+		}
+		log.Exit(exitCode)
+	}
+
+	workerConfig, err := getWorkerGroupConfig()
+	if err != nil {
+		db.Close()
+		log.Fatalf("Invalid worker configuration: %+v\n", err)
+	}
 	waitGroup := sync.WaitGroup{}
-	workerGroup := worker.CreateWorkerGroup(repo, &waitGroup)
+	workerGroup := worker.CreateWorkerGroup(repo, &waitGroup, workerConfig)
 	server := api.StartServer(&api.StartServerParams{
 		Addr:        ":8080",
 		Repo:        repo,
 		WaitGroup:   &waitGroup,
 		WorkerGroup: workerGroup,
 	})
+	backups := backup.CreateScheduler(db, &waitGroup, getBackupConfig(*databasePath))
+	backups.Start()
 
-	registerInterrupt(func() {
-		log.Info("SIGINT received, stopping...")
-		workerGroup.Stop()
-		if err := server.Shutdown(context.Background()); err != nil {
-			log.Warnf("failed to shutdown server: %+v\n", err)
-		}
-	})
-
-	waitGroup.Wait()
+	lifecycle := Lifecycle{
+		Server:       server,
+		WorkerGroup:  workerGroup,
+		Backups:      backups,
+		WaitGroup:    &waitGroup,
+		DB:           db,
+		DrainTimeout: getDrainTimeout(),
+		DatabaseLock: databaseLock,
+	}
+	// log.Exit runs the registered logrus exit handlers before exiting
+	log.Exit(lifecycle.Run())
 }
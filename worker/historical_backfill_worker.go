@@ -0,0 +1,110 @@
+package worker
+
+import (
+	"time"
+
+	"hb-crawler/rating-gain/database"
+	hb "hb-crawler/rating-gain/hiking-buddies"
+	"hb-crawler/rating-gain/logging"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	BackfillPagesPerRun = 5
+)
+
+type historicalBackfillState struct {
+	nextPage int
+}
+
+func CreateHistoricalBackfillWorker(config *WorkerConfig) *Worker {
+	logger := logging.GetLogger(&logging.LoggerConfig{
+		Prefix: "historical backfill worker",
+		Level:  log.DebugLevel,
+	})
+
+	state := historicalBackfillState{nextPage: 1}
+	return &Worker{
+		repository:        config.Repository,
+		shouldRun:         false,
+		interval:          config.Interval,
+		concurrency:       config.Concurrency,
+		rateLimiter:       config.RateLimiter,
+		enabledActivities: config.EnabledActivities,
+		logger:            logger,
+		dryRun:            config.DryRun,
+		ctx:               config.Context,
+		sessions:          config.Sessions,
+		lastRunningTime:   nil,
+		ProcessFunc: func(context *WorkerProcessContext) error {
+			return historicalBackfillProcessFunc(context, &state)
+		},
+	}
+}
+
+func processHistoricalEvent(
+	context *WorkerProcessContext,
+	event *hb.Event,
+) (bool, error) {
+	worker := context.Worker
+	if !worker.isActivityEnabled(event.Activity) {
+		return false, nil
+	}
+
+	if time.Since(event.Start).Hours() <= hb.AssignPointsForEventHourThreshold {
+		// still handled by the past event worker
+		return false, nil
+	}
+
+	if hasPointGains(context, event) {
+		return false, nil
+	}
+
+	worker.logger.Infof("Backfilling historical event %s (%d) on %s", event.Title, event.ID, event.Start.UTC())
+	return recordEventParticipants(context, event, database.HistoricalSample)
+}
+
+/*
+Pages through the past event list, BackfillPagesPerRun pages at a time, and
+records participants of events the past event worker has missed. Samples are
+marked as historical since their points before are unknown.
+
+Once the last page is reached, the next run starts over from the first page.
+*/
+func historicalBackfillProcessFunc(context *WorkerProcessContext, state *historicalBackfillState) error {
+	worker := context.Worker
+
+	for processedPages := 0; processedPages < BackfillPagesPerRun; processedPages++ {
+		if context.ShouldStop() {
+			worker.logger.Infof("Stop backfilling at page %d to stop the worker", state.nextPage)
+			return nil
+		}
+
+		worker.logger.Infof("Fetching past event page %d", state.nextPage)
+		worker.rateLimiter.Wait()
+		page, err := hb.FetchPastEventsPage(context.Credential, state.nextPage)
+		if err != nil {
+			worker.logger.Warnf("Unable to fetch past event page %d: %+v\n", state.nextPage, err)
+			return err
+		}
+
+		for _, event := range page.Results {
+			if context.ShouldStop() {
+				return nil
+			}
+			if _, err := processHistoricalEvent(context, &event); err != nil {
+				worker.logger.Warnf("failed to backfill event with id %d: %+v\n", event.ID, err)
+			}
+		}
+
+		if page.Next == nil || len(page.Results) == 0 {
+			worker.logger.Infof("Reached the last past event page %d, starting over next run", state.nextPage)
+			state.nextPage = 1
+			return nil
+		}
+		state.nextPage++
+	}
+
+	return nil
+}
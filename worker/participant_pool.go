@@ -0,0 +1,90 @@
+package worker
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	hb "hb-crawler/rating-gain/hiking-buddies"
+)
+
+type ParticipantError struct {
+	UserId int
+	Err    error
+}
+
+type ParticipantErrors []ParticipantError
+
+func (errs ParticipantErrors) Error() string {
+	lines := make([]string, 0, len(errs))
+	for _, e := range errs {
+		lines = append(lines, fmt.Sprintf("user %d: %+v", e.UserId, e.Err))
+	}
+	return fmt.Sprintf("%d participant(s) failed:\n%s", len(errs), strings.Join(lines, "\n"))
+}
+
+type ParticipantProcessFunc = func(userId int, credential *hb.CookieCredential) error
+
+/*
+Runs process for every participant using at most worker.concurrency goroutines.
+Credentials of the context are handed out round robin so that several accounts
+spread the load, and every request waits for the shared rate limiter first.
+
+The returned errors are ordered by user ID regardless of completion order.
+*/
+func processParticipants(
+	context *WorkerProcessContext,
+	userIds []int,
+	process ParticipantProcessFunc,
+) ParticipantErrors {
+	worker := context.Worker
+	credentials := context.Credentials
+	if len(credentials) == 0 {
+		credentials = []*hb.CookieCredential{context.Credential}
+	}
+
+	concurrency := worker.concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if concurrency > len(userIds) {
+		concurrency = len(userIds)
+	}
+
+	jobs := make(chan int)
+	errorsMutex := sync.Mutex{}
+	errs := ParticipantErrors{}
+	waitGroup := sync.WaitGroup{}
+
+	for slot := 0; slot < concurrency; slot++ {
+		credential := credentials[slot%len(credentials)]
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for userId := range jobs {
+				worker.rateLimiter.Wait()
+				if err := process(userId, credential); err != nil {
+					errorsMutex.Lock()
+					errs = append(errs, ParticipantError{UserId: userId, Err: err})
+					errorsMutex.Unlock()
+				}
+			}
+		}()
+	}
+
+	for i, userId := range userIds {
+		if context.ShouldStop() {
+			worker.logger.Infof("Give up processing remaining %d participants to stop the worker", len(userIds)-i)
+			break
+		}
+		jobs <- userId
+	}
+	close(jobs)
+	waitGroup.Wait()
+
+	sort.Slice(errs, func(i, j int) bool {
+		return errs[i].UserId < errs[j].UserId
+	})
+	return errs
+}
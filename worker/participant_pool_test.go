@@ -0,0 +1,224 @@
+package worker
+
+import (
+	ctxpkg "context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	hb "hb-crawler/rating-gain/hiking-buddies"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func createTestContext(concurrency int, credentials int, limiter *hb.RateLimiter) *WorkerProcessContext {
+	context := &WorkerProcessContext{
+		Worker: &Worker{
+			concurrency: concurrency,
+			rateLimiter: limiter,
+			logger:      log.New(),
+			shouldRun:   true,
+		},
+	}
+	for i := 0; i < credentials; i++ {
+		context.Credentials = append(context.Credentials, &hb.CookieCredential{SessionId: fmt.Sprint(i)})
+	}
+	if credentials > 0 {
+		context.Credential = context.Credentials[0]
+	}
+	return context
+}
+
+// barrier blocks the first n callers until all of them arrived, so that n jobs run on distinct goroutines.
+type barrier struct {
+	mutex   sync.Mutex
+	cond    *sync.Cond
+	arrived int
+	n       int
+}
+
+func createBarrier(n int) *barrier {
+	b := &barrier{n: n}
+	b.cond = sync.NewCond(&b.mutex)
+	return b
+}
+
+func (b *barrier) wait() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.arrived++
+	b.cond.Broadcast()
+	for b.arrived < b.n {
+		b.cond.Wait()
+	}
+}
+
+func TestProcessParticipantsRoundRobin(t *testing.T) {
+	tests := []struct {
+		concurrency, credentials, users int
+	}{
+		{3, 3, 9},
+		{4, 2, 8},
+		{2, 5, 6},
+	}
+	for _, test := range tests {
+		context := createTestContext(test.concurrency, test.credentials, nil)
+		userIds := []int{}
+		for i := 0; i < test.users; i++ {
+			userIds = append(userIds, i)
+		}
+		start := createBarrier(test.concurrency)
+		mutex := sync.Mutex{}
+		used := map[*hb.CookieCredential]bool{}
+		processed := map[int]int{}
+
+		errs := processParticipants(context, userIds, func(userId int, credential *hb.CookieCredential) error {
+			start.wait()
+			mutex.Lock()
+			defer mutex.Unlock()
+			used[credential] = true
+			processed[userId]++
+			return nil
+		})
+
+		if len(errs) > 0 {
+			t.Errorf("%+v: unexpected errors %v", test, errs)
+		}
+		// slot i uses credential i modulo the number of credentials
+		expected := test.credentials
+		if test.concurrency < expected {
+			expected = test.concurrency
+		}
+		if len(used) != expected {
+			t.Errorf("%+v: used %d credentials, expected %d", test, len(used), expected)
+		}
+		for i := 0; i < expected; i++ {
+			if !used[context.Credentials[i]] {
+				t.Errorf("%+v: credential %d was never used", test, i)
+			}
+		}
+		for _, userId := range userIds {
+			if processed[userId] != 1 {
+				t.Errorf("%+v: user %d processed %d times", test, userId, processed[userId])
+			}
+		}
+	}
+}
+
+func TestProcessParticipantsFallsBackToCredential(t *testing.T) {
+	context := createTestContext(2, 1, nil)
+	context.Credentials = nil
+	errs := processParticipants(context, []int{1, 2, 3}, func(userId int, credential *hb.CookieCredential) error {
+		if credential != context.Credential {
+			return fmt.Errorf("unexpected credential")
+		}
+		return nil
+	})
+	if len(errs) > 0 {
+		t.Errorf("unexpected errors %v", errs)
+	}
+}
+
+func TestProcessParticipantsErrorOrder(t *testing.T) {
+	context := createTestContext(4, 2, nil)
+	userIds := []int{8, 3, 6, 1, 7, 2}
+	errs := processParticipants(context, userIds, func(userId int, credential *hb.CookieCredential) error {
+		// larger ids finish first
+		time.Sleep(time.Duration(10-userId) * time.Millisecond)
+		if userId%2 == 0 {
+			return fmt.Errorf("failed %d", userId)
+		}
+		return nil
+	})
+
+	expected := []int{2, 6, 8}
+	if len(errs) != len(expected) {
+		t.Fatalf("got errors %v, expected users %v", errs, expected)
+	}
+	for i, userId := range expected {
+		if errs[i].UserId != userId || errs[i].Err.Error() != fmt.Sprintf("failed %d", userId) {
+			t.Errorf("error %d is %+v, expected user %d", i, errs[i], userId)
+		}
+	}
+}
+
+func TestProcessParticipantsSharesRateLimiter(t *testing.T) {
+	const interval = 15 * time.Millisecond
+	limiter := hb.CreateRateLimiter(interval)
+	// two pools at once, like two workers of a group
+	contexts := []*WorkerProcessContext{
+		createTestContext(3, 3, limiter),
+		createTestContext(3, 3, limiter),
+	}
+
+	mutex := sync.Mutex{}
+	calls := []time.Time{}
+	process := func(userId int, credential *hb.CookieCredential) error {
+		mutex.Lock()
+		calls = append(calls, time.Now())
+		mutex.Unlock()
+		return nil
+	}
+	waitGroup := sync.WaitGroup{}
+	for _, context := range contexts {
+		waitGroup.Add(1)
+		go func(context *WorkerProcessContext) {
+			defer waitGroup.Done()
+			processParticipants(context, []int{1, 2, 3, 4}, process)
+		}(context)
+	}
+	waitGroup.Wait()
+
+	if len(calls) != 8 {
+		t.Fatalf("processed %d participants, expected 8", len(calls))
+	}
+	first, last := calls[0], calls[0]
+	for _, call := range calls {
+		if call.Before(first) {
+			first = call
+		}
+		if call.After(last) {
+			last = call
+		}
+	}
+	// 8 requests need at least 7 intervals, allow some timer slack
+	if elapsed := last.Sub(first); elapsed < 7*interval-5*time.Millisecond {
+		t.Errorf("8 requests took %v, expected at least %v", elapsed, 7*interval)
+	}
+}
+
+func TestProcessParticipantsStops(t *testing.T) {
+	// a single slot, so that counting needs no lock
+	context := createTestContext(1, 1, nil)
+	context.Worker.shouldRun = false
+	processed := 0
+	processParticipants(context, []int{1, 2, 3}, func(userId int, credential *hb.CookieCredential) error {
+		processed++
+		return nil
+	})
+	if processed != 0 {
+		t.Errorf("stopped worker processed %d participants", processed)
+	}
+
+	context.Manual = true
+	processParticipants(context, []int{1, 2, 3}, func(userId int, credential *hb.CookieCredential) error {
+		processed++
+		return nil
+	})
+	if processed != 3 {
+		t.Errorf("manual run processed %d participants, expected 3", processed)
+	}
+
+	// shutting down stops manual runs too
+	ctx, shutdown := ctxpkg.WithCancel(ctxpkg.Background())
+	context.Worker.ctx = ctx
+	shutdown()
+	processParticipants(context, []int{1, 2, 3}, func(userId int, credential *hb.CookieCredential) error {
+		processed++
+		return nil
+	})
+	if processed != 3 {
+		t.Errorf("manual run processed %d participants after shutting down", processed-3)
+	}
+}
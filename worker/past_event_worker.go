@@ -17,28 +17,61 @@ func CreatePastEventWorker(config *WorkerConfig) *Worker {
 	})
 
 	worker := Worker{
-		repository:      config.Repository,
-		shouldRun:       false,
-		interval:        config.Interval,
-		logger:          logger,
-		LastRunningTime: nil,
-		ProcessFunc:     pastEventProcessFunc,
+		repository:        config.Repository,
+		shouldRun:         false,
+		interval:          config.Interval,
+		concurrency:       config.Concurrency,
+		rateLimiter:       config.RateLimiter,
+		enabledActivities: config.EnabledActivities,
+		logger:            logger,
+		dryRun:            config.DryRun,
+		ctx:               config.Context,
+		sessions:          config.Sessions,
+		lastRunningTime:   nil,
+		ProcessFunc:       pastEventProcessFunc,
 	}
 
 	return &worker
 }
 
-func processRecentPastEvent(
+func createPointsGainRecord(
+	event *hb.Event,
+	routeRecord *database.RouteRecord,
+	userId int,
+	currentUserPoints int,
+	kind database.SampleKind,
+) *database.PointGainRecord {
+	record := database.PointGainRecord{
+		UserId:      userId,
+		RoutePoints: *routeRecord.Points,
+		EventId:     event.ID,
+		EventDate:   event.Start.Unix(),
+		Kind:        kind,
+		Activity:    string(event.Activity),
+		RouteId:     &routeRecord.Id,
+	}
+	// the current points of historical samples were assigned after the event, so the points before are unknown
+	if kind == database.HistoricalSample {
+		record.UserPointsAfter = &currentUserPoints
+	} else {
+		record.UserPointsBefore = &currentUserPoints
+	}
+	return &record
+}
+
+/*
+Stores the event together with its route points and the current points of all
+of its participants as point gain samples of the given kind.
+*/
+func recordEventParticipants(
 	context *WorkerProcessContext,
 	event *hb.Event,
+	kind database.SampleKind,
 ) (bool, error) {
 	worker := context.Worker
-	worker.logger.Infof("Treating event %s as a recent past event", event.Title)
 
-	pointGains, _ := worker.repository.PointGains.GetPointGainsByEventId(event.ID)
-	if pointGains != nil && len(*pointGains) > 0 {
-		worker.logger.Infof("Refuse to process recent past event as %d related point gains event is found", len(*pointGains))
-		return false, nil
+	if err := context.Writer.SaveEvent(event.ToEventRecord()); err != nil {
+		worker.logger.Warnf("Failed to save event %d: %+v\n", event.ID, err)
 	}
 
 	worker.logger.Infof("Fetching route points for route '%s' under event '%s'", event.Route.RouteTitle, event.Title)
@@ -48,11 +81,14 @@ func processRecentPastEvent(
 		Id:         event.Route.RouteID,
 		Record:     &routeRecord,
 		Credential: context.Credential,
+		Save:       context.Writer.SaveRoute,
+		Limiter:    worker.rateLimiter,
 	}); err != nil {
 		return false, nil
 	}
 
 	worker.logger.Infof("Fetching participant lists of event '%s'", event.Title)
+	worker.rateLimiter.Wait()
 	ids, err := hb.FetchEventParticipants(&hb.FetchEventParticipantsParams{
 		Id:         event.ID,
 		Credential: context.Credential,
@@ -61,36 +97,57 @@ func processRecentPastEvent(
 		return false, nil
 	}
 
-	for _, userId := range *ids {
+	errs := processParticipants(context, *ids, func(userId int, credential *hb.CookieCredential) error {
 		worker.logger.Infof("Fetching current points for user %d", userId)
-		currentUserPoints, err := hb.FetchUserPoints(userId, context.Credential)
+		currentUserPoints, err := hb.FetchUserPoints(userId, credential)
 		if err != nil {
 			worker.logger.Warnf("Failed to fetch current points for user %d", userId)
-			continue
+			return err
 		}
-		if err := worker.repository.PointGains.CreatePointsGainEntry(&database.PointGainRecord{
-			UserId:           userId,
-			UserPointsBefore: *currentUserPoints,
-			RoutePoints:      *routeRecord.Points,
-			EventId:          event.ID,
-			EventDate:        event.Start.Unix(),
-		}); err != nil {
+		if err := context.Writer.CreatePointsGainEntry(
+			createPointsGainRecord(event, &routeRecord, userId, *currentUserPoints, kind),
+		); err != nil {
 			worker.logger.Warnf(
 				"Failed to save current points (%d) for user %d: %+v",
 				*currentUserPoints, userId, err,
 			)
+			return err
 		}
+		return nil
+	})
+	if len(errs) > 0 {
+		worker.logger.Warnf("Event '%s' (%d) processed with errors: %s", event.Title, event.ID, errs.Error())
 	}
 	return true, nil
 }
 
+func hasPointGains(context *WorkerProcessContext, event *hb.Event) bool {
+	pointGains, _ := context.Worker.repository.PointGains.GetPointGainsByEventId(event.ID)
+	return pointGains != nil && len(*pointGains) > 0
+}
+
+func processRecentPastEvent(
+	context *WorkerProcessContext,
+	event *hb.Event,
+) (bool, error) {
+	worker := context.Worker
+	worker.logger.Infof("Treating event %s as a recent past event", event.Title)
+
+	if hasPointGains(context, event) {
+		worker.logger.Infof("Refuse to process recent past event %d as related point gains are found", event.ID)
+		return false, nil
+	}
+
+	return recordEventParticipants(context, event, database.LiveSample)
+}
+
 func processEvent(
 	context *WorkerProcessContext,
 	event *hb.Event,
 ) (bool, error) {
 	worker := context.Worker
-	if event.Activity != hb.HikingActivity {
-		worker.logger.Infof("ignore non-hiking activity %s with ID %d", event.Title, event.ID)
+	if !worker.isActivityEnabled(event.Activity) {
+		worker.logger.Infof("ignore %s activity %s with ID %d", event.Activity, event.Title, event.ID)
 		return false, nil
 	}
 
@@ -112,7 +169,7 @@ func pastEventProcessFunc(context *WorkerProcessContext) error {
 	}
 
 	for i, event := range fetchResults.Results {
-		if !worker.shouldRun {
+		if context.ShouldStop() {
 			worker.logger.Infof("Give up processing remaining %d events to stop the worker", len(fetchResults.Results)-(i+1))
 			return nil
 		}
@@ -24,8 +24,13 @@ func CreatePointsGainWorker(config *WorkerConfig) *Worker {
 		repository:      config.Repository,
 		shouldRun:       false,
 		interval:        config.Interval,
+		concurrency:     config.Concurrency,
+		rateLimiter:     config.RateLimiter,
 		logger:          logger,
-		LastRunningTime: nil,
+		dryRun:          config.DryRun,
+		ctx:             config.Context,
+		sessions:        config.Sessions,
+		lastRunningTime: nil,
 		ProcessFunc:     pointsGainProcessFunc,
 	}
 }
@@ -41,12 +46,13 @@ func processDanglingPointsGainEntry(
 		time.Unix(pointsGain.EventDate, 0).UTC(),
 	)
 
+	worker.rateLimiter.Wait()
 	currentUserPoints, err := hb.FetchUserPoints(pointsGain.UserId, context.Credential)
 	if err != nil {
 		return err
 	}
 	worker.logger.Infof("User %d now has %d points", pointsGain.UserId, *currentUserPoints)
-	if err := worker.repository.PointGains.UpdatePointsGainEntry(&database.PointGainRecord{
+	if err := context.Writer.UpdatePointsGainEntry(&database.PointGainRecord{
 		UserId:          pointsGain.UserId,
 		EventId:         pointsGain.EventId,
 		UserPointsAfter: currentUserPoints,
@@ -71,7 +77,7 @@ func pointsGainProcessFunc(context *WorkerProcessContext) error {
 
 	worker.logger.Infof("Found %d dangling records at around %s", len(*danglingRecords), targetHour.UTC())
 	for index, pointsGain := range *danglingRecords {
-		if !worker.shouldRun {
+		if context.ShouldStop() {
 			worker.logger.Infof("Give up processing remaining %d records to stop the worker", len(*danglingRecords)-(index+1))
 			break
 		}
@@ -18,8 +18,13 @@ func CreateRoutePointsWorker(config *WorkerConfig) *Worker {
 		repository:      config.Repository,
 		shouldRun:       false,
 		interval:        config.Interval,
+		concurrency:     config.Concurrency,
+		rateLimiter:     config.RateLimiter,
 		logger:          logger,
-		LastRunningTime: nil,
+		dryRun:          config.DryRun,
+		ctx:             config.Context,
+		sessions:        config.Sessions,
+		lastRunningTime: nil,
 		ProcessFunc:     routePointsProcessFunc,
 	}
 }
@@ -62,7 +67,7 @@ func routePointsProcessFunc(context *WorkerProcessContext) error {
 		worker.logger.Warnf("problem with fetching route details, %d: %+v\n", *crawlEventId, record)
 		return err
 	}
-	if _, err := worker.repository.Route.SaveRoute(record); err != nil {
+	if err := context.Writer.SaveRoute(record); err != nil {
 		worker.logger.Warnf("problem saving route details for id %d: %+v\n", *crawlEventId, err)
 		return err
 	}
@@ -1,6 +1,8 @@
 package worker
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"hb-crawler/rating-gain/database"
 	hb "hb-crawler/rating-gain/hiking-buddies"
@@ -11,32 +13,74 @@ import (
 )
 
 type Worker struct {
-	repository      *database.DatabaseRepository
-	shouldRun       bool
-	interval        time.Duration
-	LastRunningTime *time.Time
-	logger          *log.Logger
-	ProcessFunc     WorkerProcessFunc
+	repository        *database.DatabaseRepository
+	shouldRun         bool
+	interval          time.Duration
+	lastRunningTime   *time.Time
+	logger            *log.Logger
+	ProcessFunc       WorkerProcessFunc
+	concurrency       int
+	rateLimiter       *hb.RateLimiter
+	enabledActivities map[hb.Activity]bool
+	dryRun            bool
+	// canceled when the application shuts down, which stops manual runs too
+	ctx context.Context
+	// receives the session of every run for the crawlers outside of the workers
+	sessions *hb.SessionStore
+	runMutex sync.Mutex
+	// guards whether the worker should run, the dry-run mode, the last running time and report, read by the API while the worker runs
+	stateMutex sync.Mutex
+	lastReport *RunReport
 }
 
 type WorkerConfig struct {
-	Repository *database.DatabaseRepository
-	Interval   time.Duration
+	Repository        *database.DatabaseRepository
+	Interval          time.Duration
+	Concurrency       int
+	RateLimiter       *hb.RateLimiter
+	EnabledActivities map[hb.Activity]bool
+	DryRun            bool
+	// canceled on shutdown, nil to never cancel
+	Context context.Context
+	// shared with the API, nil to keep sessions to the worker
+	Sessions *hb.SessionStore
 }
 
 type WorkerStatus struct {
 	Running bool       `json:"running"`
+	DryRun  bool       `json:"dry_run"`
 	LastRun *time.Time `json:"last_run"`
 }
 
 type WorkerProcessContext struct {
 	Worker      *Worker
 	Credential  *hb.CookieCredential
+	Credentials []*hb.CookieCredential
+	// all database writes of the run go through the writer so that dry runs write nothing
+	Writer      RepositoryWriter
 	WorkerState interface{}
+	// manual runs are not interrupted by stopping the scheduled worker, only by shutting down
+	Manual bool
 }
 
 type WorkerProcessFunc = func(*WorkerProcessContext) error
 
+func (c *WorkerProcessContext) ShouldStop() bool {
+	if c.Worker.isShuttingDown() {
+		return true
+	}
+	return !c.Manual && !c.Worker.isStarted()
+}
+
+// ErrRunInProgress is returned by RunOnce while the worker is already running.
+var ErrRunInProgress = errors.New("worker is already running")
+
+// ErrWorkerStarted is returned when changing the dry-run mode of a started worker.
+var ErrWorkerStarted = errors.New("worker is started, stop it to change the dry-run mode")
+
+// how often an idle worker checks whether it should run or stop
+const idleCheckInterval = time.Second
+
 type ProceedSignal int
 
 const (
@@ -47,55 +91,211 @@ const (
 
 func (w *Worker) Stop() {
 	w.logger.Info("Stop processing...")
+	w.stateMutex.Lock()
+	defer w.stateMutex.Unlock()
 	w.shouldRun = false
 }
 
+func (w *Worker) isStarted() bool {
+	w.stateMutex.Lock()
+	defer w.stateMutex.Unlock()
+	return w.shouldRun
+}
+
+func (w *Worker) isShuttingDown() bool {
+	return w.ctx != nil && w.ctx.Err() != nil
+}
+
+// Only hiking events are processed unless the worker is configured otherwise.
+func (w *Worker) isActivityEnabled(activity hb.Activity) bool {
+	if w.enabledActivities == nil {
+		return activity == hb.HikingActivity
+	}
+	return w.enabledActivities[activity]
+}
+
 func (w *Worker) getProceedSignal() ProceedSignal {
-	if !w.shouldRun {
+	if !w.isStarted() {
 		return ShouldStop
 	}
 
-	if w.LastRunningTime == nil {
+	lastRunningTime := w.getLastRunningTime()
+	if lastRunningTime == nil {
 		return ShouldProcess
 	}
 
 	now := time.Now()
-	timeSinceLastRun := now.Sub(*w.LastRunningTime)
+	timeSinceLastRun := now.Sub(*lastRunningTime)
 	if timeSinceLastRun > w.interval {
 		return ShouldProcess
 	}
 	return ShouldIgnore
 }
 
-func (w *Worker) selectAccount() (*hb.Credential, error) {
-	account, err := w.repository.Login.GetAvailableAccount()
+func (w *Worker) selectAccounts() ([]hb.Credential, error) {
+	limit := w.concurrency
+	if limit < 1 {
+		limit = 1
+	}
+	accounts, err := w.repository.Login.GetAvailableAccounts(limit)
 	if err != nil {
 		return nil, err
 	}
 
-	if account == nil {
+	if len(accounts) == 0 {
 		return nil, fmt.Errorf("no accounts found")
 	}
-	hbAccount := hb.Credential{
-		Email:    account.Username,
-		Password: account.Password,
+	hbAccounts := []hb.Credential{}
+	for _, account := range accounts {
+		hbAccounts = append(hbAccounts, hb.Credential{
+			Email:    account.Username,
+			Password: account.Password,
+		})
+	}
+	return hbAccounts, nil
+}
+
+func (w *Worker) login(hbAccounts []hb.Credential) []*hb.CookieCredential {
+	credentials := []*hb.CookieCredential{}
+	for _, hbAccount := range hbAccounts {
+		credential, err := hb.Login(w.repository.Login, &hbAccount)
+		if err != nil {
+			w.logger.Warnf("Unable to login as user %s", hbAccount.Email)
+			continue
+		}
+		credentials = append(credentials, credential)
 	}
-	return &hbAccount, nil
+	return credentials
+}
+
+func (w *Worker) getLastRunningTime() *time.Time {
+	w.stateMutex.Lock()
+	defer w.stateMutex.Unlock()
+	return w.lastRunningTime
+}
+
+func (w *Worker) setLastRunningTime(lastRunningTime *time.Time) {
+	w.stateMutex.Lock()
+	defer w.stateMutex.Unlock()
+	w.lastRunningTime = lastRunningTime
 }
 
 func (w *Worker) markProcessCompleted() {
 	now := time.Now()
-	w.LastRunningTime = &now
+	w.setLastRunningTime(&now)
+}
+
+// LastReport returns the report of the last run, nil if the worker has not run yet.
+func (w *Worker) LastReport() *RunReport {
+	w.stateMutex.Lock()
+	defer w.stateMutex.Unlock()
+	return w.lastReport
+}
+
+func (w *Worker) setLastReport(report *RunReport) {
+	w.stateMutex.Lock()
+	defer w.stateMutex.Unlock()
+	w.lastReport = report
+}
+
+func (w *Worker) isDryRun() bool {
+	w.stateMutex.Lock()
+	defer w.stateMutex.Unlock()
+	return w.dryRun
+}
+
+// SetDryRun changes the mode of the scheduled runs, failing with ErrWorkerStarted unless the worker is stopped.
+func (w *Worker) SetDryRun(dryRun bool) error {
+	w.stateMutex.Lock()
+	defer w.stateMutex.Unlock()
+	if w.dryRun == dryRun {
+		return nil
+	}
+	if w.shouldRun {
+		return ErrWorkerStarted
+	}
+	w.dryRun = dryRun
+	return nil
+}
+
+/*
+run processes the worker once. Scheduled runs wait for a manual run to finish
+and restart the interval, manual runs fail with ErrRunInProgress instead of
+waiting and leave the schedule as is.
+*/
+func (w *Worker) run(dryRun bool, manual bool) (*RunReport, error) {
+	if !manual {
+		w.runMutex.Lock()
+		defer w.markProcessCompleted()
+	} else if !w.runMutex.TryLock() {
+		return nil, ErrRunInProgress
+	}
+	defer w.runMutex.Unlock()
+
+	report := &RunReport{
+		DryRun:     dryRun,
+		StartedAt:  time.Now(),
+		Operations: []PlannedOperation{},
+	}
+	finish := func(err error) (*RunReport, error) {
+		now := time.Now()
+		report.FinishedAt = &now
+		if err != nil {
+			message := err.Error()
+			report.Error = &message
+		}
+		w.setLastReport(report)
+		return report, err
+	}
+
+	hbAccounts, err := w.selectAccounts()
+	if err != nil {
+		w.logger.Errorf("Unable to retrieve available account: %+v\n", err)
+		return finish(err)
+	}
+
+	credentials := w.login(hbAccounts)
+	if len(credentials) == 0 {
+		w.logger.Warnf("Unable to login with any of the %d selected accounts", len(hbAccounts))
+		return finish(fmt.Errorf("unable to login with any of the %d selected accounts", len(hbAccounts)))
+	}
+	w.sessions.Set(credentials[0])
+
+	if err := w.ProcessFunc(&WorkerProcessContext{
+		Worker:      w,
+		Credential:  credentials[0],
+		Credentials: credentials,
+		Writer:      createWriter(w.repository, report),
+		Manual:      manual,
+	}); err != nil {
+		w.logger.Warnf("Worker encountered error %+v\n", err)
+		return finish(err)
+	}
+
+	if dryRun {
+		w.logger.Infof("Dry run completed with %d planned operations", len(report.Operations))
+	}
+	return finish(nil)
+}
+
+// RunOnce processes the worker a single time regardless of its schedule.
+// In dry-run mode nothing is written and the report lists the planned writes.
+func (w *Worker) RunOnce(dryRun bool) (*RunReport, error) {
+	w.logger.Infof("Running worker once (dry run: %t)...", dryRun)
+	return w.run(dryRun, true)
 }
 
 func (w *Worker) StartProcessing(wg *sync.WaitGroup) {
+	w.stateMutex.Lock()
 	if w.shouldRun {
+		w.stateMutex.Unlock()
 		w.logger.Warn("Refuse to run an already running worker")
 		return
 	}
+	w.shouldRun = true
+	w.stateMutex.Unlock()
 
 	w.logger.Info("Starting worker...")
-	w.shouldRun = true
 	wg.Add(1)
 
 	go func() {
@@ -104,35 +304,16 @@ func (w *Worker) StartProcessing(wg *sync.WaitGroup) {
 			if signal == ShouldStop {
 				w.logger.Info("Stopping worker...")
 				wg.Done()
-				w.LastRunningTime = nil
+				w.setLastRunningTime(nil)
 				break
 			}
 			if signal == ShouldIgnore {
+				time.Sleep(idleCheckInterval)
 				continue
 			}
 
 			w.logger.Info("Start processing...")
-
-			hbAccount, err := w.selectAccount()
-			if err != nil {
-				w.logger.Errorf("Unable to retrieve available account: %+v\n", err)
-				w.markProcessCompleted()
-				continue
-			}
-
-			credential, err := hb.Login(w.repository.Login, hbAccount)
-			if err != nil {
-				w.logger.Warnf("Unable to login as user %s", hbAccount.Email)
-				w.markProcessCompleted()
-				continue
-			}
-
-			if err := w.ProcessFunc(&WorkerProcessContext{
-				Worker:     w,
-				Credential: credential,
-			}); err != nil {
-				w.logger.Warnf("Worker encountered error %+v\n", err)
-				w.markProcessCompleted()
+			if _, err := w.run(w.isDryRun(), false); err != nil {
 				continue
 			}
 
@@ -144,7 +325,8 @@ func (w *Worker) StartProcessing(wg *sync.WaitGroup) {
 
 func (w *Worker) Status() *WorkerStatus {
 	return &WorkerStatus{
-		LastRun: w.LastRunningTime,
-		Running: w.shouldRun,
+		LastRun: w.getLastRunningTime(),
+		Running: w.isStarted(),
+		DryRun:  w.isDryRun(),
 	}
 }
@@ -1,6 +1,8 @@
 package worker
 
 import (
+	"context"
+	"fmt"
 	"hb-crawler/rating-gain/database"
 	hb "hb-crawler/rating-gain/hiking-buddies"
 	"sync"
@@ -12,13 +14,47 @@ import (
 const (
 	PastEventWorkerID  = "past-event"
 	PointsGainWorkerID = "points-gain"
+	BackfillWorkerID   = "historical-backfill"
+
+	DefaultPastEventConcurrency = 1
+	// requests are not throttled unless an interval is configured
+	DefaultRequestInterval time.Duration = 0
 )
 
+type WorkerGroupConfig struct {
+	// number of participants the past event worker fetches in parallel
+	PastEventConcurrency int
+	// minimum time between two requests against Hiking Buddies, shared by all workers
+	RequestInterval time.Duration
+	// whether to page through older events the crawler has missed
+	EnableBackfill bool
+	// activities whose events are recorded by the past event and backfill workers
+	EnabledActivities map[hb.Activity]bool
+	// workers plan their writes without touching the database
+	DryRun bool
+}
+
+func DefaultWorkerGroupConfig() *WorkerGroupConfig {
+	return &WorkerGroupConfig{
+		PastEventConcurrency: DefaultPastEventConcurrency,
+		RequestInterval:      DefaultRequestInterval,
+		EnabledActivities: map[hb.Activity]bool{
+			hb.HikingActivity: true,
+		},
+	}
+}
+
 type WorkerGroup struct {
 	Repository *database.DatabaseRepository
 	Credential *hb.Credential
 	workers    map[string]*Worker
 	waitGroup  *sync.WaitGroup
+	// shared by the workers and every other crawler of the application
+	rateLimiter *hb.RateLimiter
+	// last session the workers logged in with
+	sessions *hb.SessionStore
+	// stops manual runs too, which Stop leaves running
+	shutdown context.CancelFunc
 }
 
 func (c *WorkerGroup) Stop() {
@@ -27,35 +63,114 @@ func (c *WorkerGroup) Stop() {
 	}
 }
 
+// Shutdown stops the workers and interrupts their manual runs.
+func (c *WorkerGroup) Shutdown() {
+	if c.shutdown != nil {
+		c.shutdown()
+	}
+	c.Stop()
+}
+
 func (c *WorkerGroup) Start() {
 	for _, worker := range c.workers {
 		worker.StartProcessing(c.waitGroup)
 	}
 }
 
+// SetDryRun changes the mode of all workers, failing with ErrWorkerStarted before changing any if one is started.
+func (c *WorkerGroup) SetDryRun(dryRun bool) error {
+	for _, worker := range c.workers {
+		if worker.isStarted() && worker.isDryRun() != dryRun {
+			return ErrWorkerStarted
+		}
+	}
+	for _, worker := range c.workers {
+		if err := worker.SetDryRun(dryRun); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *WorkerGroup) GetWorker(id string) (*Worker, error) {
+	worker, found := c.workers[id]
+	if !found {
+		return nil, fmt.Errorf("no worker with id %s", id)
+	}
+	return worker, nil
+}
+
+// RateLimiter returns the limiter requests against Hiking Buddies outside of the workers have to wait for too.
+func (c *WorkerGroup) RateLimiter() *hb.RateLimiter {
+	return c.rateLimiter
+}
+
+// Session returns the last session the workers logged in with, nil if they have not logged in within hb.CredentialMaxAge.
+func (c *WorkerGroup) Session() *hb.CookieCredential {
+	return c.sessions.Get()
+}
+
 func (c *WorkerGroup) Wait() {
 	c.waitGroup.Wait()
 }
 
-func CreateWorkerGroup(repo *database.DatabaseRepository, waitGroup *sync.WaitGroup) *WorkerGroup {
+func CreateWorkerGroup(
+	repo *database.DatabaseRepository,
+	waitGroup *sync.WaitGroup,
+	config *WorkerGroupConfig,
+) *WorkerGroup {
+	if config == nil {
+		config = DefaultWorkerGroupConfig()
+	}
+	rateLimiter := hb.CreateRateLimiter(config.RequestInterval)
+	sessions := hb.CreateSessionStore()
+	ctx, shutdown := context.WithCancel(context.Background())
+
 	pastEventWorker := CreatePastEventWorker(&WorkerConfig{
-		Repository: repo,
-		Interval:   12 * time.Hour,
+		Repository:        repo,
+		Interval:          12 * time.Hour,
+		DryRun:            config.DryRun,
+		Context:           ctx,
+		Sessions:          sessions,
+		Concurrency:       config.PastEventConcurrency,
+		RateLimiter:       rateLimiter,
+		EnabledActivities: config.EnabledActivities,
 	})
 
 	pointsGainWorker := CreatePointsGainWorker(&WorkerConfig{
-		Repository: repo,
-		Interval:   time.Hour,
+		Repository:  repo,
+		Interval:    time.Hour,
+		DryRun:      config.DryRun,
+		Context:     ctx,
+		Sessions:    sessions,
+		Concurrency: 1,
+		RateLimiter: rateLimiter,
 	})
 
 	workers := map[string]*Worker{}
 	workers[PastEventWorkerID] = pastEventWorker
 	workers[PointsGainWorkerID] = pointsGainWorker
 
+	if config.EnableBackfill {
+		workers[BackfillWorkerID] = CreateHistoricalBackfillWorker(&WorkerConfig{
+			Repository:        repo,
+			Interval:          6 * time.Hour,
+			DryRun:            config.DryRun,
+			Context:           ctx,
+			Sessions:          sessions,
+			Concurrency:       config.PastEventConcurrency,
+			RateLimiter:       rateLimiter,
+			EnabledActivities: config.EnabledActivities,
+		})
+	}
+
 	workerGroup := WorkerGroup{
-		Repository: repo,
-		workers:    workers,
-		waitGroup:  waitGroup,
+		Repository:  repo,
+		workers:     workers,
+		waitGroup:   waitGroup,
+		rateLimiter: rateLimiter,
+		sessions:    sessions,
+		shutdown:    shutdown,
 	}
 
 	return &workerGroup
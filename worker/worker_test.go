@@ -0,0 +1,75 @@
+package worker
+
+import (
+	"errors"
+	"hb-crawler/rating-gain/database"
+	"path/filepath"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func createTestWorker(t *testing.T) *Worker {
+	db, err := database.InitializeDatabase(filepath.Join(t.TempDir(), "db.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return &Worker{
+		repository:  database.GetRepository(db),
+		logger:      log.New(),
+		ProcessFunc: func(*WorkerProcessContext) error { return nil },
+	}
+}
+
+func TestRunOnceConflictsWithRunningWorker(t *testing.T) {
+	w := createTestWorker(t)
+	w.runMutex.Lock()
+	if _, err := w.RunOnce(true); !errors.Is(err, ErrRunInProgress) {
+		t.Errorf("run while running returned %v, expected %v", err, ErrRunInProgress)
+	}
+	w.runMutex.Unlock()
+}
+
+func TestRunOnceKeepsSchedule(t *testing.T) {
+	w := createTestWorker(t)
+	// no accounts are stored, so the run fails after selecting them
+	report, err := w.RunOnce(false)
+	if err == nil || report == nil || report.Error == nil {
+		t.Fatalf("run returned %+v, %v", report, err)
+	}
+	if w.LastReport() != report {
+		t.Errorf("last report %+v, expected %+v", w.LastReport(), report)
+	}
+	if w.Status().LastRun != nil {
+		t.Errorf("manual run marked the worker completed at %v", w.Status().LastRun)
+	}
+
+	if _, err := w.run(false, false); err == nil {
+		t.Fatal("scheduled run without accounts succeeded")
+	}
+	if w.Status().LastRun == nil {
+		t.Error("scheduled run did not mark the worker completed")
+	}
+}
+
+func TestSetDryRunRefusesStartedWorker(t *testing.T) {
+	w := createTestWorker(t)
+	if err := w.SetDryRun(true); err != nil || !w.Status().DryRun {
+		t.Fatalf("stopped worker did not switch to dry-run mode: %v", err)
+	}
+
+	w.shouldRun = true
+	if err := w.SetDryRun(false); !errors.Is(err, ErrWorkerStarted) || !w.Status().DryRun {
+		t.Errorf("started worker returned %v and dry run %t", err, w.Status().DryRun)
+	}
+	// keeping the mode of a started worker is fine
+	if err := w.SetDryRun(true); err != nil {
+		t.Errorf("keeping the mode returned %v", err)
+	}
+
+	group := &WorkerGroup{workers: map[string]*Worker{"started": w, "stopped": createTestWorker(t)}}
+	if err := group.SetDryRun(false); !errors.Is(err, ErrWorkerStarted) || group.workers["stopped"].Status().DryRun {
+		t.Errorf("group returned %v and changed the stopped worker", err)
+	}
+}
@@ -0,0 +1,99 @@
+package worker
+
+import (
+	"sync"
+	"time"
+
+	"hb-crawler/rating-gain/database"
+)
+
+// RepositoryWriter is everything a worker is allowed to write to the database.
+type RepositoryWriter interface {
+	SaveEvent(event *database.EventRecord) error
+	SaveRoute(route *database.RouteRecord) error
+	CreatePointsGainEntry(pointsGain *database.PointGainRecord) error
+	UpdatePointsGainEntry(pointsGain *database.PointGainRecord) error
+}
+
+type repositoryWriter struct {
+	repo *database.DatabaseRepository
+}
+
+func (w *repositoryWriter) SaveEvent(event *database.EventRecord) error {
+	return w.repo.Event.SaveEvent(event)
+}
+
+func (w *repositoryWriter) SaveRoute(route *database.RouteRecord) error {
+	_, err := w.repo.Route.SaveRoute(route)
+	return err
+}
+
+func (w *repositoryWriter) CreatePointsGainEntry(pointsGain *database.PointGainRecord) error {
+	return w.repo.PointGains.CreatePointsGainEntry(pointsGain)
+}
+
+func (w *repositoryWriter) UpdatePointsGainEntry(pointsGain *database.PointGainRecord) error {
+	return w.repo.PointGains.UpdatePointsGainEntry(pointsGain)
+}
+
+type OperationType string
+
+const (
+	InsertOperation OperationType = "insert"
+	UpdateOperation OperationType = "update"
+)
+
+type PlannedOperation struct {
+	Operation OperationType `json:"operation"`
+	Table     string        `json:"table"`
+	Record    any           `json:"record"`
+}
+
+type RunReport struct {
+	DryRun     bool               `json:"dry_run"`
+	StartedAt  time.Time          `json:"started_at"`
+	FinishedAt *time.Time         `json:"finished_at"`
+	Operations []PlannedOperation `json:"operations"`
+	Error      *string            `json:"error"`
+}
+
+// dryRunWriter records every write it receives into the report instead of
+// touching the database.
+type dryRunWriter struct {
+	mutex  sync.Mutex
+	report *RunReport
+}
+
+func (w *dryRunWriter) plan(operation OperationType, table string, record any) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.report.Operations = append(w.report.Operations, PlannedOperation{
+		Operation: operation,
+		Table:     table,
+		Record:    record,
+	})
+	return nil
+}
+
+func (w *dryRunWriter) SaveEvent(event *database.EventRecord) error {
+	return w.plan(InsertOperation, "events", *event)
+}
+
+func (w *dryRunWriter) SaveRoute(route *database.RouteRecord) error {
+	return w.plan(InsertOperation, "routes", *route)
+}
+
+func (w *dryRunWriter) CreatePointsGainEntry(pointsGain *database.PointGainRecord) error {
+	return w.plan(InsertOperation, "pointsGain", *pointsGain)
+}
+
+func (w *dryRunWriter) UpdatePointsGainEntry(pointsGain *database.PointGainRecord) error {
+	return w.plan(UpdateOperation, "pointsGain", *pointsGain)
+}
+
+func createWriter(repo *database.DatabaseRepository, report *RunReport) RepositoryWriter {
+	if report.DryRun {
+		return &dryRunWriter{report: report}
+	}
+	return &repositoryWriter{repo: repo}
+}